@@ -1,46 +0,0 @@
-package main
-
-import (
-	"log"
-
-	"github.com/streadway/amqp"
-)
-
-func publishMessage(body []byte, rabbitmq_url string) {
-	conn, err := amqp.Dial(rabbitmq_url)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-
-	ch, err := conn.Channel()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		"notifications", // queue name
-		true,            // durable
-		false,           // auto-delete
-		false,           // exclusive
-		false,           // no-wait
-		nil,             // arguments
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key (queue name)
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        body,
-		})
-	if err != nil {
-		log.Fatal(err)
-	}
-}
@@ -7,24 +7,52 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countUserAlerts = `-- name: CountUserAlerts :one
+SELECT count(*) FROM alerts WHERE user_id = $1
+`
+
+func (q *Queries) CountUserAlerts(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUserAlerts, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAlert = `-- name: CreateAlert :one
 INSERT INTO alerts (
-user_id, min_price,max_price, location, property_type,contact_method )
-VALUES ( $1, $2, $3, $4, $5,$6)
-RETURNING id, user_id, min_price, max_price, location, property_type, contact_method
+user_id, min_price,max_price, locations, property_type,contact_method, frequency, expires_at,
+latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms,
+include_keywords, exclude_keywords, location_ids )
+VALUES ( $1, $2, $3, coalesce($4::text[], '{}'), $5,$6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+coalesce($16::text[], '{}'), coalesce($17::text[], '{}'), coalesce($18::uuid[], '{}'))
+RETURNING id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids
 `
 
 type CreateAlertParams struct {
-	UserID        uuid.UUID
-	MinPrice      int64
-	MaxPrice      int64
-	Location      string
-	PropertyType  string
-	ContactMethod string
+	UserID          uuid.UUID
+	MinPrice        int64
+	MaxPrice        int64
+	Locations       []string
+	PropertyType    string
+	ContactMethod   string
+	Frequency       string
+	ExpiresAt       sql.NullTime
+	Latitude        sql.NullFloat64
+	Longitude       sql.NullFloat64
+	RadiusKm        sql.NullFloat64
+	MinBedrooms     int32
+	MaxBedrooms     int32
+	MinBathrooms    int32
+	MaxBathrooms    int32
+	IncludeKeywords []string
+	ExcludeKeywords []string
+	LocationIDs     []uuid.UUID
 }
 
 func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert, error) {
@@ -32,9 +60,21 @@ func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert
 		arg.UserID,
 		arg.MinPrice,
 		arg.MaxPrice,
-		arg.Location,
+		pq.Array(arg.Locations),
 		arg.PropertyType,
 		arg.ContactMethod,
+		arg.Frequency,
+		arg.ExpiresAt,
+		arg.Latitude,
+		arg.Longitude,
+		arg.RadiusKm,
+		arg.MinBedrooms,
+		arg.MaxBedrooms,
+		arg.MinBathrooms,
+		arg.MaxBathrooms,
+		pq.Array(arg.IncludeKeywords),
+		pq.Array(arg.ExcludeKeywords),
+		pq.Array(arg.LocationIDs),
 	)
 	var i Alert
 	err := row.Scan(
@@ -42,15 +82,54 @@ func (q *Queries) CreateAlert(ctx context.Context, arg CreateAlertParams) (Alert
 		&i.UserID,
 		&i.MinPrice,
 		&i.MaxPrice,
-		&i.Location,
 		&i.PropertyType,
 		&i.ContactMethod,
+		&i.Active,
+		&i.DisabledReason,
+		&i.Frequency,
+		&i.ExpiresAt,
+		pq.Array(&i.Locations),
+		&i.Latitude,
+		&i.Longitude,
+		&i.RadiusKm,
+		&i.MinBedrooms,
+		&i.MaxBedrooms,
+		&i.MinBathrooms,
+		&i.MaxBathrooms,
+		pq.Array(&i.IncludeKeywords),
+		pq.Array(&i.ExcludeKeywords),
+		pq.Array(&i.LocationIDs),
 	)
 	return i, err
 }
 
+const deleteAlert = `-- name: DeleteAlert :exec
+DELETE FROM alerts WHERE id = $1
+`
+
+func (q *Queries) DeleteAlert(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteAlert, id)
+	return err
+}
+
+const disableAlert = `-- name: DisableAlert :exec
+UPDATE alerts
+SET active = false, disabled_reason = $2
+WHERE id = $1
+`
+
+type DisableAlertParams struct {
+	ID             uuid.UUID
+	DisabledReason sql.NullString
+}
+
+func (q *Queries) DisableAlert(ctx context.Context, arg DisableAlertParams) error {
+	_, err := q.db.ExecContext(ctx, disableAlert, arg.ID, arg.DisabledReason)
+	return err
+}
+
 const getAlert = `-- name: GetAlert :one
-SELECT id, user_id, min_price, max_price, location, property_type, contact_method FROM alerts WHERE $1=id
+SELECT id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids FROM alerts WHERE $1=id
 `
 
 func (q *Queries) GetAlert(ctx context.Context, id uuid.UUID) (Alert, error) {
@@ -61,15 +140,166 @@ func (q *Queries) GetAlert(ctx context.Context, id uuid.UUID) (Alert, error) {
 		&i.UserID,
 		&i.MinPrice,
 		&i.MaxPrice,
-		&i.Location,
 		&i.PropertyType,
 		&i.ContactMethod,
+		&i.Active,
+		&i.DisabledReason,
+		&i.Frequency,
+		&i.ExpiresAt,
+		pq.Array(&i.Locations),
+		&i.Latitude,
+		&i.Longitude,
+		&i.RadiusKm,
+		&i.MinBedrooms,
+		&i.MaxBedrooms,
+		&i.MinBathrooms,
+		&i.MaxBathrooms,
+		pq.Array(&i.IncludeKeywords),
+		pq.Array(&i.ExcludeKeywords),
+		pq.Array(&i.LocationIDs),
 	)
 	return i, err
 }
 
+const getMatchingAlerts = `-- name: GetMatchingAlerts :many
+SELECT id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids FROM alerts
+WHERE min_price <= $1::bigint
+  AND max_price >= $1::bigint
+  AND (
+    (cardinality(locations) = 0 AND cardinality(location_ids) = 0)
+    OR EXISTS (SELECT 1 FROM unnest(locations) l WHERE lower(l) = lower($2::text))
+    -- the listing's location or any place it's in
+    OR location_ids && ARRAY(
+      WITH RECURSIVE up AS (
+        SELECT id, parent_id FROM locations WHERE id = $6::uuid
+        UNION ALL
+        SELECT l.id, l.parent_id FROM locations l JOIN up ON l.id = up.parent_id
+      )
+      SELECT id FROM up
+    )
+  )
+  AND lower(property_type) = lower($3::text)
+  AND (min_bedrooms = 0 OR $4::int >= min_bedrooms)
+  AND (max_bedrooms = 0 OR $4::int <= max_bedrooms)
+  AND (min_bathrooms = 0 OR $5::int >= min_bathrooms)
+  AND (max_bathrooms = 0 OR $5::int <= max_bathrooms)
+  AND active
+  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+`
+
+type GetMatchingAlertsParams struct {
+	Price        int64
+	Location     string
+	PropertyType string
+	Bedrooms     sql.NullInt32
+	Bathrooms    sql.NullInt32
+	LocationID   uuid.NullUUID
+}
+
+func (q *Queries) GetMatchingAlerts(ctx context.Context, arg GetMatchingAlertsParams) ([]Alert, error) {
+	rows, err := q.db.QueryContext(ctx, getMatchingAlerts,
+		arg.Price,
+		arg.Location,
+		arg.PropertyType,
+		arg.Bedrooms,
+		arg.Bathrooms,
+		arg.LocationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Alert
+	for rows.Next() {
+		var i Alert
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.MinPrice,
+			&i.MaxPrice,
+			&i.PropertyType,
+			&i.ContactMethod,
+			&i.Active,
+			&i.DisabledReason,
+			&i.Frequency,
+			&i.ExpiresAt,
+			pq.Array(&i.Locations),
+			&i.Latitude,
+			&i.Longitude,
+			&i.RadiusKm,
+			&i.MinBedrooms,
+			&i.MaxBedrooms,
+			&i.MinBathrooms,
+			&i.MaxBathrooms,
+			pq.Array(&i.IncludeKeywords),
+			pq.Array(&i.ExcludeKeywords),
+			pq.Array(&i.LocationIDs),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnlocatedAlerts = `-- name: GetUnlocatedAlerts :many
+SELECT id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids FROM alerts
+WHERE cardinality(location_ids) = 0 AND cardinality(locations) > 0
+`
+
+func (q *Queries) GetUnlocatedAlerts(ctx context.Context) ([]Alert, error) {
+	rows, err := q.db.QueryContext(ctx, getUnlocatedAlerts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Alert
+	for rows.Next() {
+		var i Alert
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.MinPrice,
+			&i.MaxPrice,
+			&i.PropertyType,
+			&i.ContactMethod,
+			&i.Active,
+			&i.DisabledReason,
+			&i.Frequency,
+			&i.ExpiresAt,
+			pq.Array(&i.Locations),
+			&i.Latitude,
+			&i.Longitude,
+			&i.RadiusKm,
+			&i.MinBedrooms,
+			&i.MaxBedrooms,
+			&i.MinBathrooms,
+			&i.MaxBathrooms,
+			pq.Array(&i.IncludeKeywords),
+			pq.Array(&i.ExcludeKeywords),
+			pq.Array(&i.LocationIDs),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserAlerts = `-- name: GetUserAlerts :many
-SELECT id, user_id, min_price, max_price, location, property_type, contact_method FROM alerts WHERE $1=user_id
+SELECT id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids FROM alerts WHERE $1=user_id
 `
 
 func (q *Queries) GetUserAlerts(ctx context.Context, userID uuid.UUID) ([]Alert, error) {
@@ -86,9 +316,23 @@ func (q *Queries) GetUserAlerts(ctx context.Context, userID uuid.UUID) ([]Alert,
 			&i.UserID,
 			&i.MinPrice,
 			&i.MaxPrice,
-			&i.Location,
 			&i.PropertyType,
 			&i.ContactMethod,
+			&i.Active,
+			&i.DisabledReason,
+			&i.Frequency,
+			&i.ExpiresAt,
+			pq.Array(&i.Locations),
+			&i.Latitude,
+			&i.Longitude,
+			&i.RadiusKm,
+			&i.MinBedrooms,
+			&i.MaxBedrooms,
+			&i.MinBathrooms,
+			&i.MaxBathrooms,
+			pq.Array(&i.IncludeKeywords),
+			pq.Array(&i.ExcludeKeywords),
+			pq.Array(&i.LocationIDs),
 		); err != nil {
 			return nil, err
 		}
@@ -102,3 +346,116 @@ func (q *Queries) GetUserAlerts(ctx context.Context, userID uuid.UUID) ([]Alert,
 	}
 	return items, nil
 }
+
+const setAlertLocations = `-- name: SetAlertLocations :exec
+UPDATE alerts SET location_ids = coalesce($2::uuid[], '{}') WHERE id = $1
+`
+
+type SetAlertLocationsParams struct {
+	ID          uuid.UUID
+	LocationIDs []uuid.UUID
+}
+
+func (q *Queries) SetAlertLocations(ctx context.Context, arg SetAlertLocationsParams) error {
+	_, err := q.db.ExecContext(ctx, setAlertLocations, arg.ID, pq.Array(arg.LocationIDs))
+	return err
+}
+
+const updateAlert = `-- name: UpdateAlert :one
+UPDATE alerts
+SET
+  min_price = $2,
+  max_price = $3,
+  locations = coalesce($4::text[], '{}'),
+  property_type = $5,
+  contact_method = $6,
+  frequency = $7,
+  active = $8,
+  disabled_reason = $9,
+  expires_at = $10,
+  latitude = $11,
+  longitude = $12,
+  radius_km = $13,
+  min_bedrooms = $14,
+  max_bedrooms = $15,
+  min_bathrooms = $16,
+  max_bathrooms = $17,
+  include_keywords = coalesce($18::text[], '{}'),
+  exclude_keywords = coalesce($19::text[], '{}'),
+  location_ids = coalesce($20::uuid[], '{}')
+WHERE id = $1
+RETURNING id, user_id, min_price, max_price, property_type, contact_method, active, disabled_reason, frequency, expires_at, locations, latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms, include_keywords, exclude_keywords, location_ids
+`
+
+type UpdateAlertParams struct {
+	ID              uuid.UUID
+	MinPrice        int64
+	MaxPrice        int64
+	Locations       []string
+	PropertyType    string
+	ContactMethod   string
+	Frequency       string
+	Active          bool
+	DisabledReason  sql.NullString
+	ExpiresAt       sql.NullTime
+	Latitude        sql.NullFloat64
+	Longitude       sql.NullFloat64
+	RadiusKm        sql.NullFloat64
+	MinBedrooms     int32
+	MaxBedrooms     int32
+	MinBathrooms    int32
+	MaxBathrooms    int32
+	IncludeKeywords []string
+	ExcludeKeywords []string
+	LocationIDs     []uuid.UUID
+}
+
+func (q *Queries) UpdateAlert(ctx context.Context, arg UpdateAlertParams) (Alert, error) {
+	row := q.db.QueryRowContext(ctx, updateAlert,
+		arg.ID,
+		arg.MinPrice,
+		arg.MaxPrice,
+		pq.Array(arg.Locations),
+		arg.PropertyType,
+		arg.ContactMethod,
+		arg.Frequency,
+		arg.Active,
+		arg.DisabledReason,
+		arg.ExpiresAt,
+		arg.Latitude,
+		arg.Longitude,
+		arg.RadiusKm,
+		arg.MinBedrooms,
+		arg.MaxBedrooms,
+		arg.MinBathrooms,
+		arg.MaxBathrooms,
+		pq.Array(arg.IncludeKeywords),
+		pq.Array(arg.ExcludeKeywords),
+		pq.Array(arg.LocationIDs),
+	)
+	var i Alert
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.MinPrice,
+		&i.MaxPrice,
+		&i.PropertyType,
+		&i.ContactMethod,
+		&i.Active,
+		&i.DisabledReason,
+		&i.Frequency,
+		&i.ExpiresAt,
+		pq.Array(&i.Locations),
+		&i.Latitude,
+		&i.Longitude,
+		&i.RadiusKm,
+		&i.MinBedrooms,
+		&i.MaxBedrooms,
+		&i.MinBathrooms,
+		&i.MaxBathrooms,
+		pq.Array(&i.IncludeKeywords),
+		pq.Array(&i.ExcludeKeywords),
+		pq.Array(&i.LocationIDs),
+	)
+	return i, err
+}
@@ -29,6 +29,70 @@ func (q *Queries) CreateFavorite(ctx context.Context, arg CreateFavoriteParams)
 	return i, err
 }
 
+const deleteFavorite = `-- name: DeleteFavorite :exec
+DELETE FROM favorites WHERE user_id = $1 AND listing_id = $2
+`
+
+type DeleteFavoriteParams struct {
+	UserID    uuid.UUID
+	ListingID uuid.UUID
+}
+
+func (q *Queries) DeleteFavorite(ctx context.Context, arg DeleteFavoriteParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFavorite, arg.UserID, arg.ListingID)
+	return err
+}
+
+const deleteListingFavorites = `-- name: DeleteListingFavorites :exec
+DELETE FROM favorites WHERE listing_id = $1
+`
+
+func (q *Queries) DeleteListingFavorites(ctx context.Context, listingID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteListingFavorites, listingID)
+	return err
+}
+
+const getListingFavoriteUsers = `-- name: GetListingFavoriteUsers :many
+SELECT users.id, users.first_name, users.last_name, users.email, users.phone_number, users.role, users.password, users.created_at, users.company_name, users.verified, users.rating FROM favorites
+JOIN users ON users.id = favorites.user_id
+WHERE favorites.listing_id = $1
+`
+
+func (q *Queries) GetListingFavoriteUsers(ctx context.Context, listingID uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getListingFavoriteUsers, listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.PhoneNumber,
+			&i.Role,
+			&i.Password,
+			&i.CreatedAt,
+			&i.CompanyName,
+			&i.Verified,
+			&i.Rating,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserFavorites = `-- name: GetUserFavorites :many
 SELECT id, user_id, listing_id FROM favorites WHERE user_id = $1
 `
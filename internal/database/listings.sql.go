@@ -13,12 +13,77 @@ import (
 	"github.com/google/uuid"
 )
 
+const countListings = `-- name: CountListings :one
+SELECT count(*)
+FROM search_listings(
+  $1::text, $2::bigint, $3::bigint, $4::text,
+  $5::int, $6::int, $7::text, $8::boolean,
+  $9::text, $10::bigint,
+  $11::float8, $12::float8, $13::float8,
+  $14::float8, $15::float8, $16::float8, $17::float8,
+  $18::uuid, $19::text, $20::boolean
+) m
+`
+
+type CountListingsParams struct {
+	Location        sql.NullString
+	MinPrice        sql.NullInt64
+	MaxPrice        sql.NullInt64
+	PropertyType    sql.NullString
+	MinBedrooms     sql.NullInt32
+	MinBathrooms    sql.NullInt32
+	Furnishing      sql.NullString
+	Serviced        sql.NullBool
+	RentPeriod      sql.NullString
+	MaxMoveInCost   sql.NullInt64
+	NearLat         sql.NullFloat64
+	NearLng         sql.NullFloat64
+	RadiusKm        sql.NullFloat64
+	MinLat          sql.NullFloat64
+	MinLng          sql.NullFloat64
+	MaxLat          sql.NullFloat64
+	MaxLng          sql.NullFloat64
+	LocationID      uuid.NullUUID
+	Search          sql.NullString
+	RequireDistance bool
+}
+
+func (q *Queries) CountListings(ctx context.Context, arg CountListingsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countListings,
+		arg.Location,
+		arg.MinPrice,
+		arg.MaxPrice,
+		arg.PropertyType,
+		arg.MinBedrooms,
+		arg.MinBathrooms,
+		arg.Furnishing,
+		arg.Serviced,
+		arg.RentPeriod,
+		arg.MaxMoveInCost,
+		arg.NearLat,
+		arg.NearLng,
+		arg.RadiusKm,
+		arg.MinLat,
+		arg.MinLng,
+		arg.MaxLat,
+		arg.MaxLng,
+		arg.LocationID,
+		arg.Search,
+		arg.RequireDistance,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createListing = `-- name: CreateListing :one
 INSERT INTO listings (
 agent_id, title,
-description, price,location,property_type,images, status  )
-VALUES ( $1, $2, $3, $4, $5,$6,$7,$8)
-RETURNING id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at
+description, price,location,property_type,images, status,
+latitude, longtitude, bedrooms, bathrooms,
+furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id  )
+VALUES ( $1, $2, $3, $4, $5,$6,$7,$8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+RETURNING id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at, bedrooms, bathrooms, updated_at, status_changed_at, rented_at, furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id, search_vector, deleted_at
 `
 
 type CreateListingParams struct {
@@ -30,6 +95,17 @@ type CreateListingParams struct {
 	PropertyType string
 	Images       json.RawMessage
 	Status       string
+	Latitude     sql.NullFloat64
+	Longtitude   sql.NullFloat64
+	Bedrooms     sql.NullInt32
+	Bathrooms    sql.NullInt32
+	Furnishing   string
+	Serviced     bool
+	RentPeriod   string
+	AgencyFee    int64
+	LegalFee     int64
+	CautionFee   int64
+	LocationID   uuid.NullUUID
 }
 
 func (q *Queries) CreateListing(ctx context.Context, arg CreateListingParams) (Listing, error) {
@@ -42,6 +118,17 @@ func (q *Queries) CreateListing(ctx context.Context, arg CreateListingParams) (L
 		arg.PropertyType,
 		arg.Images,
 		arg.Status,
+		arg.Latitude,
+		arg.Longtitude,
+		arg.Bedrooms,
+		arg.Bathrooms,
+		arg.Furnishing,
+		arg.Serviced,
+		arg.RentPeriod,
+		arg.AgencyFee,
+		arg.LegalFee,
+		arg.CautionFee,
+		arg.LocationID,
 	)
 	var i Listing
 	err := row.Scan(
@@ -58,12 +145,39 @@ func (q *Queries) CreateListing(ctx context.Context, arg CreateListingParams) (L
 		&i.Images,
 		&i.Status,
 		&i.CreatedAt,
+		&i.Bedrooms,
+		&i.Bathrooms,
+		&i.UpdatedAt,
+		&i.StatusChangedAt,
+		&i.RentedAt,
+		&i.Furnishing,
+		&i.Serviced,
+		&i.RentPeriod,
+		&i.AgencyFee,
+		&i.LegalFee,
+		&i.CautionFee,
+		&i.LocationID,
+		&i.SearchVector,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const deleteListing = `-- name: DeleteListing :exec
+UPDATE listings
+SET
+  deleted_at = CURRENT_TIMESTAMP,
+  updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteListing(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteListing, id)
+	return err
+}
+
 const getListing = `-- name: GetListing :one
-SELECT id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at FROM listings WHERE $1=id
+SELECT id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at, bedrooms, bathrooms, updated_at, status_changed_at, rented_at, furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id, search_vector, deleted_at FROM listings WHERE $1=id
 `
 
 func (q *Queries) GetListing(ctx context.Context, id uuid.UUID) (Listing, error) {
@@ -83,45 +197,185 @@ func (q *Queries) GetListing(ctx context.Context, id uuid.UUID) (Listing, error)
 		&i.Images,
 		&i.Status,
 		&i.CreatedAt,
+		&i.Bedrooms,
+		&i.Bathrooms,
+		&i.UpdatedAt,
+		&i.StatusChangedAt,
+		&i.RentedAt,
+		&i.Furnishing,
+		&i.Serviced,
+		&i.RentPeriod,
+		&i.AgencyFee,
+		&i.LegalFee,
+		&i.CautionFee,
+		&i.LocationID,
+		&i.SearchVector,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getListings = `-- name: GetListings :many
-SELECT id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at
-FROM listings
-WHERE
-  (location = coalesce($1, location))
-  AND (price >= coalesce($2::bigint, price))
-  AND (price <= coalesce($3::bigint, price))
-  AND (property_type = coalesce($4, property_type))
-ORDER BY created_at DESC
-LIMIT $6
-OFFSET $5
+SELECT listings.id, listings.agent_id, listings.title, listings.description, listings.price, listings.location, listings.latitude, listings.longtitude, listings.property_type, listings.verified, listings.images, listings.status, listings.created_at, listings.bedrooms, listings.bathrooms, listings.updated_at, listings.status_changed_at, listings.rented_at, listings.furnishing, listings.serviced, listings.rent_period, listings.agency_fee, listings.legal_fee, listings.caution_fee, listings.location_id, listings.search_vector, listings.deleted_at, m.distance_km, m.rank,
+  -- the best fragments of the description, matches between U+E000 and U+E001
+  CASE WHEN m.query IS NOT NULL THEN ts_headline('english', listings.description, m.query,
+    'StartSel=' || chr(57344) || ', StopSel=' || chr(57345) || ', MaxFragments=2, MaxWords=20, MinWords=8')
+  END AS snippet
+FROM search_listings(
+  $1::text, $2::bigint, $3::bigint, $4::text,
+  $5::int, $6::int, $7::text, $8::boolean,
+  $9::text, $10::bigint,
+  $11::float8, $12::float8, $13::float8,
+  $14::float8, $15::float8, $16::float8, $17::float8,
+  $18::uuid, $19::text, $20::boolean
+) m
+JOIN listings ON listings.id = m.listing_id
+-- keyset pagination: only the listings after the cursor in the sort order
+WHERE ($21::uuid IS NULL OR CASE $22::text
+    WHEN 'price_asc' THEN (listings.price, listings.id) > ($23::bigint, $21::uuid)
+    WHEN 'price_desc' THEN (listings.price, listings.id) < ($23::bigint, $21::uuid)
+    WHEN 'distance' THEN (m.distance_km, listings.id) > ($24::float8, $21::uuid)
+    WHEN 'relevance' THEN (m.rank, listings.id) < ($24::float8, $21::uuid)
+    ELSE (listings.created_at, listings.id) < ($25::timestamp, $21::uuid)
+  END)
+ORDER BY
+  CASE WHEN $22::text = 'price_asc' THEN listings.price END ASC,
+  CASE WHEN $22::text = 'price_desc' THEN listings.price END DESC,
+  CASE WHEN $22::text = 'distance' THEN m.distance_km END ASC,
+  CASE WHEN $22::text = 'relevance' THEN m.rank END DESC,
+  CASE WHEN $22::text = 'newest' THEN listings.created_at END DESC,
+  CASE WHEN $22::text IN ('price_asc', 'distance') THEN listings.id END ASC,
+  CASE WHEN $22::text NOT IN ('price_asc', 'distance') THEN listings.id END DESC
+LIMIT $26
 `
 
 type GetListingsParams struct {
-	Location     sql.NullString
-	MinPrice     sql.NullInt64
-	MaxPrice     sql.NullInt64
-	PropertyType sql.NullString
-	Offset       int32
-	Limit        int32
+	Location        sql.NullString
+	MinPrice        sql.NullInt64
+	MaxPrice        sql.NullInt64
+	PropertyType    sql.NullString
+	MinBedrooms     sql.NullInt32
+	MinBathrooms    sql.NullInt32
+	Furnishing      sql.NullString
+	Serviced        sql.NullBool
+	RentPeriod      sql.NullString
+	MaxMoveInCost   sql.NullInt64
+	NearLat         sql.NullFloat64
+	NearLng         sql.NullFloat64
+	RadiusKm        sql.NullFloat64
+	MinLat          sql.NullFloat64
+	MinLng          sql.NullFloat64
+	MaxLat          sql.NullFloat64
+	MaxLng          sql.NullFloat64
+	LocationID      uuid.NullUUID
+	Search          sql.NullString
+	RequireDistance bool
+	CursorID        uuid.NullUUID
+	Sort            string
+	CursorPrice     sql.NullInt64
+	CursorScore     sql.NullFloat64
+	CursorCreatedAt sql.NullTime
+	Limit           int32
+}
+
+type GetListingsRow struct {
+	Listing    Listing
+	DistanceKm sql.NullFloat64
+	Rank       sql.NullFloat64
+	Snippet    sql.NullString
 }
 
-func (q *Queries) GetListings(ctx context.Context, arg GetListingsParams) ([]Listing, error) {
+func (q *Queries) GetListings(ctx context.Context, arg GetListingsParams) ([]GetListingsRow, error) {
 	rows, err := q.db.QueryContext(ctx, getListings,
 		arg.Location,
 		arg.MinPrice,
 		arg.MaxPrice,
 		arg.PropertyType,
-		arg.Offset,
+		arg.MinBedrooms,
+		arg.MinBathrooms,
+		arg.Furnishing,
+		arg.Serviced,
+		arg.RentPeriod,
+		arg.MaxMoveInCost,
+		arg.NearLat,
+		arg.NearLng,
+		arg.RadiusKm,
+		arg.MinLat,
+		arg.MinLng,
+		arg.MaxLat,
+		arg.MaxLng,
+		arg.LocationID,
+		arg.Search,
+		arg.RequireDistance,
+		arg.CursorID,
+		arg.Sort,
+		arg.CursorPrice,
+		arg.CursorScore,
+		arg.CursorCreatedAt,
 		arg.Limit,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	var items []GetListingsRow
+	for rows.Next() {
+		var i GetListingsRow
+		if err := rows.Scan(
+			&i.Listing.ID,
+			&i.Listing.AgentID,
+			&i.Listing.Title,
+			&i.Listing.Description,
+			&i.Listing.Price,
+			&i.Listing.Location,
+			&i.Listing.Latitude,
+			&i.Listing.Longtitude,
+			&i.Listing.PropertyType,
+			&i.Listing.Verified,
+			&i.Listing.Images,
+			&i.Listing.Status,
+			&i.Listing.CreatedAt,
+			&i.Listing.Bedrooms,
+			&i.Listing.Bathrooms,
+			&i.Listing.UpdatedAt,
+			&i.Listing.StatusChangedAt,
+			&i.Listing.RentedAt,
+			&i.Listing.Furnishing,
+			&i.Listing.Serviced,
+			&i.Listing.RentPeriod,
+			&i.Listing.AgencyFee,
+			&i.Listing.LegalFee,
+			&i.Listing.CautionFee,
+			&i.Listing.LocationID,
+			&i.Listing.SearchVector,
+			&i.Listing.DeletedAt,
+			&i.DistanceKm,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnlocatedListings = `-- name: GetUnlocatedListings :many
+SELECT id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at, bedrooms, bathrooms, updated_at, status_changed_at, rented_at, furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id, search_vector, deleted_at FROM listings WHERE location_id IS NULL
+`
+
+func (q *Queries) GetUnlocatedListings(ctx context.Context) ([]Listing, error) {
+	rows, err := q.db.QueryContext(ctx, getUnlocatedListings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	var items []Listing
 	for rows.Next() {
 		var i Listing
@@ -139,6 +393,20 @@ func (q *Queries) GetListings(ctx context.Context, arg GetListingsParams) ([]Lis
 			&i.Images,
 			&i.Status,
 			&i.CreatedAt,
+			&i.Bedrooms,
+			&i.Bathrooms,
+			&i.UpdatedAt,
+			&i.StatusChangedAt,
+			&i.RentedAt,
+			&i.Furnishing,
+			&i.Serviced,
+			&i.RentPeriod,
+			&i.AgencyFee,
+			&i.LegalFee,
+			&i.CautionFee,
+			&i.LocationID,
+			&i.SearchVector,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -152,3 +420,122 @@ func (q *Queries) GetListings(ctx context.Context, arg GetListingsParams) ([]Lis
 	}
 	return items, nil
 }
+
+const setListingLocation = `-- name: SetListingLocation :exec
+UPDATE listings SET location_id = $2 WHERE id = $1
+`
+
+type SetListingLocationParams struct {
+	ID         uuid.UUID
+	LocationID uuid.NullUUID
+}
+
+func (q *Queries) SetListingLocation(ctx context.Context, arg SetListingLocationParams) error {
+	_, err := q.db.ExecContext(ctx, setListingLocation, arg.ID, arg.LocationID)
+	return err
+}
+
+const updateListing = `-- name: UpdateListing :one
+UPDATE listings
+SET
+  title = $2,
+  description = $3,
+  price = $4,
+  location = $5,
+  property_type = $6,
+  images = $7,
+  latitude = $8,
+  longtitude = $9,
+  bedrooms = $10,
+  bathrooms = $11,
+  furnishing = $13,
+  serviced = $14,
+  rent_period = $15,
+  agency_fee = $16,
+  legal_fee = $17,
+  caution_fee = $18,
+  location_id = $19,
+  status_changed_at = CASE WHEN status <> $12 THEN CURRENT_TIMESTAMP ELSE status_changed_at END,
+  rented_at = CASE WHEN $12 = 'rented' AND status <> 'rented' THEN CURRENT_TIMESTAMP ELSE rented_at END,
+  status = $12,
+  updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, agent_id, title, description, price, location, latitude, longtitude, property_type, verified, images, status, created_at, bedrooms, bathrooms, updated_at, status_changed_at, rented_at, furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id, search_vector, deleted_at
+`
+
+type UpdateListingParams struct {
+	ID           uuid.UUID
+	Title        string
+	Description  string
+	Price        int64
+	Location     string
+	PropertyType string
+	Images       json.RawMessage
+	Latitude     sql.NullFloat64
+	Longtitude   sql.NullFloat64
+	Bedrooms     sql.NullInt32
+	Bathrooms    sql.NullInt32
+	Status       string
+	Furnishing   string
+	Serviced     bool
+	RentPeriod   string
+	AgencyFee    int64
+	LegalFee     int64
+	CautionFee   int64
+	LocationID   uuid.NullUUID
+}
+
+func (q *Queries) UpdateListing(ctx context.Context, arg UpdateListingParams) (Listing, error) {
+	row := q.db.QueryRowContext(ctx, updateListing,
+		arg.ID,
+		arg.Title,
+		arg.Description,
+		arg.Price,
+		arg.Location,
+		arg.PropertyType,
+		arg.Images,
+		arg.Latitude,
+		arg.Longtitude,
+		arg.Bedrooms,
+		arg.Bathrooms,
+		arg.Status,
+		arg.Furnishing,
+		arg.Serviced,
+		arg.RentPeriod,
+		arg.AgencyFee,
+		arg.LegalFee,
+		arg.CautionFee,
+		arg.LocationID,
+	)
+	var i Listing
+	err := row.Scan(
+		&i.ID,
+		&i.AgentID,
+		&i.Title,
+		&i.Description,
+		&i.Price,
+		&i.Location,
+		&i.Latitude,
+		&i.Longtitude,
+		&i.PropertyType,
+		&i.Verified,
+		&i.Images,
+		&i.Status,
+		&i.CreatedAt,
+		&i.Bedrooms,
+		&i.Bathrooms,
+		&i.UpdatedAt,
+		&i.StatusChangedAt,
+		&i.RentedAt,
+		&i.Furnishing,
+		&i.Serviced,
+		&i.RentPeriod,
+		&i.AgencyFee,
+		&i.LegalFee,
+		&i.CautionFee,
+		&i.LocationID,
+		&i.SearchVector,
+		&i.DeletedAt,
+	)
+	return i, err
+}
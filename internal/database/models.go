@@ -13,13 +13,27 @@ import (
 )
 
 type Alert struct {
-	ID            uuid.UUID
-	UserID        uuid.UUID
-	MinPrice      int64
-	MaxPrice      int64
-	Location      string
-	PropertyType  string
-	ContactMethod string
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	MinPrice        int64
+	MaxPrice        int64
+	PropertyType    string
+	ContactMethod   string
+	Active          bool
+	DisabledReason  sql.NullString
+	Frequency       string
+	ExpiresAt       sql.NullTime
+	Locations       []string
+	Latitude        sql.NullFloat64
+	Longitude       sql.NullFloat64
+	RadiusKm        sql.NullFloat64
+	MinBedrooms     int32
+	MaxBedrooms     int32
+	MinBathrooms    int32
+	MaxBathrooms    int32
+	IncludeKeywords []string
+	ExcludeKeywords []string
+	LocationIDs     []uuid.UUID
 }
 
 type Favorite struct {
@@ -29,31 +43,88 @@ type Favorite struct {
 }
 
 type Listing struct {
-	ID           uuid.UUID
-	AgentID      uuid.UUID
-	Title        string
-	Description  string
-	Price        int64
-	Location     string
-	Latitude     sql.NullFloat64
-	Longtitude   sql.NullFloat64
-	PropertyType string
-	Verified     bool
-	Images       json.RawMessage
-	Status       string
-	CreatedAt    time.Time
+	ID              uuid.UUID
+	AgentID         uuid.UUID
+	Title           string
+	Description     string
+	Price           int64
+	Location        string
+	Latitude        sql.NullFloat64
+	Longtitude      sql.NullFloat64
+	PropertyType    string
+	Verified        bool
+	Images          json.RawMessage
+	Status          string
+	CreatedAt       time.Time
+	Bedrooms        sql.NullInt32
+	Bathrooms       sql.NullInt32
+	UpdatedAt       time.Time
+	StatusChangedAt time.Time
+	RentedAt        sql.NullTime
+	Furnishing      string
+	Serviced        bool
+	RentPeriod      string
+	AgencyFee       int64
+	LegalFee        int64
+	CautionFee      int64
+	LocationID      uuid.NullUUID
+	SearchVector    interface{}
+	DeletedAt       sql.NullTime
 }
 
-type Notification struct {
+type ListingPriceHistory struct {
 	ID            uuid.UUID
-	UserID        uuid.UUID
 	ListingID     uuid.UUID
-	SentAt        time.Time
-	Contact       string
-	ContactMethod string
-	Status        string
-	Subject       string
-	Body          string
+	Price         int64
+	PreviousPrice sql.NullInt64
+	ChangedAt     time.Time
+}
+
+type Location struct {
+	ID         uuid.UUID
+	ParentID   uuid.NullUUID
+	Slug       string
+	Name       string
+	Kind       string
+	Depth      int32
+	Keys       []string
+	SearchText string
+}
+
+type Notification struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	ListingID         uuid.NullUUID
+	SentAt            sql.NullTime
+	Contact           string
+	ContactMethod     string
+	Status            string
+	Subject           string
+	Body              string
+	AlertID           uuid.NullUUID
+	CreatedAt         time.Time
+	Attempts          int32
+	LastError         sql.NullString
+	LastAttemptAt     sql.NullTime
+	ProviderMessageID sql.NullString
+	DeliveredAt       sql.NullTime
+	ReadAt            sql.NullTime
+	Event             string
+	HtmlBody          string
+	DigestID          uuid.NullUUID
+	DeliverAfter      sql.NullTime
+	UnsubscribeUrl    string
+}
+
+type NotificationPreference struct {
+	UserID          uuid.UUID
+	QuietHoursStart string
+	QuietHoursEnd   string
+	Timezone        string
+	ChannelPriority []string
+	Muted           bool
+	DailyCap        int32
+	UpdatedAt       time.Time
 }
 
 type RefreshToken struct {
@@ -7,36 +7,214 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimHeldNotifications = `-- name: ClaimHeldNotifications :many
+SELECT notifications.id, notifications.user_id, notifications.listing_id, notifications.sent_at, notifications.contact, notifications.contact_method, notifications.status, notifications.subject, notifications.body, notifications.alert_id, notifications.created_at, notifications.attempts, notifications.last_error, notifications.last_attempt_at, notifications.provider_message_id, notifications.delivered_at, notifications.read_at, notifications.event, notifications.html_body, notifications.digest_id, notifications.deliver_after, notifications.unsubscribe_url FROM notifications
+JOIN alerts ON alerts.id = notifications.alert_id
+WHERE notifications.status = 'held'
+  AND alerts.frequency = $1
+  AND notifications.created_at < $2
+  AND alerts.active
+  AND (alerts.expires_at IS NULL OR alerts.expires_at > CURRENT_TIMESTAMP)
+ORDER BY notifications.user_id, notifications.created_at
+FOR UPDATE OF notifications SKIP LOCKED
+`
+
+type ClaimHeldNotificationsParams struct {
+	Frequency string
+	Before    time.Time
+}
+
+func (q *Queries) ClaimHeldNotifications(ctx context.Context, arg ClaimHeldNotificationsParams) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, claimHeldNotifications, arg.Frequency, arg.Before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		var i Notification
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ListingID,
+			&i.SentAt,
+			&i.Contact,
+			&i.ContactMethod,
+			&i.Status,
+			&i.Subject,
+			&i.Body,
+			&i.AlertID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.LastAttemptAt,
+			&i.ProviderMessageID,
+			&i.DeliveredAt,
+			&i.ReadAt,
+			&i.Event,
+			&i.HtmlBody,
+			&i.DigestID,
+			&i.DeliverAfter,
+			&i.UnsubscribeUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimPendingNotifications = `-- name: ClaimPendingNotifications :many
+SELECT id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body, alert_id, created_at, attempts, last_error, last_attempt_at, provider_message_id, delivered_at, read_at, event, html_body, digest_id, deliver_after, unsubscribe_url FROM notifications
+WHERE status = 'pending'
+  AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1::float8)
+  AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+ORDER BY created_at
+LIMIT $2
+FOR UPDATE SKIP LOCKED
+`
+
+type ClaimPendingNotificationsParams struct {
+	MinAgeSeconds float64
+	BatchSize     int32
+}
+
+func (q *Queries) ClaimPendingNotifications(ctx context.Context, arg ClaimPendingNotificationsParams) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingNotifications, arg.MinAgeSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		var i Notification
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ListingID,
+			&i.SentAt,
+			&i.Contact,
+			&i.ContactMethod,
+			&i.Status,
+			&i.Subject,
+			&i.Body,
+			&i.AlertID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.LastAttemptAt,
+			&i.ProviderMessageID,
+			&i.DeliveredAt,
+			&i.ReadAt,
+			&i.Event,
+			&i.HtmlBody,
+			&i.DigestID,
+			&i.DeliverAfter,
+			&i.UnsubscribeUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countNotificationsSentSince = `-- name: CountNotificationsSentSince :one
+SELECT count(*) FROM notifications
+WHERE user_id = $1
+  AND status IN ('sent', 'delivered', 'read', 'bounced')
+  AND sent_at >= CURRENT_TIMESTAMP - make_interval(secs => $2::float8)
+`
+
+type CountNotificationsSentSinceParams struct {
+	UserID       uuid.UUID
+	SinceSeconds float64
+}
+
+func (q *Queries) CountNotificationsSentSince(ctx context.Context, arg CountNotificationsSentSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countNotificationsSentSince, arg.UserID, arg.SinceSeconds)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRecentUndeliverableNotifications = `-- name: CountRecentUndeliverableNotifications :one
+SELECT count(*) FROM (
+  SELECT status FROM notifications
+  WHERE alert_id = $1
+    AND status IN ('sent', 'delivered', 'read', 'bounced', 'failed')
+  ORDER BY created_at DESC
+  LIMIT $2
+) recent
+WHERE status IN ('bounced', 'failed')
+`
+
+type CountRecentUndeliverableNotificationsParams struct {
+	AlertID uuid.NullUUID
+	Recent  int32
+}
+
+func (q *Queries) CountRecentUndeliverableNotifications(ctx context.Context, arg CountRecentUndeliverableNotificationsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countRecentUndeliverableNotifications, arg.AlertID, arg.Recent)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createNotification = `-- name: CreateNotification :one
 INSERT INTO notifications (
-user_id, listing_id,
-sent_at, contact, contact_method, status  )
-VALUES ( $1, $2, $3, $4, $5,$6)
-RETURNING id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body
+user_id, listing_id, alert_id,
+contact, contact_method, status, subject, body, event, html_body, unsubscribe_url  )
+VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body, alert_id, created_at, attempts, last_error, last_attempt_at, provider_message_id, delivered_at, read_at, event, html_body, digest_id, deliver_after, unsubscribe_url
 `
 
 type CreateNotificationParams struct {
-	UserID        uuid.UUID
-	ListingID     uuid.UUID
-	SentAt        time.Time
-	Contact       string
-	ContactMethod string
-	Status        string
+	UserID         uuid.UUID
+	ListingID      uuid.NullUUID
+	AlertID        uuid.NullUUID
+	Contact        string
+	ContactMethod  string
+	Status         string
+	Subject        string
+	Body           string
+	Event          string
+	HtmlBody       string
+	UnsubscribeUrl string
 }
 
 func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotificationParams) (Notification, error) {
 	row := q.db.QueryRowContext(ctx, createNotification,
 		arg.UserID,
 		arg.ListingID,
-		arg.SentAt,
+		arg.AlertID,
 		arg.Contact,
 		arg.ContactMethod,
 		arg.Status,
+		arg.Subject,
+		arg.Body,
+		arg.Event,
+		arg.HtmlBody,
+		arg.UnsubscribeUrl,
 	)
 	var i Notification
 	err := row.Scan(
@@ -49,13 +227,192 @@ func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotification
 		&i.Status,
 		&i.Subject,
 		&i.Body,
+		&i.AlertID,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.LastAttemptAt,
+		&i.ProviderMessageID,
+		&i.DeliveredAt,
+		&i.ReadAt,
+		&i.Event,
+		&i.HtmlBody,
+		&i.DigestID,
+		&i.DeliverAfter,
+		&i.UnsubscribeUrl,
+	)
+	return i, err
+}
+
+const deferNotification = `-- name: DeferNotification :exec
+UPDATE notifications
+SET
+  status = 'pending',
+  deliver_after = CURRENT_TIMESTAMP + make_interval(secs => $1::float8),
+  last_error = $2
+WHERE id = $3
+`
+
+type DeferNotificationParams struct {
+	DelaySeconds float64
+	LastError    sql.NullString
+	ID           uuid.UUID
+}
+
+func (q *Queries) DeferNotification(ctx context.Context, arg DeferNotificationParams) error {
+	_, err := q.db.ExecContext(ctx, deferNotification, arg.DelaySeconds, arg.LastError, arg.ID)
+	return err
+}
+
+const getDigestFrequency = `-- name: GetDigestFrequency :one
+SELECT alerts.frequency FROM notifications
+JOIN alerts ON alerts.id = notifications.alert_id
+WHERE notifications.digest_id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetDigestFrequency(ctx context.Context, digestID uuid.NullUUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getDigestFrequency, digestID)
+	var frequency string
+	err := row.Scan(&frequency)
+	return frequency, err
+}
+
+const getDigestListings = `-- name: GetDigestListings :many
+SELECT listings.id, listings.agent_id, listings.title, listings.description, listings.price, listings.location, listings.latitude, listings.longtitude, listings.property_type, listings.verified, listings.images, listings.status, listings.created_at, listings.bedrooms, listings.bathrooms, listings.updated_at, listings.status_changed_at, listings.rented_at, listings.furnishing, listings.serviced, listings.rent_period, listings.agency_fee, listings.legal_fee, listings.caution_fee, listings.location_id, listings.search_vector, listings.deleted_at FROM notifications
+JOIN listings ON listings.id = notifications.listing_id
+WHERE notifications.digest_id = $1
+ORDER BY notifications.created_at
+`
+
+func (q *Queries) GetDigestListings(ctx context.Context, digestID uuid.NullUUID) ([]Listing, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestListings, digestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Listing
+	for rows.Next() {
+		var i Listing
+		if err := rows.Scan(
+			&i.ID,
+			&i.AgentID,
+			&i.Title,
+			&i.Description,
+			&i.Price,
+			&i.Location,
+			&i.Latitude,
+			&i.Longtitude,
+			&i.PropertyType,
+			&i.Verified,
+			&i.Images,
+			&i.Status,
+			&i.CreatedAt,
+			&i.Bedrooms,
+			&i.Bathrooms,
+			&i.UpdatedAt,
+			&i.StatusChangedAt,
+			&i.RentedAt,
+			&i.Furnishing,
+			&i.Serviced,
+			&i.RentPeriod,
+			&i.AgencyFee,
+			&i.LegalFee,
+			&i.CautionFee,
+			&i.LocationID,
+			&i.SearchVector,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotification = `-- name: GetNotification :one
+SELECT id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body, alert_id, created_at, attempts, last_error, last_attempt_at, provider_message_id, delivered_at, read_at, event, html_body, digest_id, deliver_after, unsubscribe_url FROM notifications WHERE $1=id
+`
+
+func (q *Queries) GetNotification(ctx context.Context, id uuid.UUID) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, getNotification, id)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ListingID,
+		&i.SentAt,
+		&i.Contact,
+		&i.ContactMethod,
+		&i.Status,
+		&i.Subject,
+		&i.Body,
+		&i.AlertID,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.LastAttemptAt,
+		&i.ProviderMessageID,
+		&i.DeliveredAt,
+		&i.ReadAt,
+		&i.Event,
+		&i.HtmlBody,
+		&i.DigestID,
+		&i.DeliverAfter,
+		&i.UnsubscribeUrl,
+	)
+	return i, err
+}
+
+const getNotificationByProviderMessageID = `-- name: GetNotificationByProviderMessageID :one
+SELECT id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body, alert_id, created_at, attempts, last_error, last_attempt_at, provider_message_id, delivered_at, read_at, event, html_body, digest_id, deliver_after, unsubscribe_url FROM notifications
+WHERE contact_method = $1 AND provider_message_id = $2
+`
+
+type GetNotificationByProviderMessageIDParams struct {
+	ContactMethod     string
+	ProviderMessageID sql.NullString
+}
+
+func (q *Queries) GetNotificationByProviderMessageID(ctx context.Context, arg GetNotificationByProviderMessageIDParams) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, getNotificationByProviderMessageID, arg.ContactMethod, arg.ProviderMessageID)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ListingID,
+		&i.SentAt,
+		&i.Contact,
+		&i.ContactMethod,
+		&i.Status,
+		&i.Subject,
+		&i.Body,
+		&i.AlertID,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.LastAttemptAt,
+		&i.ProviderMessageID,
+		&i.DeliveredAt,
+		&i.ReadAt,
+		&i.Event,
+		&i.HtmlBody,
+		&i.DigestID,
+		&i.DeliverAfter,
+		&i.UnsubscribeUrl,
 	)
 	return i, err
 }
 
 const getUnsentNotifications = `-- name: GetUnsentNotifications :many
-SELECT id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body FROM notifications
-WHERE status="pending"
+SELECT id, user_id, listing_id, sent_at, contact, contact_method, status, subject, body, alert_id, created_at, attempts, last_error, last_attempt_at, provider_message_id, delivered_at, read_at, event, html_body, digest_id, deliver_after, unsubscribe_url FROM notifications
+WHERE status = 'pending'
 `
 
 func (q *Queries) GetUnsentNotifications(ctx context.Context) ([]Notification, error) {
@@ -77,6 +434,19 @@ func (q *Queries) GetUnsentNotifications(ctx context.Context) ([]Notification, e
 			&i.Status,
 			&i.Subject,
 			&i.Body,
+			&i.AlertID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.LastAttemptAt,
+			&i.ProviderMessageID,
+			&i.DeliveredAt,
+			&i.ReadAt,
+			&i.Event,
+			&i.HtmlBody,
+			&i.DigestID,
+			&i.DeliverAfter,
+			&i.UnsubscribeUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -90,3 +460,225 @@ func (q *Queries) GetUnsentNotifications(ctx context.Context) ([]Notification, e
 	}
 	return items, nil
 }
+
+const markNotificationAttemptFailed = `-- name: MarkNotificationAttemptFailed :exec
+UPDATE notifications
+SET
+  status = $2,
+  attempts = attempts + 1,
+  last_error = $3,
+  last_attempt_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type MarkNotificationAttemptFailedParams struct {
+	ID        uuid.UUID
+	Status    string
+	LastError sql.NullString
+}
+
+func (q *Queries) MarkNotificationAttemptFailed(ctx context.Context, arg MarkNotificationAttemptFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markNotificationAttemptFailed, arg.ID, arg.Status, arg.LastError)
+	return err
+}
+
+const markNotificationEnqueued = `-- name: MarkNotificationEnqueued :exec
+UPDATE notifications
+SET status = 'enqueued'
+WHERE id = $1 AND status = 'pending'
+  AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) MarkNotificationEnqueued(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markNotificationEnqueued, id)
+	return err
+}
+
+const markNotificationSent = `-- name: MarkNotificationSent :exec
+UPDATE notifications
+SET
+  status = 'sent',
+  attempts = attempts + 1,
+  last_error = NULL,
+  last_attempt_at = CURRENT_TIMESTAMP,
+  sent_at = CURRENT_TIMESTAMP,
+  provider_message_id = $2
+WHERE id = $1
+`
+
+type MarkNotificationSentParams struct {
+	ID                uuid.UUID
+	ProviderMessageID sql.NullString
+}
+
+func (q *Queries) MarkNotificationSent(ctx context.Context, arg MarkNotificationSentParams) error {
+	_, err := q.db.ExecContext(ctx, markNotificationSent, arg.ID, arg.ProviderMessageID)
+	return err
+}
+
+const markNotificationSuppressed = `-- name: MarkNotificationSuppressed :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE id = $1
+`
+
+type MarkNotificationSuppressedParams struct {
+	ID        uuid.UUID
+	LastError sql.NullString
+}
+
+func (q *Queries) MarkNotificationSuppressed(ctx context.Context, arg MarkNotificationSuppressedParams) error {
+	_, err := q.db.ExecContext(ctx, markNotificationSuppressed, arg.ID, arg.LastError)
+	return err
+}
+
+const markNotificationsDigested = `-- name: MarkNotificationsDigested :exec
+UPDATE notifications
+SET status = 'digested', digest_id = $1
+WHERE id = ANY($2::uuid[])
+`
+
+type MarkNotificationsDigestedParams struct {
+	DigestID uuid.NullUUID
+	Ids      []uuid.UUID
+}
+
+func (q *Queries) MarkNotificationsDigested(ctx context.Context, arg MarkNotificationsDigestedParams) error {
+	_, err := q.db.ExecContext(ctx, markNotificationsDigested, arg.DigestID, pq.Array(arg.Ids))
+	return err
+}
+
+const retryNotificationLater = `-- name: RetryNotificationLater :exec
+UPDATE notifications
+SET
+  status = 'pending',
+  attempts = attempts + 1,
+  deliver_after = CURRENT_TIMESTAMP + make_interval(secs => $1::float8),
+  last_error = $2,
+  last_attempt_at = CURRENT_TIMESTAMP
+WHERE id = $3
+`
+
+type RetryNotificationLaterParams struct {
+	DelaySeconds float64
+	LastError    sql.NullString
+	ID           uuid.UUID
+}
+
+func (q *Queries) RetryNotificationLater(ctx context.Context, arg RetryNotificationLaterParams) error {
+	_, err := q.db.ExecContext(ctx, retryNotificationLater, arg.DelaySeconds, arg.LastError, arg.ID)
+	return err
+}
+
+const suppressHeldAlertNotifications = `-- name: SuppressHeldAlertNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE alert_id = $1 AND status = 'held'
+`
+
+type SuppressHeldAlertNotificationsParams struct {
+	AlertID   uuid.NullUUID
+	LastError sql.NullString
+}
+
+func (q *Queries) SuppressHeldAlertNotifications(ctx context.Context, arg SuppressHeldAlertNotificationsParams) error {
+	_, err := q.db.ExecContext(ctx, suppressHeldAlertNotifications, arg.AlertID, arg.LastError)
+	return err
+}
+
+const suppressInactiveHeldNotifications = `-- name: SuppressInactiveHeldNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = 'alert paused, disabled or expired'
+FROM alerts
+WHERE alerts.id = notifications.alert_id
+  AND notifications.status = 'held'
+  AND (NOT alerts.active OR alerts.expires_at <= CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) SuppressInactiveHeldNotifications(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, suppressInactiveHeldNotifications)
+	return err
+}
+
+const suppressListingNotifications = `-- name: SuppressListingNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE listing_id = $1 AND status IN ('pending', 'held')
+`
+
+type SuppressListingNotificationsParams struct {
+	ListingID uuid.NullUUID
+	LastError sql.NullString
+}
+
+func (q *Queries) SuppressListingNotifications(ctx context.Context, arg SuppressListingNotificationsParams) error {
+	_, err := q.db.ExecContext(ctx, suppressListingNotifications, arg.ListingID, arg.LastError)
+	return err
+}
+
+const updateNotificationChannel = `-- name: UpdateNotificationChannel :exec
+UPDATE notifications
+SET
+  contact_method = $2,
+  contact = $3,
+  subject = $4,
+  body = $5,
+  html_body = $6
+WHERE id = $1
+`
+
+type UpdateNotificationChannelParams struct {
+	ID            uuid.UUID
+	ContactMethod string
+	Contact       string
+	Subject       string
+	Body          string
+	HtmlBody      string
+}
+
+func (q *Queries) UpdateNotificationChannel(ctx context.Context, arg UpdateNotificationChannelParams) error {
+	_, err := q.db.ExecContext(ctx, updateNotificationChannel,
+		arg.ID,
+		arg.ContactMethod,
+		arg.Contact,
+		arg.Subject,
+		arg.Body,
+		arg.HtmlBody,
+	)
+	return err
+}
+
+const updateNotificationDeliveryStatus = `-- name: UpdateNotificationDeliveryStatus :exec
+UPDATE notifications
+SET
+  status = $1,
+  last_error = COALESCE($2, last_error),
+  delivered_at = CASE
+    WHEN $1 IN ('delivered', 'read') THEN COALESCE(delivered_at, CURRENT_TIMESTAMP)
+    ELSE delivered_at
+  END,
+  read_at = CASE
+    WHEN $1 = 'read' THEN COALESCE(read_at, CURRENT_TIMESTAMP)
+    ELSE read_at
+  END
+WHERE id = $3
+`
+
+type UpdateNotificationDeliveryStatusParams struct {
+	Status    string
+	LastError sql.NullString
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateNotificationDeliveryStatus(ctx context.Context, arg UpdateNotificationDeliveryStatusParams) error {
+	_, err := q.db.ExecContext(ctx, updateNotificationDeliveryStatus, arg.Status, arg.LastError, arg.ID)
+	return err
+}
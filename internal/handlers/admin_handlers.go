@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// ---------- List Dead-Lettered Notifications ----------
+func (apiConfig *Config) GetDeadLettersHandler(w http.ResponseWriter, r *http.Request, user User) {
+	if apiConfig.Publisher == nil {
+		helpers.RespondWithError(w, http.StatusServiceUnavailable, "notification pipeline not configured")
+		return
+	}
+	deadLetters, err := apiConfig.Publisher.DeadLetters(r.Context())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting dead letters. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, deadLetters)
+}
+
+// ---------- Replay Dead-Lettered Notification ----------
+func (apiConfig *Config) ReplayDeadLetterHandler(w http.ResponseWriter, r *http.Request, user User) {
+	if apiConfig.Publisher == nil {
+		helpers.RespondWithError(w, http.StatusServiceUnavailable, "notification pipeline not configured")
+		return
+	}
+	id := chi.URLParam(r, "ID")
+	err := apiConfig.Publisher.ReplayDeadLetter(r.Context(), id)
+	if errors.Is(err, notification.ErrMessageNotFound) {
+		helpers.RespondWithError(w, http.StatusNotFound, "no dead-lettered notification with this id")
+		return
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error replaying dead letter. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, "dead letter replayed")
+}
+
+// ---------- Preview Notification Template ----------
+// Renders the event's template for a channel. Sample data is used unless
+// listing_id (and optionally alert_id) query params point at real rows.
+func (apiConfig *Config) PreviewTemplateHandler(w http.ResponseWriter, r *http.Request, user User) {
+	event := chi.URLParam(r, "event")
+	channel := chi.URLParam(r, "channel")
+	data := notification.SampleTemplateData(event)
+
+	if listingID := r.URL.Query().Get("listing_id"); listingID != "" {
+		id, err := uuid.Parse(listingID)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error parsing listing_id. err: %v", err))
+			return
+		}
+		listing, err := apiConfig.DB.GetListing(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.RespondWithError(w, http.StatusNotFound, "listing not found")
+			return
+		}
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting listing. err: %v", err))
+			return
+		}
+		sample := data
+		if event == notification.EventDigest {
+			data = notification.NewDigestTemplateData([]database.Listing{listing}, sample.Frequency, apiConfig.ListingBaseURL)
+		} else {
+			data = notification.NewTemplateData(listing, sample.Alert, apiConfig.ListingBaseURL)
+			data.OldPrice = sample.OldPrice
+		}
+		data.UnsubscribeURL = sample.UnsubscribeURL
+	}
+	if alertID := r.URL.Query().Get("alert_id"); alertID != "" {
+		id, err := uuid.Parse(alertID)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error parsing alert_id. err: %v", err))
+			return
+		}
+		alert, err := apiConfig.DB.GetAlert(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.RespondWithError(w, http.StatusNotFound, "alert not found")
+			return
+		}
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting alert. err: %v", err))
+			return
+		}
+		data.Alert = alert
+	}
+
+	content, err := notification.RenderNotification(event, channel, data)
+	if errors.Is(err, notification.ErrTemplateNotFound) {
+		helpers.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("no %s template for %s", event, channel))
+		return
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error rendering template. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, content)
+}
@@ -2,51 +2,130 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/muhammadolammi/rentradar/internal/database"
 	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 // ---------- Create Alert ----------
+// location is still accepted for a single location and is added to locations.
+// The locations that name a known place are added to location_ids, so the
+// alert matches listings anywhere inside them.
 func (apiConfig *Config) PostAlertsHandler(w http.ResponseWriter, r *http.Request, user User) {
 
 	body := struct {
-		MinPrice      int64  `json:"min_price"`
-		MaxPrice      int64  `json:"max_price"`
-		Location      string `json:"location"`
-		PropertyType  string `json:"property_type"`
-		ContactMethod string `json:"contact_method"`
+		MinPrice      int64    `json:"min_price"`
+		MaxPrice      int64    `json:"max_price"`
+		Location      string   `json:"location"`
+		Locations     []string `json:"locations"`
+		PropertyType  string   `json:"property_type"`
+		ContactMethod string   `json:"contact_method"`
+		// instant, hourly or daily; defaults to instant
+		Frequency string `json:"frequency"`
+		// RFC 3339 time the alert stops matching at; empty never expires
+		ExpiresAt string `json:"expires_at"`
+		// radius_km around latitude and longitude
+		Latitude        *float64    `json:"latitude"`
+		Longitude       *float64    `json:"longitude"`
+		RadiusKm        *float64    `json:"radius_km"`
+		MinBedrooms     int32       `json:"min_bedrooms"`
+		MaxBedrooms     int32       `json:"max_bedrooms"`
+		MinBathrooms    int32       `json:"min_bathrooms"`
+		MaxBathrooms    int32       `json:"max_bathrooms"`
+		IncludeKeywords []string    `json:"include_keywords"`
+		ExcludeKeywords []string    `json:"exclude_keywords"`
+		LocationIDs     []uuid.UUID `json:"location_ids"`
 	}{}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		helpers.RespondWithError(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
-	if body.MinPrice == 0 {
-		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the min_price.")
-		return
+	if body.Frequency == "" {
+		body.Frequency = notification.FrequencyInstant
 	}
-	if body.MaxPrice == 0 {
-		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the max_price.")
-		return
+	expiresAt, expiryErr := parseAlertExpiry(body.ExpiresAt)
+
+	alert := database.Alert{
+		UserID:          user.ID,
+		MinPrice:        body.MinPrice,
+		MaxPrice:        body.MaxPrice,
+		Locations:       cleanList(append(body.Locations, body.Location)),
+		PropertyType:    strings.TrimSpace(body.PropertyType),
+		ContactMethod:   strings.ToLower(strings.TrimSpace(body.ContactMethod)),
+		Frequency:       body.Frequency,
+		ExpiresAt:       expiresAt,
+		Latitude:        nullFloat(body.Latitude),
+		Longitude:       nullFloat(body.Longitude),
+		RadiusKm:        nullFloat(body.RadiusKm),
+		MinBedrooms:     body.MinBedrooms,
+		MaxBedrooms:     body.MaxBedrooms,
+		MinBathrooms:    body.MinBathrooms,
+		MaxBathrooms:    body.MaxBathrooms,
+		IncludeKeywords: cleanList(body.IncludeKeywords),
+		ExcludeKeywords: cleanList(body.ExcludeKeywords),
+		LocationIDs:     body.LocationIDs,
+	}
+	fields := validateAlert(alert, user, apiConfig.Channels)
+	if expiryErr != nil {
+		fields["expires_at"] = expiryErr.Error()
 	}
-	if body.Location == "" {
-		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the location.")
+	locationIDs, msg, err := apiConfig.alertLocationIDs(r.Context(), alert.Locations, alert.LocationIDs)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if body.ContactMethod == "" {
-		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the contact method.")
+	if msg != "" {
+		fields["location_ids"] = msg
+	}
+	if len(fields) > 0 {
+		helpers.RespondWithFieldErrors(w, fields)
 		return
 	}
 
-	alert, err := apiConfig.DB.CreateAlert(context.Background(), database.CreateAlertParams{
-		UserID:        user.ID,
-		MinPrice:      body.MinPrice,
-		MaxPrice:      body.MaxPrice,
-		Location:      body.Location,
-		PropertyType:  body.PropertyType,
-		ContactMethod: body.ContactMethod,
+	if apiConfig.MaxAlertsPerUser > 0 {
+		count, err := apiConfig.DB.CountUserAlerts(r.Context(), user.ID)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error counting user alerts. err: %v", err))
+			return
+		}
+		if count >= int64(apiConfig.MaxAlertsPerUser) {
+			helpers.RespondWithError(w, http.StatusForbidden, fmt.Sprintf("You can have at most %d alerts. Delete one to add another.", apiConfig.MaxAlertsPerUser))
+			return
+		}
+	}
+
+	alert, err = apiConfig.DB.CreateAlert(context.Background(), database.CreateAlertParams{
+		UserID:          alert.UserID,
+		MinPrice:        alert.MinPrice,
+		MaxPrice:        alert.MaxPrice,
+		Locations:       alert.Locations,
+		PropertyType:    alert.PropertyType,
+		ContactMethod:   alert.ContactMethod,
+		Frequency:       alert.Frequency,
+		ExpiresAt:       alert.ExpiresAt,
+		Latitude:        alert.Latitude,
+		Longitude:       alert.Longitude,
+		RadiusKm:        alert.RadiusKm,
+		MinBedrooms:     alert.MinBedrooms,
+		MaxBedrooms:     alert.MaxBedrooms,
+		MinBathrooms:    alert.MinBathrooms,
+		MaxBathrooms:    alert.MaxBathrooms,
+		IncludeKeywords: alert.IncludeKeywords,
+		ExcludeKeywords: alert.ExcludeKeywords,
+		LocationIDs:     locationIDs,
 	})
 
 	if err != nil {
@@ -68,3 +147,352 @@ func (apiConfig *Config) GetAlertsHandler(w http.ResponseWriter, r *http.Request
 
 	helpers.RespondWithJson(w, http.StatusOK, alerts)
 }
+
+// ---------- Get Alert ----------
+func (apiConfig *Config) GetAlertHandler(w http.ResponseWriter, r *http.Request, user User) {
+	alert, ok := apiConfig.getUserAlert(w, r, user)
+	if !ok {
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, alert)
+}
+
+// ---------- Update Alert ----------
+// Fields left out of the body keep their current value. active=false pauses
+// the alert and active=true resumes it, also after it was disabled for
+// bounces or an unsubscribe. An empty expires_at removes the expiry and a
+// radius_km of 0 removes the radius.
+func (apiConfig *Config) PatchAlertHandler(w http.ResponseWriter, r *http.Request, user User) {
+	body := struct {
+		MinPrice        *int64       `json:"min_price"`
+		MaxPrice        *int64       `json:"max_price"`
+		Locations       *[]string    `json:"locations"`
+		PropertyType    *string      `json:"property_type"`
+		ContactMethod   *string      `json:"contact_method"`
+		Frequency       *string      `json:"frequency"`
+		Active          *bool        `json:"active"`
+		ExpiresAt       *string      `json:"expires_at"`
+		Latitude        *float64     `json:"latitude"`
+		Longitude       *float64     `json:"longitude"`
+		RadiusKm        *float64     `json:"radius_km"`
+		MinBedrooms     *int32       `json:"min_bedrooms"`
+		MaxBedrooms     *int32       `json:"max_bedrooms"`
+		MinBathrooms    *int32       `json:"min_bathrooms"`
+		MaxBathrooms    *int32       `json:"max_bathrooms"`
+		IncludeKeywords *[]string    `json:"include_keywords"`
+		ExcludeKeywords *[]string    `json:"exclude_keywords"`
+		LocationIDs     *[]uuid.UUID `json:"location_ids"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	alert, ok := apiConfig.getUserAlert(w, r, user)
+	if !ok {
+		return
+	}
+
+	if body.MinPrice != nil {
+		alert.MinPrice = *body.MinPrice
+	}
+	if body.MaxPrice != nil {
+		alert.MaxPrice = *body.MaxPrice
+	}
+	if body.Locations != nil {
+		alert.Locations = cleanList(*body.Locations)
+	}
+	if body.PropertyType != nil {
+		alert.PropertyType = strings.TrimSpace(*body.PropertyType)
+	}
+	if body.ContactMethod != nil {
+		alert.ContactMethod = strings.ToLower(strings.TrimSpace(*body.ContactMethod))
+	}
+	if body.Frequency != nil {
+		alert.Frequency = *body.Frequency
+	}
+	if body.Active != nil {
+		alert.Active = *body.Active
+		alert.DisabledReason = sql.NullString{}
+		if !alert.Active {
+			alert.DisabledReason = sql.NullString{Valid: true, String: "paused"}
+		}
+	}
+	var expiryErr error
+	if body.ExpiresAt != nil {
+		alert.ExpiresAt, expiryErr = parseAlertExpiry(*body.ExpiresAt)
+	}
+	if body.Latitude != nil {
+		alert.Latitude = nullFloat(body.Latitude)
+	}
+	if body.Longitude != nil {
+		alert.Longitude = nullFloat(body.Longitude)
+	}
+	if body.RadiusKm != nil {
+		alert.RadiusKm = nullFloat(body.RadiusKm)
+		if *body.RadiusKm == 0 {
+			alert.Latitude, alert.Longitude, alert.RadiusKm = sql.NullFloat64{}, sql.NullFloat64{}, sql.NullFloat64{}
+		}
+	}
+	if body.MinBedrooms != nil {
+		alert.MinBedrooms = *body.MinBedrooms
+	}
+	if body.MaxBedrooms != nil {
+		alert.MaxBedrooms = *body.MaxBedrooms
+	}
+	if body.MinBathrooms != nil {
+		alert.MinBathrooms = *body.MinBathrooms
+	}
+	if body.MaxBathrooms != nil {
+		alert.MaxBathrooms = *body.MaxBathrooms
+	}
+	if body.IncludeKeywords != nil {
+		alert.IncludeKeywords = cleanList(*body.IncludeKeywords)
+	}
+	if body.ExcludeKeywords != nil {
+		alert.ExcludeKeywords = cleanList(*body.ExcludeKeywords)
+	}
+	// location_ids are worked out again from locations when either changes
+	relocated := body.Locations != nil || body.LocationIDs != nil
+	if relocated {
+		alert.LocationIDs = []uuid.UUID{}
+		if body.LocationIDs != nil {
+			alert.LocationIDs = *body.LocationIDs
+		}
+	}
+	fields := validateAlert(alert, user, apiConfig.Channels)
+	if expiryErr != nil {
+		fields["expires_at"] = expiryErr.Error()
+	}
+	if relocated {
+		locationIDs, msg, err := apiConfig.alertLocationIDs(r.Context(), alert.Locations, alert.LocationIDs)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if msg != "" {
+			fields["location_ids"] = msg
+		}
+		alert.LocationIDs = locationIDs
+	}
+	if len(fields) > 0 {
+		helpers.RespondWithFieldErrors(w, fields)
+		return
+	}
+
+	updated, err := apiConfig.DB.UpdateAlert(r.Context(), database.UpdateAlertParams{
+		ID:              alert.ID,
+		MinPrice:        alert.MinPrice,
+		MaxPrice:        alert.MaxPrice,
+		Locations:       alert.Locations,
+		PropertyType:    alert.PropertyType,
+		ContactMethod:   alert.ContactMethod,
+		Frequency:       alert.Frequency,
+		Active:          alert.Active,
+		DisabledReason:  alert.DisabledReason,
+		ExpiresAt:       alert.ExpiresAt,
+		Latitude:        alert.Latitude,
+		Longitude:       alert.Longitude,
+		RadiusKm:        alert.RadiusKm,
+		MinBedrooms:     alert.MinBedrooms,
+		MaxBedrooms:     alert.MaxBedrooms,
+		MinBathrooms:    alert.MinBathrooms,
+		MaxBathrooms:    alert.MaxBathrooms,
+		IncludeKeywords: alert.IncludeKeywords,
+		ExcludeKeywords: alert.ExcludeKeywords,
+		LocationIDs:     alert.LocationIDs,
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating alert. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, updated)
+}
+
+// ---------- Delete Alert ----------
+// Matches still held for the alert's next digest are suppressed, since the
+// digest scheduler only picks up held matches whose alert exists.
+func (apiConfig *Config) DeleteAlertHandler(w http.ResponseWriter, r *http.Request, user User) {
+	alert, ok := apiConfig.getUserAlert(w, r, user)
+	if !ok {
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting alert. err: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiConfig.DB.WithTx(tx)
+
+	err = qtx.SuppressHeldAlertNotifications(r.Context(), database.SuppressHeldAlertNotificationsParams{
+		AlertID:   uuid.NullUUID{UUID: alert.ID, Valid: true},
+		LastError: sql.NullString{Valid: true, String: "alert deleted"},
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error suppressing held notifications. err: %v", err))
+		return
+	}
+	if err := qtx.DeleteAlert(r.Context(), alert.ID); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting alert. err: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting alert. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, "alert deleted")
+}
+
+// getUserAlert loads the alert in the url. It responds and returns false when
+// the alert doesn't exist or belongs to another user.
+func (apiConfig *Config) getUserAlert(w http.ResponseWriter, r *http.Request, user User) (database.Alert, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "ID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid alert id")
+		return database.Alert{}, false
+	}
+	alert, err := apiConfig.DB.GetAlert(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && alert.UserID != user.ID) {
+		helpers.RespondWithError(w, http.StatusNotFound, "alert not found")
+		return database.Alert{}, false
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting alert. err: %v", err))
+		return database.Alert{}, false
+	}
+	return alert, true
+}
+
+// parseAlertExpiry parses an RFC 3339 expiry, which has to be in the future.
+// An empty value means the alert never expires.
+func parseAlertExpiry(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, errors.New("Enter expires_at as an RFC 3339 time, e.g. 2026-01-31T00:00:00Z.")
+	}
+	if !expiresAt.After(time.Now()) {
+		return sql.NullTime{}, errors.New("Enter an expires_at in the future.")
+	}
+	return sql.NullTime{Valid: true, Time: expiresAt.UTC()}, nil
+}
+
+// alertLocationIDs checks every id is a known location and adds the ids of the
+// locations that resolve to one. It returns a message for the location_ids
+// field when an id is unknown.
+func (apiConfig *Config) alertLocationIDs(ctx context.Context, texts []string, ids []uuid.UUID) ([]uuid.UUID, string, error) {
+	locationIDs := []uuid.UUID{}
+	for _, id := range ids {
+		_, err := apiConfig.DB.GetLocation(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Sprintf("%s isn't a known location.", id), nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error getting location. err: %v", err)
+		}
+		if !slices.Contains(locationIDs, id) {
+			locationIDs = append(locationIDs, id)
+		}
+	}
+	resolved, err := locations.ResolveAll(ctx, apiConfig.DB, texts)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, id := range resolved {
+		if !slices.Contains(locationIDs, id) {
+			locationIDs = append(locationIDs, id)
+		}
+	}
+	return locationIDs, "", nil
+}
+
+// validateAlert returns a message for each invalid field of the alert, keyed
+// by its json name. The contact method must be one of channels, those with a
+// sender configured, and SMS and WhatsApp alerts need the user to have a
+// phone number.
+func validateAlert(alert database.Alert, user User, channels []string) map[string]string {
+	fields := map[string]string{}
+	if alert.MinPrice <= 0 {
+		fields["min_price"] = "Enter a min_price greater than 0."
+	}
+	if alert.MaxPrice <= 0 {
+		fields["max_price"] = "Enter a max_price greater than 0."
+	} else if alert.MinPrice > alert.MaxPrice {
+		fields["max_price"] = "Enter a max_price of at least the min_price."
+	}
+	if len(alert.Locations) == 0 && len(alert.LocationIDs) == 0 && !alert.RadiusKm.Valid {
+		fields["locations"] = "Enter the locations, or a radius_km around a latitude and longitude."
+	}
+	if alert.PropertyType == "" {
+		fields["property_type"] = "Enter the property_type."
+	}
+
+	switch {
+	case alert.ContactMethod == "":
+		fields["contact_method"] = "Enter the contact_method."
+	case slices.Contains(notification.Channels, alert.ContactMethod) && !slices.Contains(channels, alert.ContactMethod):
+		fields["contact_method"] = fmt.Sprintf("%s alerts aren't available, enter a contact_method of: %s.", alert.ContactMethod, strings.Join(channels, ", "))
+	case !slices.Contains(channels, alert.ContactMethod):
+		fields["contact_method"] = fmt.Sprintf("Enter a valid contact_method: %s.", strings.Join(channels, ", "))
+	case alert.ContactMethod != "email" && (!user.PhoneNumber.Valid || strings.TrimSpace(user.PhoneNumber.String) == ""):
+		fields["contact_method"] = fmt.Sprintf("Add a phone number to your account to get %s alerts.", alert.ContactMethod)
+	}
+	if !slices.Contains(notification.Frequencies, alert.Frequency) {
+		fields["frequency"] = "Enter a valid frequency: instant, hourly or daily."
+	}
+
+	if alert.RadiusKm.Valid || alert.Latitude.Valid || alert.Longitude.Valid {
+		if !alert.RadiusKm.Valid || alert.RadiusKm.Float64 <= 0 {
+			fields["radius_km"] = "Enter a radius_km greater than 0 with the latitude and longitude."
+		}
+		if !alert.Latitude.Valid || math.Abs(alert.Latitude.Float64) > 90 {
+			fields["latitude"] = "Enter a latitude between -90 and 90 for the radius."
+		}
+		if !alert.Longitude.Valid || math.Abs(alert.Longitude.Float64) > 180 {
+			fields["longitude"] = "Enter a longitude between -180 and 180 for the radius."
+		}
+	}
+
+	for _, bounds := range []struct {
+		name     string
+		min, max int32
+	}{
+		{"bedrooms", alert.MinBedrooms, alert.MaxBedrooms},
+		{"bathrooms", alert.MinBathrooms, alert.MaxBathrooms},
+	} {
+		if bounds.min < 0 {
+			fields["min_"+bounds.name] = fmt.Sprintf("Enter min_%s of 0 or more.", bounds.name)
+		}
+		if bounds.max < 0 {
+			fields["max_"+bounds.name] = fmt.Sprintf("Enter max_%s of 0 or more.", bounds.name)
+		} else if bounds.max > 0 && bounds.min > bounds.max {
+			fields["max_"+bounds.name] = fmt.Sprintf("Enter max_%s of at least min_%s.", bounds.name, bounds.name)
+		}
+	}
+	return fields
+}
+
+// cleanList trims the values and drops empty and repeated ones, ignoring case.
+func cleanList(values []string) []string {
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		seen[strings.ToLower(value)] = true
+		cleaned = append(cleaned, value)
+	}
+	return cleaned
+}
+
+func nullFloat(value *float64) sql.NullFloat64 {
+	if value == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Valid: true, Float64: *value}
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -29,6 +32,16 @@ func (apiConfig *Config) PostFavoritesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	listing, err := apiConfig.DB.GetListing(r.Context(), body.ListingID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && listing.DeletedAt.Valid) {
+		helpers.RespondWithError(w, http.StatusNotFound, "listing not found")
+		return
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting listing. err: %v", err))
+		return
+	}
+
 	// Create favorite
 	fav, err := apiConfig.DB.CreateFavorite(context.Background(), database.CreateFavoriteParams{
 		UserID:    user.ID,
@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"html"
+	"log"
+	"strings"
+
 	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 // User model helpers
@@ -36,14 +43,55 @@ func DbListingToModelsListing(dbListing database.Listing) Listing {
 		Description:  dbListing.Description,
 		Price:        dbListing.Price,
 		Location:     dbListing.Location,
+		LocationID:   dbListing.LocationID,
 		Latitude:     dbListing.Latitude,
 		Longtitude:   dbListing.Longtitude,
 		PropertyType: dbListing.PropertyType,
+		Bedrooms:     dbListing.Bedrooms,
+		Bathrooms:    dbListing.Bathrooms,
 		Verified:     dbListing.Verified,
 		Images:       dbListing.Images,
 		Status:       dbListing.Status,
 		CreatedAt:    dbListing.CreatedAt,
+		UpdatedAt:    dbListing.UpdatedAt,
+
+		StatusChangedAt: dbListing.StatusChangedAt,
+		RentedAt:        dbListing.RentedAt,
+		Furnishing:      dbListing.Furnishing,
+		Serviced:        dbListing.Serviced,
+		RentPeriod:      dbListing.RentPeriod,
+		AgencyFee:       dbListing.AgencyFee,
+		LegalFee:        dbListing.LegalFee,
+		CautionFee:      dbListing.CautionFee,
+		TotalMoveInCost: dbListing.Price + dbListing.AgencyFee + dbListing.LegalFee + dbListing.CautionFee,
+	}
+}
+
+// ts_headline marks matches in GetListings snippets with these private use
+// characters, so the rest of the snippet can be escaped before they become tags.
+const (
+	snippetStartSel = "\ue000"
+	snippetStopSel  = "\ue001"
+)
+
+func highlightSnippet(snippet sql.NullString) string {
+	if !snippet.Valid {
+		return ""
 	}
+	escaped := html.EscapeString(snippet.String)
+	return strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>").Replace(escaped)
+}
+
+func DbListingRowsToModelsListings(rows []database.GetListingsRow) []Listing {
+	listings := []Listing{}
+	for _, row := range rows {
+		listing := DbListingToModelsListing(row.Listing)
+		listing.DistanceKm = row.DistanceKm
+		listing.Rank = row.Rank
+		listing.Snippet = highlightSnippet(row.Snippet)
+		listings = append(listings, listing)
+	}
+	return listings
 }
 
 func DbListingsToModelsListings(dbListings []database.Listing) []Listing {
@@ -57,13 +105,27 @@ func DbListingsToModelsListings(dbListings []database.Listing) []Listing {
 // Alert Model Helper
 func DbAlertToModelsAlert(dbAlert database.Alert) Alert {
 	return Alert{
-		ID:            dbAlert.ID,
-		UserID:        dbAlert.UserID,
-		MinPrice:      dbAlert.MinPrice,
-		MaxPrice:      dbAlert.MaxPrice,
-		Location:      dbAlert.Location,
-		PropertyType:  dbAlert.PropertyType,
-		ContactMethod: dbAlert.ContactMethod,
+		ID:              dbAlert.ID,
+		UserID:          dbAlert.UserID,
+		MinPrice:        dbAlert.MinPrice,
+		MaxPrice:        dbAlert.MaxPrice,
+		Locations:       dbAlert.Locations,
+		Latitude:        dbAlert.Latitude,
+		Longitude:       dbAlert.Longitude,
+		RadiusKm:        dbAlert.RadiusKm,
+		PropertyType:    dbAlert.PropertyType,
+		MinBedrooms:     dbAlert.MinBedrooms,
+		MaxBedrooms:     dbAlert.MaxBedrooms,
+		MinBathrooms:    dbAlert.MinBathrooms,
+		MaxBathrooms:    dbAlert.MaxBathrooms,
+		IncludeKeywords: dbAlert.IncludeKeywords,
+		ExcludeKeywords: dbAlert.ExcludeKeywords,
+		ContactMethod:   dbAlert.ContactMethod,
+		Frequency:       dbAlert.Frequency,
+		Active:          dbAlert.Active,
+		DisabledReason:  dbAlert.DisabledReason,
+		ExpiresAt:       dbAlert.ExpiresAt,
+		LocationIDs:     dbAlert.LocationIDs,
 	}
 }
 
@@ -75,6 +137,38 @@ func DbAlertsToModelsAlerts(dbAlerts []database.Alert) []Alert {
 	return alerts
 }
 
+// Location Model helper
+func DbLocationToModelsLocation(dbLocation database.Location) Location {
+	return Location{
+		ID:       dbLocation.ID,
+		ParentID: dbLocation.ParentID,
+		Slug:     dbLocation.Slug,
+		Name:     dbLocation.Name,
+		Kind:     dbLocation.Kind,
+	}
+}
+
+func DbLocationsToModelsLocations(dbLocations []database.Location) []Location {
+	locations := []Location{}
+	for _, l := range dbLocations {
+		locations = append(locations, DbLocationToModelsLocation(l))
+	}
+	return locations
+}
+
+// Listing price Model helper
+func DbListingPricesToModelsListingPrices(dbPrices []database.ListingPriceHistory) []ListingPrice {
+	prices := []ListingPrice{}
+	for _, p := range dbPrices {
+		prices = append(prices, ListingPrice{
+			Price:         p.Price,
+			PreviousPrice: p.PreviousPrice,
+			ChangedAt:     p.ChangedAt,
+		})
+	}
+	return prices
+}
+
 // Favourite Model helper
 func DbFavoriteToModelFavorite(dbFav database.Favorite) Favorite {
 	return Favorite{
@@ -95,15 +189,27 @@ func DbFavoritesToModelFavorites(dbFavs []database.Favorite) []Favorite {
 // Notification  Model Helper
 func DbNotificationToModelsNotification(dbNotification database.Notification) Notification {
 	return Notification{
-		ID:            dbNotification.ID,
-		UserID:        dbNotification.UserID,
-		Status:        dbNotification.Status,
-		ListingID:     dbNotification.ListingID,
-		SentAt:        dbNotification.SentAt,
-		ContactMethod: dbNotification.ContactMethod,
-		Contact:       dbNotification.Contact,
-		Subject:       dbNotification.Subject,
-		Body:          dbNotification.Body,
+		ID:                dbNotification.ID,
+		UserID:            dbNotification.UserID,
+		Status:            dbNotification.Status,
+		ListingID:         dbNotification.ListingID,
+		SentAt:            dbNotification.SentAt,
+		ContactMethod:     dbNotification.ContactMethod,
+		Contact:           dbNotification.Contact,
+		Subject:           dbNotification.Subject,
+		Body:              dbNotification.Body,
+		AlertID:           dbNotification.AlertID,
+		CreatedAt:         dbNotification.CreatedAt,
+		Attempts:          dbNotification.Attempts,
+		LastError:         dbNotification.LastError,
+		ProviderMessageID: dbNotification.ProviderMessageID,
+		DeliveredAt:       dbNotification.DeliveredAt,
+		ReadAt:            dbNotification.ReadAt,
+		Event:             dbNotification.Event,
+		DigestID:          dbNotification.DigestID,
+		HTMLBody:          dbNotification.HtmlBody,
+		DeliverAfter:      dbNotification.DeliverAfter,
+		UnsubscribeURL:    dbNotification.UnsubscribeUrl,
 	}
 }
 
@@ -114,3 +220,35 @@ func DbNotificationsToModelsNotifications(dbNotifications []database.Notificatio
 	}
 	return notications
 }
+
+// Notification Preferences Model Helper
+func DbPreferencesToModelsPreferences(dbPrefs database.NotificationPreference) NotificationPreferences {
+	return NotificationPreferences{
+		UserID:          dbPrefs.UserID,
+		QuietHoursStart: dbPrefs.QuietHoursStart,
+		QuietHoursEnd:   dbPrefs.QuietHoursEnd,
+		Timezone:        dbPrefs.Timezone,
+		ChannelPriority: dbPrefs.ChannelPriority,
+		Muted:           dbPrefs.Muted,
+		DailyCap:        dbPrefs.DailyCap,
+		UpdatedAt:       dbPrefs.UpdatedAt,
+	}
+}
+
+// publishNotifications hands notifications to the notification pipeline.
+// Failures are logged; the notification rows stay pending in the database
+// and the notification sweeper publishes them later.
+func (apiConfig *Config) publishNotifications(ctx context.Context, notifications []notification.Notification) {
+	if apiConfig.Publisher == nil {
+		return
+	}
+	for _, n := range notifications {
+		if err := apiConfig.Publisher.Publish(ctx, n); err != nil {
+			log.Printf("error publishing notification %s. err: %v", n.ID, err)
+			continue
+		}
+		if err := apiConfig.DB.MarkNotificationEnqueued(ctx, n.ID); err != nil {
+			log.Printf("error marking notification %s enqueued. err: %v", n.ID, err)
+		}
+	}
+}
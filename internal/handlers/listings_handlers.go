@@ -3,15 +3,24 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/muhammadolammi/rentradar/internal/database"
 	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 func (apiConfig *Config) GetListingsHandler(w http.ResponseWriter, r *http.Request) {
@@ -20,7 +29,13 @@ func (apiConfig *Config) GetListingsHandler(w http.ResponseWriter, r *http.Reque
 	propertyType := r.URL.Query().Get("property_type_name")
 	minPrice := r.URL.Query().Get("min_price")
 	maxPrice := r.URL.Query().Get("max_price")
-	page := r.URL.Query().Get("page")
+	furnishing := r.URL.Query().Get("furnishing")
+	serviced := r.URL.Query().Get("serviced")
+	rentPeriod := r.URL.Query().Get("rent_period")
+	// words to search titles and descriptions for, e.g. "self contain" borehole -shared
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	// the next_cursor of the previous page
+	cursorParam := r.URL.Query().Get("cursor")
 	limit := r.URL.Query().Get("limit")
 
 	//  Manage nullable parameters
@@ -30,8 +45,25 @@ func (apiConfig *Config) GetListingsHandler(w http.ResponseWriter, r *http.Reque
 	propertyTypeParam := sql.NullString{
 		Valid: false,
 	}
-	if location != "" {
-		locationParam = sql.NullString{Valid: true, String: location}
+	// a known place also matches listings anywhere inside it
+	locationIDParam := uuid.NullUUID{}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		id, err := uuid.Parse(locationID)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, "invalid location_id")
+			return
+		}
+		locationIDParam = uuid.NullUUID{UUID: id, Valid: true}
+	} else if location != "" {
+		id, err := locations.Resolve(r.Context(), apiConfig.DB, location)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		locationIDParam = id
+		if !id.Valid {
+			locationParam = sql.NullString{Valid: true, String: location}
+		}
 	}
 	if propertyType != "" {
 
@@ -58,46 +90,321 @@ func (apiConfig *Config) GetListingsHandler(w http.ResponseWriter, r *http.Reque
 
 		maxPriceParam = sql.NullInt64{Valid: true, Int64: int64(maxPriceInt)}
 	}
-	offset := 0
-	if page != "" {
-		pageInt, err := strconv.Atoi(page)
+	minBedroomsParam, minBathroomsParam := sql.NullInt32{}, sql.NullInt32{}
+	for param, target := range map[string]*sql.NullInt32{"min_bedrooms": &minBedroomsParam, "min_bathrooms": &minBathroomsParam} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
 		if err != nil {
-			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error converting page string to int. err: %v", err))
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a number.", param))
 			return
 		}
-		//  calculate Offset using the limits listings per page
-
-		offset = (pageInt - 1) * 20
+		*target = sql.NullInt32{Valid: true, Int32: int32(n)}
+	}
+	maxMoveInCostParam := sql.NullInt64{}
+	if maxMoveInCost := r.URL.Query().Get("max_move_in_cost"); maxMoveInCost != "" {
+		n, err := strconv.ParseInt(maxMoveInCost, 10, 64)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, "max_move_in_cost must be a number.")
+			return
+		}
+		maxMoveInCostParam = sql.NullInt64{Valid: true, Int64: n}
+	}
+	servicedParam := sql.NullBool{}
+	if serviced != "" {
+		b, err := strconv.ParseBool(serviced)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, "serviced must be true or false.")
+			return
+		}
+		servicedParam = sql.NullBool{Valid: true, Bool: b}
+	}
+	geo, err := parseListingGeoFilter(r.URL.Query())
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	limitInt := 20
+	furnishingParam := sql.NullString{Valid: furnishing != "", String: furnishing}
+	rentPeriodParam := sql.NullString{Valid: rentPeriod != "", String: rentPeriod}
+
+	limitInt := defaultListingsLimit
 	if limit != "" {
 		limitIntt, err := strconv.Atoi(limit)
+		if err != nil || limitIntt < 1 {
+			helpers.RespondWithError(w, http.StatusBadRequest, "limit must be a number above 0.")
+			return
+		}
+		limitInt = min(limitIntt, maxListingsLimit)
+	}
+	searchParam := sql.NullString{Valid: search != "", String: search}
+	sort, err := listingSort(r.URL.Query().Get("sort"), searchParam.Valid, geo.NearLat.Valid)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cursor := listingCursor{}
+	if cursorParam != "" {
+		cursor, err = decodeListingCursor(cursorParam, sort)
 		if err != nil {
-			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error converting page string to int. err: %v", err))
+			helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		//  calculate Offset using the limits listings per page
-
-		limitInt = limitIntt
 	}
 
-	listings, err := apiConfig.DB.GetListings(context.Background(), database.GetListingsParams{
-		// Location: ,
-		Offset:       int32(offset),
-		Limit:        int32(limitInt),
-		Location:     locationParam,
-		MinPrice:     minPriceParam,
-		MaxPrice:     maxPriceParam,
-		PropertyType: propertyTypeParam,
+	filters := database.CountListingsParams{
+		Location:        locationParam,
+		MinPrice:        minPriceParam,
+		MaxPrice:        maxPriceParam,
+		PropertyType:    propertyTypeParam,
+		MinBedrooms:     minBedroomsParam,
+		MinBathrooms:    minBathroomsParam,
+		Furnishing:      furnishingParam,
+		Serviced:        servicedParam,
+		RentPeriod:      rentPeriodParam,
+		MaxMoveInCost:   maxMoveInCostParam,
+		NearLat:         geo.NearLat,
+		NearLng:         geo.NearLng,
+		RadiusKm:        geo.RadiusKm,
+		MinLat:          geo.MinLat,
+		MinLng:          geo.MinLng,
+		MaxLat:          geo.MaxLat,
+		MaxLng:          geo.MaxLng,
+		LocationID:      locationIDParam,
+		Search:          searchParam,
+		RequireDistance: sort == "distance",
+	}
+	total, err := apiConfig.DB.CountListings(r.Context(), filters)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error counting listings. err: %v", err))
+		return
+	}
+	// one more than the page holds tells us whether there's a next page
+	listings, err := apiConfig.DB.GetListings(r.Context(), database.GetListingsParams{
+		Location:        filters.Location,
+		MinPrice:        filters.MinPrice,
+		MaxPrice:        filters.MaxPrice,
+		PropertyType:    filters.PropertyType,
+		MinBedrooms:     filters.MinBedrooms,
+		MinBathrooms:    filters.MinBathrooms,
+		Furnishing:      filters.Furnishing,
+		Serviced:        filters.Serviced,
+		RentPeriod:      filters.RentPeriod,
+		MaxMoveInCost:   filters.MaxMoveInCost,
+		NearLat:         filters.NearLat,
+		NearLng:         filters.NearLng,
+		RadiusKm:        filters.RadiusKm,
+		MinLat:          filters.MinLat,
+		MinLng:          filters.MinLng,
+		MaxLat:          filters.MaxLat,
+		MaxLng:          filters.MaxLng,
+		LocationID:      filters.LocationID,
+		Search:          filters.Search,
+		RequireDistance: filters.RequireDistance,
+		Sort:            sort,
+		CursorID:        cursor.ID,
+		CursorPrice:     cursor.Price,
+		CursorScore:     cursor.Score,
+		CursorCreatedAt: cursor.CreatedAt,
+		Limit:           int32(limitInt + 1),
 	})
 	if err != nil {
 		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error geting listings. err: %v", err))
 		return
 	}
 
-	converted_listings := DbListingsToModelsListings(listings)
-	helpers.RespondWithJson(w, http.StatusOK, converted_listings)
+	page := ListingsPage{Total: total}
+	if len(listings) > limitInt {
+		listings = listings[:limitInt]
+		page.NextCursor, err = encodeListingCursor(sort, listings[len(listings)-1])
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	page.Items = DbListingRowsToModelsListings(listings)
+	helpers.RespondWithJson(w, http.StatusOK, page)
+
+}
+
+const (
+	defaultListingsLimit = 20
+	maxListingsLimit     = 50
+)
+
+// listingSorts are the orders listings can be returned in. relevance orders
+// them by how well they match q.
+var listingSorts = []string{"newest", "price_asc", "price_desc", "distance", "relevance"}
+
+// listingSort checks sort, or picks the default when it's empty: relevance
+// when there's a search, distance when there's a point to measure from,
+// otherwise newest. Sorting by distance leaves out listings without
+// coordinates.
+func listingSort(sort string, search, near bool) (string, error) {
+	if sort == "" {
+		switch {
+		case search:
+			return "relevance", nil
+		case near:
+			return "distance", nil
+		default:
+			return "newest", nil
+		}
+	}
+	if !slices.Contains(listingSorts, sort) {
+		return "", fmt.Errorf("sort must be one of %s.", strings.Join(listingSorts, ", "))
+	}
+	if sort == "distance" && !near {
+		return "", errors.New("sort=distance needs near or bbox.")
+	}
+	if sort == "relevance" && !search {
+		return "", errors.New("sort=relevance needs q.")
+	}
+	return sort, nil
+}
+
+// listingCursor is the position of the last listing on a page in the sort
+// order: its id and the value it was sorted by.
+type listingCursor struct {
+	ID        uuid.NullUUID
+	Price     sql.NullInt64
+	Score     sql.NullFloat64
+	CreatedAt sql.NullTime
+}
+
+// listingCursorToken is what a cursor is sent to clients as, base64 encoded.
+// The sort is kept so a cursor can't be used with a different one.
+type listingCursorToken struct {
+	Sort      string    `json:"s"`
+	ID        uuid.UUID `json:"id"`
+	Price     int64     `json:"p,omitempty"`
+	Score     float64   `json:"f,omitempty"`
+	CreatedAt time.Time `json:"t,omitzero"`
+}
+
+func encodeListingCursor(sort string, row database.GetListingsRow) (string, error) {
+	token := listingCursorToken{Sort: sort, ID: row.Listing.ID}
+	switch sort {
+	case "price_asc", "price_desc":
+		token.Price = row.Listing.Price
+	case "distance":
+		token.Score = row.DistanceKm.Float64
+	case "relevance":
+		token.Score = row.Rank.Float64
+	default:
+		token.CreatedAt = row.Listing.CreatedAt
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("error encoding cursor. err: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeListingCursor(cursor string, sort string) (listingCursor, error) {
+	token := listingCursorToken{}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &token) != nil || token.ID == uuid.Nil {
+		return listingCursor{}, errors.New("invalid cursor")
+	}
+	if token.Sort != sort {
+		return listingCursor{}, errors.New("cursor is for a different sort")
+	}
+	return listingCursor{
+		ID:        uuid.NullUUID{UUID: token.ID, Valid: true},
+		Price:     sql.NullInt64{Int64: token.Price, Valid: true},
+		Score:     sql.NullFloat64{Float64: token.Score, Valid: true},
+		CreatedAt: sql.NullTime{Time: token.CreatedAt, Valid: true},
+	}, nil
+}
+
+// listingGeoFilter is the geographic part of a listings search. Listings are
+// ordered by their distance from Near; the box limits them to an area.
+type listingGeoFilter struct {
+	NearLat, NearLng               sql.NullFloat64
+	RadiusKm                       sql.NullFloat64
+	MinLat, MinLng, MaxLat, MaxLng sql.NullFloat64
+}
+
+// parseListingGeoFilter reads near=lat,lng with an optional radius_km, or
+// bbox=min_lng,min_lat,max_lng,max_lat. A radius is turned into the box around
+// it so the spatial index narrows the search before distances are checked,
+// and a bbox without near is ordered by distance from its centre.
+func parseListingGeoFilter(query url.Values) (listingGeoFilter, error) {
+	filter := listingGeoFilter{}
+	if near := query.Get("near"); near != "" {
+		coords, err := parseCoordinates(near, 2)
+		if err != nil || !validLatLng(coords[0], coords[1]) {
+			return filter, errors.New("near must be lat,lng.")
+		}
+		filter.NearLat = sql.NullFloat64{Valid: true, Float64: coords[0]}
+		filter.NearLng = sql.NullFloat64{Valid: true, Float64: coords[1]}
+	}
+	if radius := query.Get("radius_km"); radius != "" {
+		radiusKm, err := strconv.ParseFloat(radius, 64)
+		if err != nil || radiusKm <= 0 {
+			return filter, errors.New("radius_km must be a number above 0.")
+		}
+		if !filter.NearLat.Valid {
+			return filter, errors.New("radius_km needs near.")
+		}
+		filter.RadiusKm = sql.NullFloat64{Valid: true, Float64: radiusKm}
+	}
+	if bbox := query.Get("bbox"); bbox != "" {
+		if filter.RadiusKm.Valid {
+			return filter, errors.New("Search by radius_km or bbox, not both.")
+		}
+		coords, err := parseCoordinates(bbox, 4)
+		minLng, minLat, maxLng, maxLat := coords[0], coords[1], coords[2], coords[3]
+		if err != nil || !validLatLng(minLat, minLng) || !validLatLng(maxLat, maxLng) || minLat > maxLat || minLng > maxLng {
+			return filter, errors.New("bbox must be min_lng,min_lat,max_lng,max_lat.")
+		}
+		filter.setBox(minLat, minLng, maxLat, maxLng)
+		if !filter.NearLat.Valid {
+			filter.NearLat = sql.NullFloat64{Valid: true, Float64: (minLat + maxLat) / 2}
+			filter.NearLng = sql.NullFloat64{Valid: true, Float64: (minLng + maxLng) / 2}
+		}
+	}
+	if filter.RadiusKm.Valid {
+		lat, lng, radiusKm := filter.NearLat.Float64, filter.NearLng.Float64, filter.RadiusKm.Float64
+		// a degree of latitude is about 111.32km; degrees of longitude shrink towards the poles
+		latDelta := radiusKm / 111.32
+		lngDelta := 180.0
+		if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+			lngDelta = math.Min(radiusKm/(111.32*cos), 180)
+		}
+		filter.setBox(math.Max(lat-latDelta, -90), math.Max(lng-lngDelta, -180), math.Min(lat+latDelta, 90), math.Min(lng+lngDelta, 180))
+	}
+	return filter, nil
+}
+
+func (f *listingGeoFilter) setBox(minLat, minLng, maxLat, maxLng float64) {
+	f.MinLat = sql.NullFloat64{Valid: true, Float64: minLat}
+	f.MinLng = sql.NullFloat64{Valid: true, Float64: minLng}
+	f.MaxLat = sql.NullFloat64{Valid: true, Float64: maxLat}
+	f.MaxLng = sql.NullFloat64{Valid: true, Float64: maxLng}
+}
 
+// parseCoordinates parses n comma separated numbers.
+func parseCoordinates(value string, n int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	coords := make([]float64, n)
+	if len(parts) != n {
+		return coords, fmt.Errorf("expected %d numbers, got %d", n, len(parts))
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return coords, err
+		}
+		coords[i] = f
+	}
+	return coords, nil
+}
+
+func validLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
 }
 
 func (apiConfig *Config) PostListingsHandler(w http.ResponseWriter, r *http.Request, user User) {
@@ -113,6 +420,17 @@ func (apiConfig *Config) PostListingsHandler(w http.ResponseWriter, r *http.Requ
 		Images       json.RawMessage `json:"images"`
 		Price        int64           `json:"price"`
 		Location     string          `json:"location"`
+		LocationID   *uuid.UUID      `json:"location_id"`
+		Latitude     *float64        `json:"latitude"`
+		Longtitude   *float64        `json:"longtitude"`
+		Bedrooms     *int32          `json:"bedrooms"`
+		Bathrooms    *int32          `json:"bathrooms"`
+		Furnishing   string          `json:"furnishing"`
+		Serviced     bool            `json:"serviced"`
+		RentPeriod   string          `json:"rent_period"`
+		AgencyFee    int64           `json:"agency_fee"`
+		LegalFee     int64           `json:"legal_fee"`
+		CautionFee   int64           `json:"caution_fee"`
 	}{}
 
 	decoder := json.NewDecoder(r.Body)
@@ -142,18 +460,72 @@ func (apiConfig *Config) PostListingsHandler(w http.ResponseWriter, r *http.Requ
 		helpers.RespondWithError(w, http.StatusInternalServerError, "Enter the listing price.")
 		return
 	}
-	if body.Location == "" {
+	if body.Location == "" && body.LocationID == nil {
 		helpers.RespondWithError(w, http.StatusInternalServerError, "Enter the listing location.")
 		return
 	}
-	listing, err := apiConfig.DB.CreateListing(context.Background(), database.CreateListingParams{
+	located := database.Listing{Location: body.Location}
+	if msg, err := apiConfig.locateListing(r.Context(), &located, body.LocationID); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if msg != "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if (body.Latitude == nil) != (body.Longtitude == nil) {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter both the listing latitude and longtitude, or neither.")
+		return
+	}
+	bedrooms, bathrooms := sql.NullInt32{}, sql.NullInt32{}
+	if body.Bedrooms != nil {
+		bedrooms = sql.NullInt32{Valid: true, Int32: *body.Bedrooms}
+	}
+	if body.Bathrooms != nil {
+		bathrooms = sql.NullInt32{Valid: true, Int32: *body.Bathrooms}
+	}
+	if bedrooms.Int32 < 0 || bathrooms.Int32 < 0 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter listing bedrooms and bathrooms of 0 or more.")
+		return
+	}
+	if body.Furnishing == "" {
+		body.Furnishing = "unfurnished"
+	}
+	if body.RentPeriod == "" {
+		body.RentPeriod = "yearly"
+	}
+	if msg := listingAttributesError(body.Furnishing, body.RentPeriod, body.AgencyFee, body.LegalFee, body.CautionFee); msg != "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	// The listing and its notifications are written in one transaction; the
+	// pending notifications are the outbox the notification sweeper falls back on.
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error starting transaction. err: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiConfig.DB.WithTx(tx)
+
+	listing, err := qtx.CreateListing(r.Context(), database.CreateListingParams{
 		AgentID:      user.ID,
 		Price:        body.Price,
-		Location:     body.Location,
+		Location:     located.Location,
+		LocationID:   located.LocationID,
 		Description:  body.Description,
 		Title:        body.Title,
 		PropertyType: body.PropertyType,
 		Images:       body.Images,
+		Latitude:     nullFloat(body.Latitude),
+		Longtitude:   nullFloat(body.Longtitude),
+		Bedrooms:     bedrooms,
+		Bathrooms:    bathrooms,
+		Furnishing:   body.Furnishing,
+		Serviced:     body.Serviced,
+		RentPeriod:   body.RentPeriod,
+		AgencyFee:    body.AgencyFee,
+		LegalFee:     body.LegalFee,
+		CautionFee:   body.CautionFee,
 		// Status should be active on creation
 		Status: "active",
 	})
@@ -161,6 +533,25 @@ func (apiConfig *Config) PostListingsHandler(w http.ResponseWriter, r *http.Requ
 		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error creating listing. err: %v", err))
 		return
 	}
+	_, err = qtx.CreateListingPrice(r.Context(), database.CreateListingPriceParams{
+		ListingID: listing.ID,
+		Price:     listing.Price,
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recording listing price. err: %v", err))
+		return
+	}
+	// Fan the listing out to every alert it matches.
+	notifications, err := notification.MatchListing(r.Context(), qtx, listing, apiConfig.ListingBaseURL, apiConfig.Unsubscriber)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error matching listing to alerts. err: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error creating listing. err: %v", err))
+		return
+	}
+	apiConfig.publishNotifications(r.Context(), notifications)
 	helpers.RespondWithJson(w, http.StatusOK, DbListingToModelsListing(listing))
 }
 
@@ -174,6 +565,10 @@ func (apiConfig *Config) GetListingHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	listing, err := apiConfig.DB.GetListing(context.Background(), uuidID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && listing.DeletedAt.Valid) {
+		helpers.RespondWithError(w, http.StatusNotFound, "listing not found")
+		return
+	}
 	if err != nil {
 		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error geting listing. err: %v", err))
 		return
@@ -183,3 +578,355 @@ func (apiConfig *Config) GetListingHandler(w http.ResponseWriter, r *http.Reques
 	helpers.RespondWithJson(w, http.StatusOK, converted_listings)
 
 }
+
+// ---------- Listing Price History ----------
+func (apiConfig *Config) GetListingPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "ID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid listing id")
+		return
+	}
+	listing, err := apiConfig.DB.GetListing(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && listing.DeletedAt.Valid) {
+		helpers.RespondWithError(w, http.StatusNotFound, "listing not found")
+		return
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting listing. err: %v", err))
+		return
+	}
+	prices, err := apiConfig.DB.GetListingPriceHistory(r.Context(), listing.ID)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting listing price history. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, DbListingPricesToModelsListingPrices(prices))
+}
+
+// locateListing sets the listing's location id to id, naming the listing's
+// location after it when it has none, or else to the place its location text
+// resolves to. It returns a message when id isn't a known location.
+func (apiConfig *Config) locateListing(ctx context.Context, listing *database.Listing, id *uuid.UUID) (string, error) {
+	if id == nil {
+		resolved, err := locations.Resolve(ctx, apiConfig.DB, listing.Location)
+		if err != nil {
+			return "", err
+		}
+		listing.LocationID = resolved
+		return "", nil
+	}
+	location, err := apiConfig.DB.GetLocation(ctx, *id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "location_id isn't a known location.", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting location. err: %v", err)
+	}
+	listing.LocationID = uuid.NullUUID{UUID: location.ID, Valid: true}
+	if strings.TrimSpace(listing.Location) == "" {
+		listing.Location = location.Name
+	}
+	return "", nil
+}
+
+var (
+	listingFurnishings = []string{"unfurnished", "semi_furnished", "furnished"}
+	listingRentPeriods = []string{"monthly", "quarterly", "yearly"}
+)
+
+// listingAttributesError returns why the furnishing, rent period or fees of a
+// listing are invalid, or "" when they're fine.
+func listingAttributesError(furnishing, rentPeriod string, agencyFee, legalFee, cautionFee int64) string {
+	switch {
+	case !slices.Contains(listingFurnishings, furnishing):
+		return fmt.Sprintf("furnishing must be one of %v.", listingFurnishings)
+	case !slices.Contains(listingRentPeriods, rentPeriod):
+		return fmt.Sprintf("rent_period must be one of %v.", listingRentPeriods)
+	case agencyFee < 0 || legalFee < 0 || cautionFee < 0:
+		return "Enter listing fees of 0 or more."
+	}
+	return ""
+}
+
+// listingTransitions lists the statuses a listing can move to from each status.
+// Rented listings are final.
+var listingTransitions = map[string][]string{
+	"active":   {"inactive", "rented"},
+	"inactive": {"active"},
+}
+
+// ---------- Update Listing ----------
+// Fields left out of the body keep their current value. Users who saved the
+// listing are told when it's rented, or when the price of an active listing
+// changes.
+func (apiConfig *Config) PatchListingHandler(w http.ResponseWriter, r *http.Request, user User) {
+	body := struct {
+		Title        *string          `json:"title"`
+		Description  *string          `json:"description"`
+		Price        *int64           `json:"price"`
+		Location     *string          `json:"location"`
+		LocationID   *uuid.UUID       `json:"location_id"`
+		PropertyType *string          `json:"property_type"`
+		Images       *json.RawMessage `json:"images"`
+		Latitude     *float64         `json:"latitude"`
+		Longtitude   *float64         `json:"longtitude"`
+		Bedrooms     *int32           `json:"bedrooms"`
+		Bathrooms    *int32           `json:"bathrooms"`
+		Furnishing   *string          `json:"furnishing"`
+		Serviced     *bool            `json:"serviced"`
+		RentPeriod   *string          `json:"rent_period"`
+		AgencyFee    *int64           `json:"agency_fee"`
+		LegalFee     *int64           `json:"legal_fee"`
+		CautionFee   *int64           `json:"caution_fee"`
+		Status       *string          `json:"status"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	listing, ok := apiConfig.getAgentListing(w, r, user)
+	if !ok {
+		return
+	}
+	oldListing := listing
+
+	if body.Title != nil {
+		listing.Title = *body.Title
+	}
+	if body.Description != nil {
+		listing.Description = *body.Description
+	}
+	if body.Price != nil {
+		listing.Price = *body.Price
+	}
+	if body.Location != nil {
+		listing.Location = *body.Location
+	}
+	if body.Location != nil || body.LocationID != nil {
+		listing.LocationID = uuid.NullUUID{}
+		if msg, err := apiConfig.locateListing(r.Context(), &listing, body.LocationID); err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		} else if msg != "" {
+			helpers.RespondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if body.PropertyType != nil {
+		listing.PropertyType = *body.PropertyType
+	}
+	if body.Images != nil {
+		listing.Images = *body.Images
+	}
+	if body.Latitude != nil {
+		listing.Latitude = nullFloat(body.Latitude)
+	}
+	if body.Longtitude != nil {
+		listing.Longtitude = nullFloat(body.Longtitude)
+	}
+	if body.Bedrooms != nil {
+		listing.Bedrooms = sql.NullInt32{Valid: true, Int32: *body.Bedrooms}
+	}
+	if body.Bathrooms != nil {
+		listing.Bathrooms = sql.NullInt32{Valid: true, Int32: *body.Bathrooms}
+	}
+	if body.Furnishing != nil {
+		listing.Furnishing = *body.Furnishing
+	}
+	if body.Serviced != nil {
+		listing.Serviced = *body.Serviced
+	}
+	if body.RentPeriod != nil {
+		listing.RentPeriod = *body.RentPeriod
+	}
+	if body.AgencyFee != nil {
+		listing.AgencyFee = *body.AgencyFee
+	}
+	if body.LegalFee != nil {
+		listing.LegalFee = *body.LegalFee
+	}
+	if body.CautionFee != nil {
+		listing.CautionFee = *body.CautionFee
+	}
+	if body.Status != nil && *body.Status != listing.Status {
+		if !slices.Contains(listingTransitions[listing.Status], *body.Status) {
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("A %s listing can't be changed to %q.", listing.Status, *body.Status))
+			return
+		}
+		listing.Status = *body.Status
+	}
+
+	switch {
+	case listing.Title == "":
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing title.")
+		return
+	case listing.Description == "":
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing description.")
+		return
+	case listing.PropertyType == "":
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing property_type.")
+		return
+	case len(listing.Images) == 0 || string(listing.Images) == "[]" || string(listing.Images) == "{}":
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing images.")
+		return
+	case listing.Price <= 0:
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing price.")
+		return
+	case listing.Location == "":
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter the listing location.")
+		return
+	case listing.Latitude.Valid != listing.Longtitude.Valid:
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter both the listing latitude and longtitude, or neither.")
+		return
+	case listing.Bedrooms.Int32 < 0 || listing.Bathrooms.Int32 < 0:
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter listing bedrooms and bathrooms of 0 or more.")
+		return
+	}
+	if msg := listingAttributesError(listing.Furnishing, listing.RentPeriod, listing.AgencyFee, listing.LegalFee, listing.CautionFee); msg != "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error starting transaction. err: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiConfig.DB.WithTx(tx)
+
+	listing, err = qtx.UpdateListing(r.Context(), database.UpdateListingParams{
+		ID:           listing.ID,
+		Title:        listing.Title,
+		Description:  listing.Description,
+		Price:        listing.Price,
+		Location:     listing.Location,
+		PropertyType: listing.PropertyType,
+		Images:       listing.Images,
+		Latitude:     listing.Latitude,
+		Longtitude:   listing.Longtitude,
+		Bedrooms:     listing.Bedrooms,
+		Bathrooms:    listing.Bathrooms,
+		Status:       listing.Status,
+		Furnishing:   listing.Furnishing,
+		Serviced:     listing.Serviced,
+		RentPeriod:   listing.RentPeriod,
+		AgencyFee:    listing.AgencyFee,
+		LegalFee:     listing.LegalFee,
+		CautionFee:   listing.CautionFee,
+		LocationID:   listing.LocationID,
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating listing. err: %v", err))
+		return
+	}
+
+	event := ""
+	switch {
+	case listing.Status == "rented" && oldListing.Status != "rented":
+		event = notification.EventListingRented
+	case listing.Status == "active" && listing.Price < oldListing.Price:
+		event = notification.EventPriceDrop
+	case listing.Status == "active" && listing.Price > oldListing.Price:
+		event = notification.EventPriceRise
+	}
+	if listing.Price != oldListing.Price {
+		_, err = qtx.CreateListingPrice(r.Context(), database.CreateListingPriceParams{
+			ListingID:     listing.ID,
+			Price:         listing.Price,
+			PreviousPrice: sql.NullInt64{Int64: oldListing.Price, Valid: true},
+		})
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recording listing price. err: %v", err))
+			return
+		}
+	}
+	notifications := []notification.Notification{}
+	if event == notification.EventPriceDrop {
+		// alerts the listing now fits get a price drop too
+		notifications, err = notification.MatchPriceDrop(r.Context(), qtx, listing, oldListing.Price, apiConfig.ListingBaseURL, apiConfig.Unsubscriber)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error matching alerts. err: %v", err))
+			return
+		}
+	}
+	if event != "" {
+		favorites, err := notification.NotifyFavorites(r.Context(), qtx, listing, event, oldListing.Price, apiConfig.ListingBaseURL, apiConfig.Unsubscriber, notifications)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error notifying favorites. err: %v", err))
+			return
+		}
+		notifications = append(notifications, favorites...)
+	}
+	if err := tx.Commit(); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error updating listing. err: %v", err))
+		return
+	}
+	apiConfig.publishNotifications(r.Context(), notifications)
+	helpers.RespondWithJson(w, http.StatusOK, DbListingToModelsListing(listing))
+}
+
+// ---------- Delete Listing ----------
+// The listing is only marked deleted, so notifications about it keep their
+// delivery history. Its favorites are removed, and notifications about it that
+// haven't gone out yet are suppressed.
+func (apiConfig *Config) DeleteListingHandler(w http.ResponseWriter, r *http.Request, user User) {
+	listing, ok := apiConfig.getAgentListing(w, r, user)
+	if !ok {
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting listing. err: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiConfig.DB.WithTx(tx)
+
+	err = qtx.SuppressListingNotifications(r.Context(), database.SuppressListingNotificationsParams{
+		ListingID: uuid.NullUUID{UUID: listing.ID, Valid: true},
+		LastError: sql.NullString{Valid: true, String: "listing deleted"},
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error suppressing listing notifications. err: %v", err))
+		return
+	}
+	if err := qtx.DeleteListingFavorites(r.Context(), listing.ID); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting listing favorites. err: %v", err))
+		return
+	}
+	if err := qtx.DeleteListing(r.Context(), listing.ID); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting listing. err: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error deleting listing. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, "listing deleted")
+}
+
+// getAgentListing loads the listing in the url. It responds and returns false
+// when the listing doesn't exist, or the user is neither its agent nor an admin.
+func (apiConfig *Config) getAgentListing(w http.ResponseWriter, r *http.Request, user User) (database.Listing, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "ID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid listing id")
+		return database.Listing{}, false
+	}
+	listing, err := apiConfig.DB.GetListing(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && listing.DeletedAt.Valid) {
+		helpers.RespondWithError(w, http.StatusNotFound, "listing not found")
+		return database.Listing{}, false
+	}
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting listing. err: %v", err))
+		return database.Listing{}, false
+	}
+	if listing.AgentID != user.ID && user.Role != "admin" {
+		helpers.RespondWithError(w, http.StatusForbidden, "only the listing's agent or an admin can change it")
+		return database.Listing{}, false
+	}
+	return listing, true
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+)
+
+// ---------- Get Locations ----------
+// Without parent_id it lists the states; with it, the places directly inside
+// that location.
+func (apiConfig *Config) GetLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	parentID := uuid.NullUUID{}
+	if parent := r.URL.Query().Get("parent_id"); parent != "" {
+		id, err := uuid.Parse(parent)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, "invalid parent_id")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	dbLocations, err := apiConfig.DB.GetChildLocations(r.Context(), parentID)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting locations. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, DbLocationsToModelsLocations(dbLocations))
+}
+
+// ---------- Autocomplete Locations ----------
+// q is matched against location names and aliases like "VI", by prefix and
+// with typos. kind limits the suggestions to one level of the hierarchy and
+// limit defaults to 10, up to 20.
+func (apiConfig *Config) GetLocationsAutocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	query := locations.Normalize(r.URL.Query().Get("q"))
+	if query == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter q to search for.")
+		return
+	}
+	kind := sql.NullString{}
+	if k := r.URL.Query().Get("kind"); k != "" {
+		if !slices.Contains(locations.Kinds, k) {
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("kind must be one of %s.", strings.Join(locations.Kinds, ", ")))
+			return
+		}
+		kind = sql.NullString{Valid: true, String: k}
+	}
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 20 {
+			helpers.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and 20.")
+			return
+		}
+		limit = n
+	}
+
+	matches, err := apiConfig.DB.AutocompleteLocations(r.Context(), database.AutocompleteLocationsParams{
+		Query: query,
+		Kind:  kind,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error searching locations. err: %v", err))
+		return
+	}
+	suggestions := []LocationSuggestion{}
+	for _, match := range matches {
+		ancestors, err := apiConfig.DB.GetLocationAncestors(r.Context(), match.Location.ID)
+		if err != nil {
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error getting location ancestors. err: %v", err))
+			return
+		}
+		if len(ancestors) == 0 {
+			continue
+		}
+		// ancestors run from the state down and end with the location itself
+		names := []string{}
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			names = append(names, ancestors[i].Name)
+		}
+		suggestions = append(suggestions, LocationSuggestion{
+			Location: DbLocationToModelsLocation(match.Location),
+			Label:    strings.Join(names, ", "),
+			Path:     DbLocationsToModelsLocations(ancestors[:len(ancestors)-1]),
+			Score:    match.Score,
+		})
+	}
+	helpers.RespondWithJson(w, http.StatusOK, suggestions)
+}
@@ -7,14 +7,31 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 type Config struct {
-	DB      *database.Queries
-	PORT    string
-	APIKEY  string
-	JWTKEY  string
-	SUDOKEY string
+	DB *database.Queries
+	// DBConn is used for handlers that need a transaction
+	DBConn    *sql.DB
+	Publisher *notification.Publisher
+	PORT      string
+	APIKEY    string
+	JWTKEY    string
+	SUDOKEY   string
+	// ListingBaseURL is the frontend url notifications link listings to
+	ListingBaseURL string
+	// Unsubscriber signs and checks the unsubscribe links in notifications
+	Unsubscriber *notification.Unsubscriber
+	// MaxAlertsPerUser caps how many alerts a user can have, 0 means no cap
+	MaxAlertsPerUser int
+	// Channels are the contact methods with a sender configured, the only ones alerts can use
+	Channels []string
+	// provider webhook secrets, a webhook is disabled while its secret is empty
+	EmailWebhookSecret  string
+	SMSWebhookSecret    string
+	WhatsAppAppSecret   string
+	WhatsAppVerifyToken string
 }
 
 type Agent struct {
@@ -26,13 +43,28 @@ type Agent struct {
 }
 
 type Alert struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	MinPrice      int64     `json:"min_price"`
-	MaxPrice      int64     `json:"max_price"`
-	Location      string    `json:"location"`
-	PropertyType  string    `json:"property_type"`
-	ContactMethod string    `json:"contact_method"`
+	ID              uuid.UUID       `json:"id"`
+	UserID          uuid.UUID       `json:"user_id"`
+	MinPrice        int64           `json:"min_price"`
+	MaxPrice        int64           `json:"max_price"`
+	Locations       []string        `json:"locations"`
+	Latitude        sql.NullFloat64 `json:"latitude"`
+	Longitude       sql.NullFloat64 `json:"longitude"`
+	RadiusKm        sql.NullFloat64 `json:"radius_km"`
+	PropertyType    string          `json:"property_type"`
+	MinBedrooms     int32           `json:"min_bedrooms"`
+	MaxBedrooms     int32           `json:"max_bedrooms"`
+	MinBathrooms    int32           `json:"min_bathrooms"`
+	MaxBathrooms    int32           `json:"max_bathrooms"`
+	IncludeKeywords []string        `json:"include_keywords"`
+	ExcludeKeywords []string        `json:"exclude_keywords"`
+	ContactMethod   string          `json:"contact_method"`
+	Frequency       string          `json:"frequency"`
+	Active          bool            `json:"active"`
+	DisabledReason  sql.NullString  `json:"disabled_reason"`
+	ExpiresAt       sql.NullTime    `json:"expires_at"`
+	// the known places among locations, with everything inside them
+	LocationIDs []uuid.UUID `json:"location_ids"`
 }
 
 type Favorite struct {
@@ -48,25 +80,105 @@ type Listing struct {
 	Description  string          `json:"description"`
 	Price        int64           `json:"price"`
 	Location     string          `json:"location"`
+	LocationID   uuid.NullUUID   `json:"location_id"`
 	Latitude     sql.NullFloat64 `json:"latitude"`
 	Longtitude   sql.NullFloat64 `json:"longtitude"`
 	PropertyType string          `json:"property_type"`
+	Bedrooms     sql.NullInt32   `json:"bedrooms"`
+	Bathrooms    sql.NullInt32   `json:"bathrooms"`
 	Verified     bool            `json:"verified"`
 	Images       json.RawMessage `json:"images"`
 	Status       string          `json:"status"`
 	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	// when the status last changed and when the listing was rented
+	StatusChangedAt time.Time    `json:"status_changed_at"`
+	RentedAt        sql.NullTime `json:"rented_at"`
+	Furnishing      string       `json:"furnishing"`
+	Serviced        bool         `json:"serviced"`
+	// price is the rent for one rent period
+	RentPeriod string `json:"rent_period"`
+	AgencyFee  int64  `json:"agency_fee"`
+	LegalFee   int64  `json:"legal_fee"`
+	CautionFee int64  `json:"caution_fee"`
+	// the first rent period plus every fee
+	TotalMoveInCost int64 `json:"total_move_in_cost"`
+	// how far the listing is from the point a search was near
+	DistanceKm sql.NullFloat64 `json:"distance_km"`
+	// how well the listing matches a search, and the matching part of its
+	// description as HTML with the matches in <mark>
+	Rank    sql.NullFloat64 `json:"rank"`
+	Snippet string          `json:"snippet"`
+}
+
+// ListingsPage is one page of a listings search. NextCursor fetches the page
+// after it and is empty on the last page; Total counts every listing the
+// search matches.
+type ListingsPage struct {
+	Items      []Listing `json:"items"`
+	NextCursor string    `json:"next_cursor"`
+	Total      int64     `json:"total"`
+}
+
+// ListingPrice is one entry in a listing's price history.
+type ListingPrice struct {
+	Price         int64         `json:"price"`
+	PreviousPrice sql.NullInt64 `json:"previous_price"`
+	ChangedAt     time.Time     `json:"changed_at"`
+}
+
+// Location is a place in the state > lga > area > neighbourhood hierarchy.
+type Location struct {
+	ID       uuid.UUID     `json:"id"`
+	ParentID uuid.NullUUID `json:"parent_id"`
+	Slug     string        `json:"slug"`
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+}
+
+// LocationSuggestion is a location matching an autocomplete query.
+type LocationSuggestion struct {
+	Location
+	// the location and the places it's in, e.g. "Ikate, Lekki, Eti-Osa, Lagos"
+	Label string `json:"label"`
+	// from the state down to the location's parent
+	Path  []Location `json:"path"`
+	Score float64    `json:"score"`
 }
 
 type Notification struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	Contact       string    `json:"contact"`
-	Body          string    `json:"body"`
-	Subject       string    `json:"subject"`
-	ListingID     uuid.UUID `json:"listing_id"`
-	SentAt        time.Time `json:"sent_at"`
-	Status        string    `json:"status"`
-	ContactMethod string    `json:"contact_method"`
+	ID                uuid.UUID      `json:"id"`
+	UserID            uuid.UUID      `json:"user_id"`
+	Contact           string         `json:"contact"`
+	Body              string         `json:"body"`
+	Subject           string         `json:"subject"`
+	ListingID         uuid.NullUUID  `json:"listing_id"`
+	SentAt            sql.NullTime   `json:"sent_at"`
+	Status            string         `json:"status"`
+	ContactMethod     string         `json:"contact_method"`
+	AlertID           uuid.NullUUID  `json:"alert_id"`
+	CreatedAt         time.Time      `json:"created_at"`
+	Attempts          int32          `json:"attempts"`
+	LastError         sql.NullString `json:"last_error"`
+	ProviderMessageID sql.NullString `json:"provider_message_id"`
+	DeliveredAt       sql.NullTime   `json:"delivered_at"`
+	ReadAt            sql.NullTime   `json:"read_at"`
+	Event             string         `json:"event"`
+	DigestID          uuid.NullUUID  `json:"digest_id"`
+	HTMLBody          string         `json:"html_body"`
+	DeliverAfter      sql.NullTime   `json:"deliver_after"`
+	UnsubscribeURL    string         `json:"unsubscribe_url"`
+}
+
+type NotificationPreferences struct {
+	UserID          uuid.UUID `json:"user_id"`
+	QuietHoursStart string    `json:"quiet_hours_start"`
+	QuietHoursEnd   string    `json:"quiet_hours_end"`
+	Timezone        string    `json:"timezone"`
+	ChannelPriority []string  `json:"channel_priority"`
+	Muted           bool      `json:"muted"`
+	DailyCap        int32     `json:"daily_cap"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 type User struct {
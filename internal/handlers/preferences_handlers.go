@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// ---------- Get Notification Preferences ----------
+func (apiConfig *Config) GetPreferencesHandler(w http.ResponseWriter, r *http.Request, user User) {
+	prefs, err := notification.GetPreferences(r.Context(), apiConfig.DB, user.ID)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, DbPreferencesToModelsPreferences(prefs))
+}
+
+// ---------- Update Notification Preferences ----------
+// Fields left out of the body keep their current value.
+func (apiConfig *Config) PutPreferencesHandler(w http.ResponseWriter, r *http.Request, user User) {
+	body := struct {
+		QuietHoursStart *string   `json:"quiet_hours_start"`
+		QuietHoursEnd   *string   `json:"quiet_hours_end"`
+		Timezone        *string   `json:"timezone"`
+		ChannelPriority *[]string `json:"channel_priority"`
+		Muted           *bool     `json:"muted"`
+		DailyCap        *int32    `json:"daily_cap"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	prefs, err := notification.GetPreferences(r.Context(), apiConfig.DB, user.ID)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if body.QuietHoursStart != nil {
+		prefs.QuietHoursStart = *body.QuietHoursStart
+	}
+	if body.QuietHoursEnd != nil {
+		prefs.QuietHoursEnd = *body.QuietHoursEnd
+	}
+	if body.Timezone != nil {
+		prefs.Timezone = *body.Timezone
+	}
+	if body.ChannelPriority != nil {
+		prefs.ChannelPriority = *body.ChannelPriority
+	}
+	if body.Muted != nil {
+		prefs.Muted = *body.Muted
+	}
+	if body.DailyCap != nil {
+		prefs.DailyCap = *body.DailyCap
+	}
+
+	if (prefs.QuietHoursStart == "") != (prefs.QuietHoursEnd == "") {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter both quiet_hours_start and quiet_hours_end, or neither.")
+		return
+	}
+	for _, clock := range []string{prefs.QuietHoursStart, prefs.QuietHoursEnd} {
+		if clock == "" {
+			continue
+		}
+		if _, err := notification.ParseClock(clock); err != nil {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Enter quiet hours as HH:MM, e.g. 22:00.")
+			return
+		}
+	}
+	if prefs.Timezone == "" {
+		prefs.Timezone = notification.DefaultTimezone
+	}
+	if _, err := notification.LoadLocation(prefs.Timezone); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Enter a valid timezone, e.g. %s.", notification.DefaultTimezone))
+		return
+	}
+	if prefs.ChannelPriority == nil {
+		prefs.ChannelPriority = []string{}
+	}
+	for i, channel := range prefs.ChannelPriority {
+		if !slices.Contains(notification.Channels, channel) {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Enter channel_priority channels from: email, sms, whatsapp.")
+			return
+		}
+		if slices.Contains(prefs.ChannelPriority[:i], channel) {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Enter each channel in channel_priority once.")
+			return
+		}
+	}
+	if prefs.DailyCap < 0 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Enter a daily_cap of 0 or more, 0 means no cap.")
+		return
+	}
+
+	saved, err := apiConfig.DB.UpsertNotificationPreferences(r.Context(), database.UpsertNotificationPreferencesParams{
+		UserID:          user.ID,
+		QuietHoursStart: prefs.QuietHoursStart,
+		QuietHoursEnd:   prefs.QuietHoursEnd,
+		Timezone:        prefs.Timezone,
+		ChannelPriority: prefs.ChannelPriority,
+		Muted:           prefs.Muted,
+		DailyCap:        prefs.DailyCap,
+	})
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error saving notification preferences. err: %v", err))
+		return
+	}
+	helpers.RespondWithJson(w, http.StatusOK, DbPreferencesToModelsPreferences(saved))
+}
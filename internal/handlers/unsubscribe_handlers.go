@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// Unsubscribe links are opened from messages in a browser, so these handlers
+// answer with a small HTML page instead of JSON.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>RentRadar</title></head>
+<body style="font-family: Arial, sans-serif; color: #222; max-width: 480px; margin: 40px auto;">
+  <p>{{.Message}}</p>
+  {{- if .Confirm}}
+  {{- if .Alert}}
+  <form method="post"><input type="hidden" name="scope" value="alert"><button type="submit">Stop notifications for this alert</button></form>
+  {{- end}}
+  {{- if .Favorite}}
+  <form method="post"><input type="hidden" name="scope" value="favorite"><button type="submit">Stop updates about this listing</button></form>
+  {{- end}}
+  <form method="post"><input type="hidden" name="scope" value="all"><button type="submit">Stop all RentRadar notifications</button></form>
+  {{- end}}
+</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Message string
+	// Confirm shows the unsubscribe buttons
+	Confirm  bool
+	Alert    bool
+	Favorite bool
+}
+
+func respondWithUnsubscribePage(w http.ResponseWriter, code int, data unsubscribePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := unsubscribePage.Execute(w, data); err != nil {
+		log.Printf("error writing unsubscribe page %v", err)
+	}
+}
+
+// parseUnsubscribeToken responds and returns false when the token in the url can't be used.
+func (apiConfig *Config) parseUnsubscribeToken(w http.ResponseWriter, r *http.Request) (notification.Unsubscription, bool) {
+	if apiConfig.Unsubscriber == nil {
+		respondWithUnsubscribePage(w, http.StatusServiceUnavailable, unsubscribePageData{Message: "Unsubscribing is not available right now. Please try again later."})
+		return notification.Unsubscription{}, false
+	}
+	unsubscription, err := apiConfig.Unsubscriber.Parse(chi.URLParam(r, "token"))
+	if err != nil {
+		respondWithUnsubscribePage(w, http.StatusBadRequest, unsubscribePageData{Message: "This unsubscribe link is invalid or has expired."})
+		return notification.Unsubscription{}, false
+	}
+	return unsubscription, true
+}
+
+// ---------- Confirm Unsubscribe ----------
+// Shows what the link turns off without changing anything, so link
+// previews and mail scanners can't unsubscribe anyone.
+func (apiConfig *Config) GetUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	unsubscription, ok := apiConfig.parseUnsubscribeToken(w, r)
+	if !ok {
+		return
+	}
+	message := "Stop all RentRadar notifications?"
+	if unsubscription.AlertID.Valid {
+		message = "Stop notifications for this alert, or for everything?"
+	}
+	if unsubscription.ListingID.Valid {
+		message = "Stop updates about this saved listing, or all notifications?"
+	}
+	respondWithUnsubscribePage(w, http.StatusOK, unsubscribePageData{
+		Message:  message,
+		Confirm:  true,
+		Alert:    unsubscription.AlertID.Valid,
+		Favorite: unsubscription.ListingID.Valid,
+	})
+}
+
+// ---------- Unsubscribe ----------
+// scope=alert disables the token's alert, scope=favorite removes the token's
+// listing from the user's favorites and scope=all mutes every notification.
+// Without a scope, e.g. for RFC 8058 one-click POSTs from mail clients, the
+// narrowest scope the token has is used.
+func (apiConfig *Config) PostUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	unsubscription, ok := apiConfig.parseUnsubscribeToken(w, r)
+	if !ok {
+		return
+	}
+	userID, alertID, listingID := unsubscription.UserID, unsubscription.AlertID, unsubscription.ListingID
+	scope := r.FormValue("scope")
+	if scope == "" {
+		switch {
+		case alertID.Valid:
+			scope = "alert"
+		case listingID.Valid:
+			scope = "favorite"
+		default:
+			scope = "all"
+		}
+	}
+
+	switch {
+	case scope == "alert" && alertID.Valid:
+		alert, err := apiConfig.DB.GetAlert(r.Context(), alertID.UUID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && alert.UserID != userID) {
+			respondWithUnsubscribePage(w, http.StatusNotFound, unsubscribePageData{Message: "This alert no longer exists."})
+			return
+		}
+		if err != nil {
+			respondWithUnsubscribePage(w, http.StatusInternalServerError, unsubscribePageData{Message: fmt.Sprintf("error getting alert. err: %v", err)})
+			return
+		}
+		err = apiConfig.DB.DisableAlert(r.Context(), database.DisableAlertParams{
+			ID:             alert.ID,
+			DisabledReason: sql.NullString{Valid: true, String: "unsubscribed"},
+		})
+		if err != nil {
+			respondWithUnsubscribePage(w, http.StatusInternalServerError, unsubscribePageData{Message: fmt.Sprintf("error disabling alert. err: %v", err)})
+			return
+		}
+		respondWithUnsubscribePage(w, http.StatusOK, unsubscribePageData{Message: "You won't get notifications for this alert anymore."})
+	case scope == "favorite" && listingID.Valid:
+		err := apiConfig.DB.DeleteFavorite(r.Context(), database.DeleteFavoriteParams{UserID: userID, ListingID: listingID.UUID})
+		if err != nil {
+			respondWithUnsubscribePage(w, http.StatusInternalServerError, unsubscribePageData{Message: fmt.Sprintf("error removing favorite. err: %v", err)})
+			return
+		}
+		respondWithUnsubscribePage(w, http.StatusOK, unsubscribePageData{Message: "The listing was removed from your favorites, so you won't get updates about it anymore."})
+	case scope == "all":
+		prefs, err := notification.GetPreferences(r.Context(), apiConfig.DB, userID)
+		if err != nil {
+			respondWithUnsubscribePage(w, http.StatusInternalServerError, unsubscribePageData{Message: err.Error()})
+			return
+		}
+		_, err = apiConfig.DB.UpsertNotificationPreferences(r.Context(), database.UpsertNotificationPreferencesParams{
+			UserID:          userID,
+			QuietHoursStart: prefs.QuietHoursStart,
+			QuietHoursEnd:   prefs.QuietHoursEnd,
+			Timezone:        prefs.Timezone,
+			ChannelPriority: prefs.ChannelPriority,
+			Muted:           true,
+			DailyCap:        prefs.DailyCap,
+		})
+		if err != nil {
+			respondWithUnsubscribePage(w, http.StatusInternalServerError, unsubscribePageData{Message: fmt.Sprintf("error saving notification preferences. err: %v", err)})
+			return
+		}
+		respondWithUnsubscribePage(w, http.StatusOK, unsubscribePageData{Message: "You won't get any RentRadar notifications anymore. Turn them back on from your notification settings."})
+	default:
+		respondWithUnsubscribePage(w, http.StatusBadRequest, unsubscribePageData{Message: "Choose what to unsubscribe from."})
+	}
+}
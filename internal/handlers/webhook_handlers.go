@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/muhammadolammi/rentradar/internal/helpers"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// webhook bodies are small, anything bigger isn't from a provider
+const maxWebhookBody = 1 << 20
+
+// readSignedBody reads the request body and checks its hex HMAC against the
+// signature header. It responds and returns false when the request must be rejected.
+func readSignedBody(w http.ResponseWriter, r *http.Request, secret, signature string, newHash func() hash.Hash) ([]byte, bool) {
+	if secret == "" {
+		helpers.RespondWithError(w, http.StatusServiceUnavailable, "webhook not configured")
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error reading body. err: %v", err))
+		return nil, false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || signature == "" {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "missing or invalid signature")
+		return nil, false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "missing or invalid signature")
+		return nil, false
+	}
+	return body, true
+}
+
+// recordDeliveryStatuses stores the updates and responds to the provider.
+func (apiConfig *Config) recordDeliveryStatuses(w http.ResponseWriter, r *http.Request, updates []notification.DeliveryStatus) {
+	for _, update := range updates {
+		if err := notification.RecordDeliveryStatus(r.Context(), apiConfig.DB, update); err != nil {
+			// a non 2xx response makes the provider retry the webhook
+			helpers.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error recording delivery status. err: %v", err))
+			return
+		}
+	}
+	helpers.RespondWithJson(w, http.StatusOK, "ok")
+}
+
+// ---------- Email Delivery Webhook ----------
+// Expects {"message_id", "event", "reason"} signed with a hex HMAC-SHA256 of
+// the body in the X-Webhook-Signature header.
+func (apiConfig *Config) EmailWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	signature := strings.TrimPrefix(r.Header.Get("X-Webhook-Signature"), "sha256=")
+	body, ok := readSignedBody(w, r, apiConfig.EmailWebhookSecret, signature, sha256.New)
+	if !ok {
+		return
+	}
+	event := struct {
+		MessageID string `json:"message_id"`
+		Event     string `json:"event"`
+		Reason    string `json:"reason"`
+	}{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error decoding webhook. err: %v", err))
+		return
+	}
+
+	status := ""
+	switch strings.ToLower(event.Event) {
+	case "delivered":
+		status = notification.StatusDelivered
+	case "open", "opened":
+		status = notification.StatusRead
+	case "bounce", "bounced", "hard_bounce":
+		status = notification.StatusBounced
+	case "complaint", "spam":
+		// the recipient marked us as spam, stop emailing them
+		status = notification.StatusBounced
+		if event.Reason == "" {
+			event.Reason = "spam complaint"
+		}
+	case "dropped", "failed":
+		status = notification.StatusFailed
+	default:
+		helpers.RespondWithJson(w, http.StatusOK, "ignored")
+		return
+	}
+
+	// we store the Message-ID header with its angle brackets
+	messageID := event.MessageID
+	if !strings.HasPrefix(messageID, "<") {
+		messageID = "<" + messageID + ">"
+	}
+	apiConfig.recordDeliveryStatuses(w, r, []notification.DeliveryStatus{{
+		ContactMethod:     "email",
+		ProviderMessageID: messageID,
+		Status:            status,
+		Reason:            event.Reason,
+	}})
+}
+
+// ---------- SMS Delivery Webhook ----------
+// Termii style delivery reports, signed with a hex HMAC-SHA512 of the body in
+// the X-Termii-Signature header.
+func (apiConfig *Config) SMSWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := readSignedBody(w, r, apiConfig.SMSWebhookSecret, r.Header.Get("X-Termii-Signature"), sha512.New)
+	if !ok {
+		return
+	}
+	report := struct {
+		MessageID string `json:"message_id"`
+		Status    string `json:"status"`
+	}{}
+	if err := json.Unmarshal(body, &report); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error decoding webhook. err: %v", err))
+		return
+	}
+
+	update := notification.DeliveryStatus{ContactMethod: "sms", ProviderMessageID: report.MessageID}
+	reportStatus := strings.ToLower(report.Status)
+	switch {
+	case reportStatus == "delivered":
+		update.Status = notification.StatusDelivered
+	case strings.Contains(reportStatus, "failed"), strings.Contains(reportStatus, "rejected"),
+		strings.Contains(reportStatus, "expired"), strings.Contains(reportStatus, "dnd"):
+		update.Status = notification.StatusFailed
+		update.Reason = report.Status
+	default:
+		// sent, queued and other in-flight states
+		helpers.RespondWithJson(w, http.StatusOK, "ignored")
+		return
+	}
+	apiConfig.recordDeliveryStatuses(w, r, []notification.DeliveryStatus{update})
+}
+
+// ---------- WhatsApp Webhook Verification ----------
+// Answers the Cloud API's subscription handshake.
+func (apiConfig *Config) WhatsAppWebhookVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if apiConfig.WhatsAppVerifyToken == "" || query.Get("hub.mode") != "subscribe" || query.Get("hub.verify_token") != apiConfig.WhatsAppVerifyToken {
+		helpers.RespondWithError(w, http.StatusForbidden, "invalid verify token")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(query.Get("hub.challenge")))
+}
+
+// ---------- WhatsApp Status Webhook ----------
+// Cloud API status notifications, signed with the app secret in the
+// X-Hub-Signature-256 header.
+func (apiConfig *Config) WhatsAppWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	body, ok := readSignedBody(w, r, apiConfig.WhatsAppAppSecret, signature, sha256.New)
+	if !ok {
+		return
+	}
+	payload := struct {
+		Entry []struct {
+			Changes []struct {
+				Value struct {
+					Statuses []struct {
+						ID     string `json:"id"`
+						Status string `json:"status"`
+						Errors []struct {
+							Code  int    `json:"code"`
+							Title string `json:"title"`
+						} `json:"errors"`
+					} `json:"statuses"`
+				} `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("error decoding webhook. err: %v", err))
+		return
+	}
+
+	updates := []notification.DeliveryStatus{}
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			for _, s := range change.Value.Statuses {
+				update := notification.DeliveryStatus{ContactMethod: "whatsapp", ProviderMessageID: s.ID}
+				switch s.Status {
+				case "delivered":
+					update.Status = notification.StatusDelivered
+				case "read":
+					update.Status = notification.StatusRead
+				case "failed":
+					update.Status = notification.StatusFailed
+					if len(s.Errors) > 0 {
+						update.Reason = fmt.Sprintf("whatsapp error %d: %s", s.Errors[0].Code, s.Errors[0].Title)
+					}
+				default:
+					continue
+				}
+				updates = append(updates, update)
+			}
+		}
+	}
+	apiConfig.recordDeliveryStatuses(w, r, updates)
+}
@@ -25,3 +25,12 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJson(w, code, map[string]string{"error": message})
 
 }
+
+// RespondWithFieldErrors responds 400 with a message for each invalid field
+// of the request body, keyed by its json name.
+func RespondWithFieldErrors(w http.ResponseWriter, fields map[string]string) {
+	RespondWithJson(w, http.StatusBadRequest, map[string]any{
+		"error":  "Some fields are invalid.",
+		"fields": fields,
+	})
+}
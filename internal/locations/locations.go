@@ -0,0 +1,214 @@
+package locations
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// Kinds are the levels of the hierarchy, from the top.
+var Kinds = []string{"state", "lga", "area", "neighbourhood"}
+
+//go:embed data/nigeria.json
+var dataFiles embed.FS
+
+// Place is one location in the embedded dataset. Its kind is the level it's
+// nested at.
+type Place struct {
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Children []Place  `json:"children"`
+}
+
+// Dataset returns the states in the embedded dataset.
+func Dataset() ([]Place, error) {
+	data, err := dataFiles.ReadFile("data/nigeria.json")
+	if err != nil {
+		return nil, fmt.Errorf("error reading locations dataset. err: %v", err)
+	}
+	states := []Place{}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("error decoding locations dataset. err: %v", err)
+	}
+	return states, nil
+}
+
+// Normalize reduces a location to the form its keys are stored in: lower case
+// words separated by single spaces, without punctuation.
+func Normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func slugify(s string) string {
+	return strings.ReplaceAll(Normalize(s), " ", "-")
+}
+
+// Seed upserts the embedded dataset into the locations table, then resolves
+// the listings and alerts that don't reference a location yet. It's safe to
+// run on every start.
+func Seed(ctx context.Context, db *database.Queries) error {
+	states, err := Dataset()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if err := seedPlace(ctx, db, state, uuid.NullUUID{}, "", 0); err != nil {
+			return err
+		}
+	}
+	return Backfill(ctx, db)
+}
+
+func seedPlace(ctx context.Context, db *database.Queries, place Place, parentID uuid.NullUUID, parentSlug string, depth int) error {
+	if depth >= len(Kinds) {
+		return fmt.Errorf("location %q is nested deeper than a %s", place.Name, Kinds[len(Kinds)-1])
+	}
+	slug := slugify(place.Name)
+	if parentSlug != "" {
+		slug = parentSlug + "/" + slug
+	}
+	keys := []string{Normalize(place.Name)}
+	for _, alias := range place.Aliases {
+		if key := Normalize(alias); key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	location, err := db.UpsertLocation(ctx, database.UpsertLocationParams{
+		Slug:     slug,
+		ParentID: parentID,
+		Name:     place.Name,
+		Kind:     Kinds[depth],
+		Depth:    int32(depth),
+		Keys:     keys,
+	})
+	if err != nil {
+		return fmt.Errorf("error seeding location %s. err: %v", slug, err)
+	}
+	for _, child := range place.Children {
+		err := seedPlace(ctx, db, child, uuid.NullUUID{UUID: location.ID, Valid: true}, slug, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve finds the location free text like "Lekki Phase 1, Lagos" refers to.
+// The first comma separated part that names a location is used; when several
+// places share that name, the later parts pick the one they're in, otherwise
+// the broadest one wins. It returns an invalid id when nothing matches.
+func Resolve(ctx context.Context, db *database.Queries, text string) (uuid.NullUUID, error) {
+	parts := []string{}
+	for _, part := range strings.Split(text, ",") {
+		if key := Normalize(part); key != "" {
+			parts = append(parts, key)
+		}
+	}
+	for i, part := range parts {
+		candidates, err := db.GetLocationsByKey(ctx, part)
+		if err != nil {
+			return uuid.NullUUID{}, fmt.Errorf("error resolving location. err: %v", err)
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		if len(candidates) > 1 && i+1 < len(parts) {
+			for _, candidate := range candidates {
+				within, err := isWithin(ctx, db, candidate.ID, parts[i+1:])
+				if err != nil {
+					return uuid.NullUUID{}, err
+				}
+				if within {
+					return uuid.NullUUID{UUID: candidate.ID, Valid: true}, nil
+				}
+			}
+		}
+		return uuid.NullUUID{UUID: candidates[0].ID, Valid: true}, nil
+	}
+	return uuid.NullUUID{}, nil
+}
+
+// isWithin reports whether one of the location's parents goes by one of keys.
+func isWithin(ctx context.Context, db *database.Queries, id uuid.UUID, keys []string) (bool, error) {
+	ancestors, err := db.GetLocationAncestors(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("error getting location ancestors. err: %v", err)
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID == id {
+			continue
+		}
+		for _, key := range keys {
+			if slices.Contains(ancestor.Keys, key) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ResolveAll resolves each of texts, skipping the ones that don't match a
+// location and duplicates.
+func ResolveAll(ctx context.Context, db *database.Queries, texts []string) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	for _, text := range texts {
+		id, err := Resolve(ctx, db, text)
+		if err != nil {
+			return nil, err
+		}
+		if id.Valid && !slices.Contains(ids, id.UUID) {
+			ids = append(ids, id.UUID)
+		}
+	}
+	return ids, nil
+}
+
+// Backfill resolves the free-text location of listings without a location id
+// and the locations of alerts without location ids.
+func Backfill(ctx context.Context, db *database.Queries) error {
+	listings, err := db.GetUnlocatedListings(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting unlocated listings. err: %v", err)
+	}
+	for _, listing := range listings {
+		id, err := Resolve(ctx, db, listing.Location)
+		if err != nil {
+			return err
+		}
+		if !id.Valid {
+			continue
+		}
+		err = db.SetListingLocation(ctx, database.SetListingLocationParams{ID: listing.ID, LocationID: id})
+		if err != nil {
+			return fmt.Errorf("error setting listing location. err: %v", err)
+		}
+	}
+
+	alerts, err := db.GetUnlocatedAlerts(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting unlocated alerts. err: %v", err)
+	}
+	for _, alert := range alerts {
+		ids, err := ResolveAll(ctx, db, alert.Locations)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		err = db.SetAlertLocations(ctx, database.SetAlertLocationsParams{ID: alert.ID, LocationIDs: ids})
+		if err != nil {
+			return fmt.Errorf("error setting alert locations. err: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Message is a single payload travelling through a Broker.
+type Message struct {
+	ID   string
+	Body []byte
+	// Attempts is how many times the message has been delivered, including this delivery
+	Attempts int
+	// delivery is the broker specific handle used to ack or nack the message
+	delivery any
+}
+
+// Broker is the transport between the API, which publishes notifications,
+// and the worker pool, which consumes them.
+type Broker interface {
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Consume delivers messages from the queue until ctx is cancelled, the
+	// broker is closed or its connection is lost; consuming again reconnects.
+	// It returns ErrBrokerClosed once the broker is closed. Every message must
+	// be acked or nacked.
+	Consume(ctx context.Context, queue string) (<-chan Message, error)
+	Ack(msg Message) error
+	// Nack returns the message to the queue when requeue is true, otherwise it
+	// is moved to the queue's dead-letter queue.
+	Nack(msg Message, requeue bool) error
+	// DeadLetters lists the messages dead-lettered from queue without removing them.
+	DeadLetters(ctx context.Context, queue string) ([]Message, error)
+	// Replay moves the dead-lettered message with the given id back onto queue.
+	Replay(ctx context.Context, queue, id string) error
+	Close() error
+}
+
+// ErrMessageNotFound is returned when replaying a message that isn't dead-lettered.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrBrokerClosed is returned when publishing to or consuming from a closed broker.
+var ErrBrokerClosed = errors.New("broker closed")
+
+// NewBroker returns the broker selected by kind: "rabbitmq" (the default) or
+// "memory" for a single process setup such as tests.
+func NewBroker(kind, rabbitmqURL string) (Broker, error) {
+	switch kind {
+	case "", "rabbitmq":
+		if rabbitmqURL == "" {
+			return nil, fmt.Errorf("rabbitmq broker needs a rabbitmq url")
+		}
+		return NewRabbitMQBroker(rabbitmqURL)
+	case "memory":
+		return NewMemoryBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown notification broker: %s", kind)
+	}
+}
@@ -0,0 +1,194 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// Alert frequencies
+const (
+	FrequencyInstant = "instant"
+	FrequencyHourly  = "hourly"
+	FrequencyDaily   = "daily"
+)
+
+// Frequencies lists every alert frequency.
+var Frequencies = []string{FrequencyInstant, FrequencyHourly, FrequencyDaily}
+
+// dailyDigestHour is the hour, Lagos time, daily digests go out.
+const dailyDigestHour = 8
+
+// Lagos is West Africa Time. Nigeria has no daylight saving, so a fixed zone
+// avoids depending on the host's tz database.
+var Lagos = time.FixedZone("WAT", 60*60)
+
+// digestWindowEnd returns the end of the latest complete digest window for the
+// frequency. Hourly windows end on the hour, daily ones at dailyDigestHour.
+func digestWindowEnd(frequency string, now time.Time) time.Time {
+	if frequency == FrequencyHourly {
+		return now.Truncate(time.Hour)
+	}
+	local := now.In(Lagos)
+	end := time.Date(local.Year(), local.Month(), local.Day(), dailyDigestHour, 0, 0, 0, Lagos)
+	if end.After(now) {
+		end = end.AddDate(0, 0, -1)
+	}
+	return end
+}
+
+// StartDigestScheduler checks for held matches every interval and rolls
+// everything from complete hourly and daily windows into one digest per user
+// and contact. Claiming is transactional, so running it on several instances
+// or after a restart never sends a match twice.
+func (config *Config) StartDigestScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, frequency := range []string{FrequencyHourly, FrequencyDaily} {
+					sent, err := config.SendDigests(ctx, frequency, digestWindowEnd(frequency, now))
+					if err != nil {
+						log.Printf("digests: error sending %s digests. err: %v", frequency, err)
+					}
+					if sent > 0 {
+						log.Printf("digests: sent %d %s digest(s)", sent, frequency)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// digestKey groups held matches that go out in the same digest.
+type digestKey struct {
+	userID        uuid.UUID
+	contactMethod string
+	contact       string
+}
+
+// SendDigests rolls every match held for alerts with the frequency and created
+// before the given time into one digest notification per user and contact,
+// then publishes the digests. It returns how many digests were created.
+func (config *Config) SendDigests(ctx context.Context, frequency string, before time.Time) (int, error) {
+	tx, err := config.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction. err: %v", err)
+	}
+	defer tx.Rollback()
+	qtx := config.DB.WithTx(tx)
+
+	// matches held while an alert was paused, disabled or expired never go
+	// out, not even once it's resumed
+	if err := qtx.SuppressInactiveHeldNotifications(ctx); err != nil {
+		return 0, fmt.Errorf("error suppressing held notifications of inactive alerts. err: %v", err)
+	}
+	held, err := qtx.ClaimHeldNotifications(ctx, database.ClaimHeldNotificationsParams{
+		Frequency: frequency,
+		Before:    before,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error claiming held notifications. err: %v", err)
+	}
+
+	keys := []digestKey{}
+	groups := map[digestKey][]database.Notification{}
+	for _, dbNotification := range held {
+		key := digestKey{dbNotification.UserID, dbNotification.ContactMethod, dbNotification.Contact}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], dbNotification)
+	}
+
+	digests := []Notification{}
+	for _, key := range keys {
+		digest, err := config.createDigest(ctx, qtx, key, frequency, groups[key])
+		if err != nil {
+			return 0, err
+		}
+		digests = append(digests, digest)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing digests. err: %v", err)
+	}
+
+	// digests left pending here are picked up by the sweeper
+	publisher := NewPublisher(config.Broker)
+	for _, digest := range digests {
+		if err := publisher.Publish(ctx, digest); err != nil {
+			log.Printf("digests: error publishing digest %s. err: %v", digest.ID, err)
+			continue
+		}
+		if err := config.DB.MarkNotificationEnqueued(ctx, digest.ID); err != nil {
+			log.Printf("digests: error marking digest %s enqueued. err: %v", digest.ID, err)
+		}
+	}
+	return len(digests), nil
+}
+
+// createDigest writes the digest notification for one group of held matches
+// and marks the matches as digested.
+func (config *Config) createDigest(ctx context.Context, qtx *database.Queries, key digestKey, frequency string, matches []database.Notification) (Notification, error) {
+	listings := []database.Listing{}
+	ids := []uuid.UUID{}
+	alertID := matches[0].AlertID
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+		// only point the digest at an alert when every match came from it
+		if match.AlertID != alertID {
+			alertID = uuid.NullUUID{}
+		}
+		if !match.ListingID.Valid {
+			continue
+		}
+		listing, err := qtx.GetListing(ctx, match.ListingID.UUID)
+		if err != nil {
+			return Notification{}, fmt.Errorf("error getting digest listing. err: %v", err)
+		}
+		listings = append(listings, listing)
+	}
+
+	data := NewDigestTemplateData(listings, frequency, config.ListingBaseURL)
+	// digests of several alerts unsubscribe from everything
+	url, err := config.Unsubscriber.URL(key.userID, alertID)
+	if err != nil {
+		return Notification{}, err
+	}
+	data.UnsubscribeURL = url
+	content, err := RenderNotification(EventDigest, key.contactMethod, data)
+	if err != nil {
+		return Notification{}, fmt.Errorf("error rendering digest. err: %v", err)
+	}
+	digest, err := qtx.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:         key.userID,
+		AlertID:        alertID,
+		Contact:        key.contact,
+		ContactMethod:  key.contactMethod,
+		Status:         "pending",
+		Subject:        content.Subject,
+		Body:           content.Body,
+		Event:          EventDigest,
+		HtmlBody:       content.HTMLBody,
+		UnsubscribeUrl: data.UnsubscribeURL,
+	})
+	if err != nil {
+		return Notification{}, fmt.Errorf("error creating digest. err: %v", err)
+	}
+	err = qtx.MarkNotificationsDigested(ctx, database.MarkNotificationsDigestedParams{
+		DigestID: uuid.NullUUID{UUID: digest.ID, Valid: true},
+		Ids:      ids,
+	})
+	if err != nil {
+		return Notification{}, fmt.Errorf("error marking notifications digested. err: %v", err)
+	}
+	return DbNotificationToModelsNotification(digest), nil
+}
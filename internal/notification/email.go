@@ -0,0 +1,228 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTP TLS modes
+const (
+	// SMTPTLSStartTLS upgrades a plain connection with STARTTLS, usually on port 587.
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit connects over TLS from the start, usually on port 465.
+	SMTPTLSImplicit = "tls"
+	// SMTPTLSNone sends in plain text. Only use it for local servers.
+	SMTPTLSNone = "none"
+)
+
+// EmailSender sends notifications as multipart text and HTML email over SMTP.
+type EmailSender struct {
+	smtp SMTPModel
+}
+
+func NewEmailSender(smtpModel SMTPModel) *EmailSender {
+	if smtpModel.Port == 0 {
+		smtpModel.Port = 587
+	}
+	if smtpModel.TLSMode == "" {
+		smtpModel.TLSMode = SMTPTLSStartTLS
+	}
+	if smtpModel.From == "" {
+		smtpModel.From = smtpModel.UserName
+	}
+	return &EmailSender{smtp: smtpModel}
+}
+
+// Send delivers the notification and returns the Message-ID it was sent with.
+func (s *EmailSender) Send(ctx context.Context, notification Notification) (string, error) {
+	from, err := mail.ParseAddress(s.smtp.From)
+	if err != nil {
+		return "", fmt.Errorf("invalid smtp from address %q. err: %v", s.smtp.From, err)
+	}
+	to, err := mail.ParseAddress(notification.Contact)
+	if err != nil {
+		return "", Permanent(fmt.Errorf("invalid email address %q. err: %v", notification.Contact, err))
+	}
+
+	messageID := newMessageID(from.Address)
+	msg, err := buildEmail(from, to, messageID, notification)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if s.smtp.UserName != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			auth := smtp.PlainAuth("", s.smtp.UserName, s.smtp.Password, s.smtp.Server)
+			if err := client.Auth(auth); err != nil {
+				return "", fmt.Errorf("error authenticating with smtp server. err: %v", err)
+			}
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return "", fmt.Errorf("error sending MAIL FROM. err: %v", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		// 5xx replies mean the server will never take this recipient
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return "", Permanent(fmt.Errorf("smtp server rejected recipient %s. err: %v", to.Address, err))
+		}
+		return "", fmt.Errorf("error sending RCPT TO. err: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", fmt.Errorf("error starting DATA. err: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return "", fmt.Errorf("error writing message. err: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("error finishing message. err: %v", err)
+	}
+	if err := client.Quit(); err != nil {
+		return "", fmt.Errorf("error closing smtp session. err: %v", err)
+	}
+	return messageID, nil
+}
+
+// dial connects to the configured server and applies the TLS mode.
+func (s *EmailSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.smtp.Server, strconv.Itoa(s.smtp.Port))
+	tlsConfig := &tls.Config{ServerName: s.smtp.Server}
+	if s.smtp.TLSConfig != nil {
+		tlsConfig = s.smtp.TLSConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = s.smtp.Server
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.smtp.TLSMode == SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to smtp server %s. err: %v", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.smtp.Server)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error starting smtp session. err: %v", err)
+	}
+	if s.smtp.TLSMode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("error starting tls. err: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// buildEmail renders a multipart/alternative message with a text and an HTML part.
+func buildEmail(from, to *mail.Address, messageID string, notification Notification) ([]byte, error) {
+	htmlBody := notification.HTMLBody
+	if htmlBody == "" {
+		htmlBody = textToHTML(notification.Body)
+	}
+	boundary := randomHex(16)
+
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", notification.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+	}
+	if notification.UnsubscribeURL != "" {
+		// RFC 8058 one-click unsubscribe: mail clients POST to the link
+		headers = append(headers,
+			[2]string{"List-Unsubscribe", "<" + notification.UnsubscribeURL + ">"},
+			[2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		)
+	}
+	headers = append(headers,
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": boundary})},
+	)
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", notification.Body},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&buf)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("error encoding email body. err: %v", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("error encoding email body. err: %v", err)
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// textToHTML turns a plain text body into minimal HTML.
+func textToHTML(text string) string {
+	escaped := html.EscapeString(text)
+	return "<html><body><p>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</p></body></html>"
+}
+
+func newMessageID(fromAddress string) string {
+	domain := "rentradar"
+	if at := strings.LastIndex(fromAddress, "@"); at != -1 {
+		domain = fromAddress[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", uuid.New(), domain)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,26 @@
+package notification
+
+import "errors"
+
+// PermanentError marks a delivery failure that retrying can't fix, such as an
+// unknown contact method or an address the provider rejects outright.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so workers dead-letter the notification instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
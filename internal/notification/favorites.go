@@ -0,0 +1,79 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// NotifyFavorites records a pending notification of the event for every user
+// who saved the listing and returns them ready for the notification pipeline.
+// Each goes to the first channel in the user's channel priority they have a
+// contact for, or email. oldPrice is the price before a price drop or rise.
+// Users who already get one of the notified notifications, e.g. from an
+// alert, are skipped.
+func NotifyFavorites(ctx context.Context, db *database.Queries, listing database.Listing, event string, oldPrice int64, listingBaseURL string, unsubscriber *Unsubscriber, notified []Notification) ([]Notification, error) {
+	users, err := db.GetListingFavoriteUsers(ctx, listing.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting listing favorites. err: %v", err)
+	}
+	skip := map[uuid.UUID]bool{listing.AgentID: true}
+	for _, n := range notified {
+		skip[n.UserID] = true
+	}
+
+	notifications := []Notification{}
+	for _, user := range users {
+		if skip[user.ID] {
+			continue
+		}
+		prefs, err := GetPreferences(ctx, db, user.ID)
+		if err != nil {
+			return notifications, err
+		}
+		channel, contact := "", ""
+		for _, candidate := range append(prefs.ChannelPriority, "email") {
+			if contact, err = contactFor(candidate, user); err == nil {
+				channel = candidate
+				break
+			}
+		}
+		if channel == "" {
+			log.Printf("skipping favorite of user %s. err: %v", user.ID, err)
+			continue
+		}
+
+		data := NewTemplateData(listing, database.Alert{}, listingBaseURL)
+		data.Favorite = true
+		data.OldPrice = oldPrice
+		// the link stops updates about this listing, not every notification
+		data.UnsubscribeURL, err = unsubscriber.FavoriteURL(user.ID, listing.ID)
+		if err != nil {
+			return notifications, err
+		}
+		content, err := RenderNotification(event, channel, data)
+		if err != nil {
+			return notifications, fmt.Errorf("error rendering notification. err: %v", err)
+		}
+		dbNotification, err := db.CreateNotification(ctx, database.CreateNotificationParams{
+			UserID:         user.ID,
+			ListingID:      uuid.NullUUID{UUID: listing.ID, Valid: true},
+			Contact:        contact,
+			ContactMethod:  channel,
+			Status:         "pending",
+			Subject:        content.Subject,
+			Body:           content.Body,
+			Event:          event,
+			HtmlBody:       content.HTMLBody,
+			UnsubscribeUrl: data.UnsubscribeURL,
+		})
+		if err != nil {
+			return notifications, fmt.Errorf("error creating notification. err: %v", err)
+		}
+		notifications = append(notifications, DbNotificationToModelsNotification(dbNotification))
+	}
+	return notifications, nil
+}
@@ -1,83 +1,106 @@
 package notification
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"math"
-	"net/smtp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/muhammadolammi/rentradar/internal/database"
 )
 
-func sendEmail(to, subject, body string, smtpModel SMTPModel) error {
-	from := smtpModel.UserName
-	password := smtpModel.Password
-	msg := []byte("To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		body + "\r\n")
-
-	auth := smtp.PlainAuth("", from, password, smtpModel.Server)
-	err := smtp.SendMail("smtp.example.com:587", auth, from, []string{to}, msg)
+// SendNotification applies the user's notification preferences and then
+// dispatches the notification, returning the provider's id for
+// the sent message. Muted users get ErrMuted and quiet hours or a reached daily
+// cap give a DeferredError, all before anything is sent. When a channel fails
+// permanently the next one in the user's channel priority is tried, and the
+// notification is moved to the channel that sent it.
+func (config *Config) SendNotification(ctx context.Context, notification Notification) (string, error) {
+	// without a database there are no preferences to apply
+	if config.DB == nil {
+		return config.send(ctx, notification)
+	}
+	prefs, err := GetPreferences(ctx, config.DB, notification.UserID)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
-}
-
-func sendWithRetry(senderFunction func() error, retries int) error {
-	var err error
-	for i := range retries {
-		err = senderFunction()
-		if err == nil {
-			return nil
-		}
-		time.Sleep(time.Duration(math.Pow(2, float64(i))) * time.Second)
+	if err := config.checkPreferences(ctx, prefs, time.Now()); err != nil {
+		return "", err
 	}
-	return err
-}
-
-// Dispatch notification based on contact type
-func SendNotification(notification Notification, smtpMdel SMTPModel) error {
-	var senderFunc func() error
 
-	switch notification.ContactMethod {
-	case "email":
-		senderFunc = func() error {
-			return sendEmail(notification.Contact, notification.Subject, notification.Body, smtpMdel)
+	var sendErr error
+	for _, channel := range channelOrder(prefs, notification.ContactMethod) {
+		candidate := notification
+		if channel != notification.ContactMethod {
+			candidate, err = config.onChannel(ctx, notification, channel)
+			if err != nil {
+				log.Printf("notification %s: can't fall back to %s. err: %v", notification.ID, channel, err)
+				continue
+			}
+		}
+		messageID, err := config.send(ctx, candidate)
+		if err != nil && !IsPermanent(err) {
+			// transient errors are retried on the same channel
+			return "", err
 		}
-	case "whatsapp":
-		senderFunc = func() error {
-			// replace with actual WhatsApp sending logic
-			log.Println("Simulating WhatsApp send...")
-			return fmt.Errorf("WhatsApp not implemented yet")
+		if err != nil {
+			sendErr = err
+			continue
 		}
-	case "sms":
-		senderFunc = func() error {
-			// replace with actual SMS sending logic
-			log.Println("Simulating SMS send...")
-			return fmt.Errorf("SMS not implemented yet")
+		if channel != notification.ContactMethod {
+			// delivery webhooks look notifications up by their channel
+			if err := config.DB.UpdateNotificationChannel(ctx, database.UpdateNotificationChannelParams{
+				ID:            candidate.ID,
+				ContactMethod: candidate.ContactMethod,
+				Contact:       candidate.Contact,
+				Subject:       candidate.Subject,
+				Body:          candidate.Body,
+				HtmlBody:      candidate.HTMLBody,
+			}); err != nil {
+				log.Printf("notification %s: error moving to %s. err: %v", notification.ID, channel, err)
+			}
 		}
-	default:
-		return fmt.Errorf("unknown contact method: %s", notification.ContactMethod)
+		return messageID, nil
 	}
+	return "", sendErr
+}
 
-	// Call generic retry logic
-	return sendWithRetry(senderFunc, 3)
+// send dispatches the notification to the sender for its contact method. It
+// tries once; the worker retries transient failures later.
+func (config *Config) send(ctx context.Context, notification Notification) (string, error) {
+	sender, ok := config.Senders[notification.ContactMethod]
+	if !ok {
+		return "", Permanent(fmt.Errorf("no sender configured for contact method: %s", notification.ContactMethod))
+	}
+	return sender.Send(ctx, notification)
 }
 
 // Notification  Model Helper
 func DbNotificationToModelsNotification(dbNotification database.Notification) Notification {
 	return Notification{
-		ID:            dbNotification.ID,
-		UserID:        dbNotification.UserID,
-		Status:        dbNotification.Status,
-		ListingID:     dbNotification.ListingID,
-		SentAt:        dbNotification.SentAt,
-		ContactMethod: dbNotification.ContactMethod,
-		Contact:       dbNotification.Contact,
-		Subject:       dbNotification.Subject,
-		Body:          dbNotification.Body,
+		ID:                dbNotification.ID,
+		UserID:            dbNotification.UserID,
+		Status:            dbNotification.Status,
+		ListingID:         dbNotification.ListingID,
+		SentAt:            dbNotification.SentAt,
+		ContactMethod:     dbNotification.ContactMethod,
+		Contact:           dbNotification.Contact,
+		Subject:           dbNotification.Subject,
+		Body:              dbNotification.Body,
+		AlertID:           dbNotification.AlertID,
+		CreatedAt:         dbNotification.CreatedAt,
+		Attempts:          dbNotification.Attempts,
+		LastError:         dbNotification.LastError,
+		ProviderMessageID: dbNotification.ProviderMessageID,
+		DeliveredAt:       dbNotification.DeliveredAt,
+		ReadAt:            dbNotification.ReadAt,
+		Event:             dbNotification.Event,
+		DigestID:          dbNotification.DigestID,
+		HTMLBody:          dbNotification.HtmlBody,
+		DeliverAfter:      dbNotification.DeliverAfter,
+		UnsubscribeURL:    dbNotification.UnsubscribeUrl,
 	}
 }
 
@@ -88,3 +111,38 @@ func DbNotificationsToModelsNotifications(dbNotifications []database.Notificatio
 	}
 	return notications
 }
+
+// formatNaira renders a price in whole naira with thousand separators, e.g. ₦1,500,000.
+func formatNaira(price int64) string {
+	digits := strconv.FormatInt(price, 10)
+	sign := ""
+	if price < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	out := []byte{}
+	for i, d := range []byte(digits) {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, d)
+	}
+	return sign + "₦" + string(out)
+}
+
+// formatAlertArea describes where an alert looks, e.g. "in Yaba or Surulere
+// within 5 km of your pin".
+func formatAlertArea(alert database.Alert) string {
+	parts := []string{}
+	if n := len(alert.Locations); n > 0 {
+		places := alert.Locations[0]
+		if n > 1 {
+			places = strings.Join(alert.Locations[:n-1], ", ") + " or " + alert.Locations[n-1]
+		}
+		parts = append(parts, "in "+places)
+	}
+	if alert.RadiusKm.Valid {
+		parts = append(parts, fmt.Sprintf("within %s km of your pin", strconv.FormatFloat(alert.RadiusKm.Float64, 'f', -1, 64)))
+	}
+	return strings.Join(parts, " ")
+}
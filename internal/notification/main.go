@@ -3,65 +3,119 @@ package notification
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
 
-	"github.com/joho/godotenv"
 	"github.com/muhammadolammi/rentradar/internal/database"
 )
 
-func SendNotifications() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("error loading env. err:" + err.Error())
-		return
-	}
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Println("empty dbURL")
-		return
-	}
-	rabbitmq_url := os.Getenv("RABBITMQ_URL")
-	if rabbitmq_url == "" {
-		log.Println("there is no rabbitmq_url provided kindly provide a rabbitmq_url")
-		return
-	}
+// ConfigFromEnv builds the notification service config from the env.
+// SMTP_PORT defaults to 587, SMTP_TLS to starttls and SMTP_FROM to
+// SMTP_USERNAME. SMS is enabled when SMS_PROVIDER_URL is set and WhatsApp
+// when WHATSAPP_PHONE_NUMBER_ID is set. LISTING_BASE_URL is needed to link to
+// listings from digests and WhatsApp messages, and PUBLIC_API_URL with
+// UNSUBSCRIBE_SECRET to sign the unsubscribe links in them.
+func ConfigFromEnv(db *sql.DB, broker Broker) (*Config, error) {
+	var err error
 	smtp_server := os.Getenv("SMTP_SERVER")
 	if smtp_server == "" {
-		log.Println("there is no smtp_server provided kindly provide a smtp_server")
-		return
+		return nil, fmt.Errorf("there is no smtp_server provided kindly provide a smtp_server")
 	}
 	smtp_username := os.Getenv("SMTP_USERNAME")
 	if smtp_username == "" {
-		log.Println("there is no smtp_username provided kindly provide a smtp_username")
-		return
+		return nil, fmt.Errorf("there is no smtp_username provided kindly provide a smtp_username")
 	}
 	smtp_password := os.Getenv("SMTP_PASSWORD")
 	if smtp_password == "" {
-		log.Println("there is no smtp_password provided kindly provide a smtp_password")
-		return
+		return nil, fmt.Errorf("there is no smtp_password provided kindly provide a smtp_password")
+	}
+	smtp_port := 587
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		smtp_port, err = strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT %q. err: %v", port, err)
+		}
 	}
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		fmt.Println(err)
-		return
+	smtp_tls := os.Getenv("SMTP_TLS")
+	switch smtp_tls {
+	case "", SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return nil, fmt.Errorf("invalid SMTP_TLS %q, use starttls, tls or none", smtp_tls)
 	}
-	dbQueries := database.New(db)
 	smtpModel := SMTPModel{
 		Server:   smtp_server,
+		Port:     smtp_port,
 		Password: smtp_password,
 		UserName: smtp_username,
+		From:     os.Getenv("SMTP_FROM"),
+		TLSMode:  smtp_tls,
 	}
-	config := &Config{
-		DB:        dbQueries,
-		SMTPModel: smtpModel,
+	senders := map[string]Sender{
+		"email": NewEmailSender(smtpModel),
+	}
+	// sms is optional, without a provider sms notifications are dead-lettered
+	if sms_url := os.Getenv("SMS_PROVIDER_URL"); sms_url != "" {
+		sms_api_key := os.Getenv("SMS_API_KEY")
+		if sms_api_key == "" {
+			return nil, fmt.Errorf("there is no sms_api_key provided kindly provide a sms_api_key")
+		}
+		senders["sms"] = NewSMSSender(NewHTTPSMSProvider(sms_url, sms_api_key, os.Getenv("SMS_SENDER_ID")))
+	}
+	listing_base_url := os.Getenv("LISTING_BASE_URL")
+	if listing_base_url == "" {
+		return nil, fmt.Errorf("there is no listing_base_url provided kindly provide a listing_base_url")
 	}
-	//  This will start 3 pool to consume messages on the rabbitmq queue (rent_radar) and send notification on each message with retries.
-	config.startWorkerPool(3, "rent_radar")
+	public_api_url := os.Getenv("PUBLIC_API_URL")
+	if public_api_url == "" {
+		return nil, fmt.Errorf("there is no public_api_url provided kindly provide a public_api_url")
+	}
+	unsubscribe_secret := os.Getenv("UNSUBSCRIBE_SECRET")
+	if unsubscribe_secret == "" {
+		return nil, fmt.Errorf("there is no unsubscribe_secret provided kindly provide a unsubscribe_secret")
+	}
+	queries := database.New(db)
+	// whatsapp is optional too
+	if whatsapp_phone_number_id := os.Getenv("WHATSAPP_PHONE_NUMBER_ID"); whatsapp_phone_number_id != "" {
+		whatsapp_access_token := os.Getenv("WHATSAPP_ACCESS_TOKEN")
+		if whatsapp_access_token == "" {
+			return nil, fmt.Errorf("there is no whatsapp_access_token provided kindly provide a whatsapp_access_token")
+		}
+		whatsapp_template := os.Getenv("WHATSAPP_TEMPLATE")
+		if whatsapp_template == "" {
+			return nil, fmt.Errorf("there is no whatsapp_template provided kindly provide a whatsapp_template")
+		}
+		whatsapp := NewWhatsAppSender(queries, whatsapp_phone_number_id, whatsapp_access_token, whatsapp_template, listing_base_url)
+		if language := os.Getenv("WHATSAPP_TEMPLATE_LANGUAGE"); language != "" {
+			whatsapp.Language = language
+		}
+		// without a digest template whatsapp digests are dead-lettered
+		whatsapp.DigestTemplateName = os.Getenv("WHATSAPP_DIGEST_TEMPLATE")
+		// without these, rented and price change notifications fall back to the next channel
+		whatsapp.RentedTemplateName = os.Getenv("WHATSAPP_TEMPLATE_RENTED")
+		whatsapp.PriceDropTemplateName = os.Getenv("WHATSAPP_TEMPLATE_PRICE_DROP")
+		whatsapp.PriceRiseTemplateName = os.Getenv("WHATSAPP_TEMPLATE_PRICE_RISE")
+		senders["whatsapp"] = whatsapp
+	}
+	return &Config{
+		DB:        queries,
+		DBConn:    db,
+		SMTPModel: smtpModel,
+		Broker:    broker,
+		Senders:   senders,
+
+		ListingBaseURL: listing_base_url,
+		Unsubscriber:   NewUnsubscriber(public_api_url, unsubscribe_secret),
+	}, nil
 }
 
-func PublishNotifications() {}
-func main() {
-	SendNotifications()
-	PublishNotifications()
+// EnabledChannels lists the contact methods that have a sender configured, in
+// the order of Channels.
+func (config *Config) EnabledChannels() []string {
+	channels := []string{}
+	for _, channel := range Channels {
+		if _, ok := config.Senders[channel]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
 }
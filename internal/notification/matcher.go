@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// MatchListing finds every alert the listing satisfies and records a
+// notification for each one. Instant alerts get a pending notification, which
+// is returned ready to be handed to the notification pipeline; hourly and daily
+// alerts get a held one for the digest scheduler. listingBaseURL is used to
+// link to the listing and unsubscriber signs the link that turns the alert off.
+func MatchListing(ctx context.Context, db *database.Queries, listing database.Listing, listingBaseURL string, unsubscriber *Unsubscriber) ([]Notification, error) {
+	return matchAlerts(ctx, db, listing, EventNewMatch, 0, listingBaseURL, unsubscriber)
+}
+
+// MatchPriceDrop is MatchListing for a listing whose price dropped from
+// oldPrice: every alert the listing satisfies at its new price gets a
+// price_drop notification.
+func MatchPriceDrop(ctx context.Context, db *database.Queries, listing database.Listing, oldPrice int64, listingBaseURL string, unsubscriber *Unsubscriber) ([]Notification, error) {
+	return matchAlerts(ctx, db, listing, EventPriceDrop, oldPrice, listingBaseURL, unsubscriber)
+}
+
+func matchAlerts(ctx context.Context, db *database.Queries, listing database.Listing, event string, oldPrice int64, listingBaseURL string, unsubscriber *Unsubscriber) ([]Notification, error) {
+	alerts, err := db.GetMatchingAlerts(ctx, database.GetMatchingAlertsParams{
+		Price:        listing.Price,
+		Location:     listing.Location,
+		PropertyType: listing.PropertyType,
+		Bedrooms:     listing.Bedrooms,
+		Bathrooms:    listing.Bathrooms,
+		LocationID:   listing.LocationID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting matching alerts. err: %v", err)
+	}
+
+	notifications := []Notification{}
+	for _, alert := range alerts {
+		// agents don't need to be told about their own listings
+		if alert.UserID == listing.AgentID {
+			continue
+		}
+		if !MatchesCriteria(alert, listing) {
+			continue
+		}
+		user, err := db.GetUser(ctx, alert.UserID)
+		if err != nil {
+			return notifications, fmt.Errorf("error getting alert user. err: %v", err)
+		}
+		contact, err := contactFor(alert.ContactMethod, user)
+		if err != nil {
+			// one bad alert shouldn't stop the others from matching
+			log.Printf("skipping alert %s. err: %v", alert.ID, err)
+			continue
+		}
+
+		status := "pending"
+		if alert.Frequency != FrequencyInstant {
+			status = "held"
+		}
+		data := NewTemplateData(listing, alert, listingBaseURL)
+		data.OldPrice = oldPrice
+		data.UnsubscribeURL, err = unsubscriber.URL(user.ID, uuid.NullUUID{UUID: alert.ID, Valid: true})
+		if err != nil {
+			return notifications, err
+		}
+		content, err := RenderNotification(event, alert.ContactMethod, data)
+		if err != nil {
+			return notifications, fmt.Errorf("error rendering notification. err: %v", err)
+		}
+		dbNotification, err := db.CreateNotification(ctx, database.CreateNotificationParams{
+			UserID:         user.ID,
+			ListingID:      uuid.NullUUID{UUID: listing.ID, Valid: true},
+			AlertID:        uuid.NullUUID{UUID: alert.ID, Valid: true},
+			Contact:        contact,
+			ContactMethod:  alert.ContactMethod,
+			Status:         status,
+			Subject:        content.Subject,
+			Body:           content.Body,
+			Event:          event,
+			HtmlBody:       content.HTMLBody,
+			UnsubscribeUrl: data.UnsubscribeURL,
+		})
+		if err != nil {
+			return notifications, fmt.Errorf("error creating notification. err: %v", err)
+		}
+		if status == "held" {
+			continue
+		}
+		notifications = append(notifications, DbNotificationToModelsNotification(dbNotification))
+	}
+	return notifications, nil
+}
+
+// contactFor resolves where a notification to the user should be sent on a channel.
+func contactFor(contactMethod string, user database.User) (string, error) {
+	switch contactMethod {
+	case "email":
+		return user.Email, nil
+	case "sms", "whatsapp":
+		if !user.PhoneNumber.Valid || user.PhoneNumber.String == "" {
+			return "", fmt.Errorf("user %s has no phone number for %s alerts", user.ID, contactMethod)
+		}
+		return user.PhoneNumber.String, nil
+	default:
+		return "", fmt.Errorf("unknown contact method: %s", contactMethod)
+	}
+}
+
+// earthRadiusKm is the mean radius of the earth
+const earthRadiusKm = 6371.0
+
+// MatchesCriteria checks the alert criteria GetMatchingAlerts leaves out: the
+// radius around the alert's point and the include and exclude keywords.
+// Listings without coordinates never match an alert with a radius.
+func MatchesCriteria(alert database.Alert, listing database.Listing) bool {
+	if alert.RadiusKm.Valid {
+		if !listing.Latitude.Valid || !listing.Longtitude.Valid {
+			return false
+		}
+		distance := DistanceKm(alert.Latitude.Float64, alert.Longitude.Float64, listing.Latitude.Float64, listing.Longtitude.Float64)
+		if distance > alert.RadiusKm.Float64 {
+			return false
+		}
+	}
+
+	text := strings.ToLower(listing.Title + " " + listing.Description)
+	for _, keyword := range alert.IncludeKeywords {
+		if !strings.Contains(text, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+	for _, keyword := range alert.ExcludeKeywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return false
+		}
+	}
+	return true
+}
+
+// DistanceKm is the great-circle distance between two points in kilometres.
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,175 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// memoryQueueSize is how many unconsumed messages a memory queue holds before
+// publishing blocks.
+const memoryQueueSize = 1024
+
+// MemoryBroker is an in-process, channel backed Broker. Messages live only as
+// long as the process, so it is meant for tests and single process setups
+// without RabbitMQ.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	queues      map[string]chan Message
+	inflight    map[uint64]inflightMessage
+	deadLetters map[string][]Message
+	nextTag     uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type inflightMessage struct {
+	queue string
+	msg   Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:      map[string]chan Message{},
+		inflight:    map[uint64]inflightMessage{},
+		deadLetters: map[string][]Message{},
+		done:        make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) queue(name string) chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan Message, memoryQueueSize)
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, queue string, msg Message) error {
+	// copy the body so callers can't change a queued message
+	return b.enqueue(ctx, queue, Message{ID: msg.ID, Body: append([]byte(nil), msg.Body...)})
+}
+
+func (b *MemoryBroker) enqueue(ctx context.Context, queue string, msg Message) error {
+	select {
+	case <-b.done:
+		return ErrBrokerClosed
+	default:
+	}
+	select {
+	case b.queue(queue) <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.done:
+		return ErrBrokerClosed
+	}
+}
+
+func (b *MemoryBroker) Consume(ctx context.Context, queue string) (<-chan Message, error) {
+	select {
+	case <-b.done:
+		return nil, ErrBrokerClosed
+	default:
+	}
+	q := b.queue(queue)
+	msgs := make(chan Message)
+	go func() {
+		defer close(msgs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			case msg := <-q:
+				b.mu.Lock()
+				b.nextTag++
+				tag := b.nextTag
+				msg.Attempts++
+				msg.delivery = tag
+				b.inflight[tag] = inflightMessage{queue: queue, msg: msg}
+				b.mu.Unlock()
+
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					b.Nack(msg, true)
+					return
+				case <-b.done:
+					return
+				}
+			}
+		}
+	}()
+	return msgs, nil
+}
+
+// take removes the message from the inflight set.
+func (b *MemoryBroker) take(msg Message) (inflightMessage, error) {
+	tag, ok := msg.delivery.(uint64)
+	if !ok {
+		return inflightMessage{}, errors.New("message was not delivered by the memory broker")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	in, ok := b.inflight[tag]
+	if !ok {
+		return inflightMessage{}, errors.New("message already acknowledged")
+	}
+	delete(b.inflight, tag)
+	return in, nil
+}
+
+func (b *MemoryBroker) Ack(msg Message) error {
+	_, err := b.take(msg)
+	return err
+}
+
+func (b *MemoryBroker) Nack(msg Message, requeue bool) error {
+	in, err := b.take(msg)
+	if err != nil {
+		return err
+	}
+	msg = in.msg
+	msg.delivery = nil
+	if !requeue {
+		b.mu.Lock()
+		b.deadLetters[in.queue] = append(b.deadLetters[in.queue], msg)
+		b.mu.Unlock()
+		return nil
+	}
+	return b.enqueue(context.Background(), in.queue, msg)
+}
+
+func (b *MemoryBroker) DeadLetters(ctx context.Context, queue string) ([]Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message{}, b.deadLetters[queue]...), nil
+}
+
+func (b *MemoryBroker) Replay(ctx context.Context, queue, id string) error {
+	b.mu.Lock()
+	var replayed *Message
+	for i, msg := range b.deadLetters[queue] {
+		if msg.ID == id {
+			replayed = &msg
+			b.deadLetters[queue] = append(b.deadLetters[queue][:i:i], b.deadLetters[queue][i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	if replayed == nil {
+		return ErrMessageNotFound
+	}
+	return b.Publish(ctx, queue, *replayed)
+}
+
+func (b *MemoryBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
+}
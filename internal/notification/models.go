@@ -1,6 +1,9 @@
 package notification
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,24 +12,57 @@ import (
 
 type SMTPModel struct {
 	Server   string
+	Port     int
 	Password string
 	UserName string
+	// From is the sender address, e.g. "RentRadar <alerts@rentradar.ng>". Defaults to UserName.
+	From string
+	// TLSMode is one of SMTPTLSStartTLS (default), SMTPTLSImplicit or SMTPTLSNone
+	TLSMode string
+	// TLSConfig overrides the TLS settings, e.g. to trust a private CA
+	TLSConfig *tls.Config
+}
+
+// Sender delivers a notification over one contact method and returns the
+// provider's id for the sent message.
+type Sender interface {
+	Send(ctx context.Context, notification Notification) (string, error)
 }
 
 type Config struct {
-	DB          *database.Queries
-	SMTPModel   SMTPModel
-	RABBITMQUrl string
+	DB *database.Queries
+	// DBConn is used to run the sweeper's claim and mark in one transaction
+	DBConn    *sql.DB
+	SMTPModel SMTPModel
+	Broker    Broker
+	// Senders maps a contact method to the sender that delivers it
+	Senders map[string]Sender
+	// ListingBaseURL is the frontend url digests link listings to
+	ListingBaseURL string
+	// Unsubscriber signs the unsubscribe links put in digests
+	Unsubscriber *Unsubscriber
 }
 
 type Notification struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	Contact       string    `json:"contact"`
-	Body          string    `json:"body"`
-	Subject       string    `json:"subject"`
-	ListingID     uuid.UUID `json:"listing_id"`
-	SentAt        time.Time `json:"sent_at"`
-	Status        string    `json:"status"`
-	ContactMethod string    `json:"contact_method"`
+	ID                uuid.UUID      `json:"id"`
+	UserID            uuid.UUID      `json:"user_id"`
+	Contact           string         `json:"contact"`
+	Body              string         `json:"body"`
+	HTMLBody          string         `json:"html_body,omitempty"`
+	Subject           string         `json:"subject"`
+	ListingID         uuid.NullUUID  `json:"listing_id"`
+	SentAt            sql.NullTime   `json:"sent_at"`
+	Status            string         `json:"status"`
+	ContactMethod     string         `json:"contact_method"`
+	AlertID           uuid.NullUUID  `json:"alert_id"`
+	CreatedAt         time.Time      `json:"created_at"`
+	Attempts          int32          `json:"attempts"`
+	LastError         sql.NullString `json:"last_error"`
+	ProviderMessageID sql.NullString `json:"provider_message_id"`
+	DeliveredAt       sql.NullTime   `json:"delivered_at"`
+	ReadAt            sql.NullTime   `json:"read_at"`
+	Event             string         `json:"event"`
+	DigestID          uuid.NullUUID  `json:"digest_id"`
+	DeliverAfter      sql.NullTime   `json:"deliver_after"`
+	UnsubscribeURL    string         `json:"unsubscribe_url"`
 }
@@ -1,96 +1,210 @@
 package notification
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
+	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/muhammadolammi/rentradar/internal/database"
 )
 
-func publishMessage(body []byte, rabbitmq_url string) {
-	conn, err := amqp.Dial(rabbitmq_url)
-	if err != nil {
-		log.Fatal(err)
+// maxConsumeBackoff caps how long a worker waits before consuming again after
+// losing the broker.
+const maxConsumeBackoff = 30 * time.Second
+
+// firstRetryDelay is how long a notification waits in the outbox after its
+// first transient failure, doubling with each attempt after that.
+const firstRetryDelay = time.Minute
+
+// worker consumes the notifications queue until ctx is cancelled. When the
+// broker drops the consumer, e.g. because the connection was lost, it waits
+// with exponential backoff and consumes again.
+func worker(ctx context.Context, id int, config *Config) {
+	backoff := time.Second
+	for {
+		//    to consume message on the queue
+		msgs, err := config.Broker.Consume(ctx, QueueName)
+		if errors.Is(err, ErrBrokerClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("worker %d: error consuming %s, retrying in %s. err: %v", id, QueueName, backoff, err)
+		} else {
+			for msg := range msgs {
+				log.Printf("Worker %d processing: %s", id, msg.Body)
+				config.handleMessage(id, msg)
+				backoff = time.Second
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("worker %d: lost the %s consumer, consuming again in %s", id, QueueName, backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConsumeBackoff)
 	}
-	defer conn.Close()
+}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		log.Fatal(err)
+// handleMessage sends the notification in msg. It is acked only once the send
+// succeeds or the notification is back in the outbox: transient failures wait
+// there with exponential backoff, so the worker moves on to the next message,
+// and the sweeper publishes them again once they are due. Undecodable
+// messages, permanent failures and notifications that failed
+// MaxDeliveryAttempts times go to the dead-letter queue. Notifications the
+// user's preferences defer or suppress are acked too, the sweeper publishes
+// deferred ones again once they are due.
+func (config *Config) handleMessage(id int, msg Message) {
+	notification := Notification{}
+	if err := json.Unmarshal(msg.Body, &notification); err != nil {
+		log.Printf("worker %d: dead-lettering undecodable message %s. err: %v", id, msg.ID, err)
+		config.nack(id, msg, false)
+		return
 	}
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		"notifications", // queue name
-		true,            // durable
-		false,           // auto-delete
-		false,           // exclusive
-		false,           // no-wait
-		nil,             // arguments
-	)
-	if err != nil {
-		log.Fatal(err)
+
+	messageID, err := config.SendNotification(context.Background(), notification)
+	var deferred *DeferredError
+	switch {
+	case err == nil:
+		log.Printf("worker %d: sent notification %s as %s", id, notification.ID, messageID)
+		config.recordSent(id, notification, messageID)
+		config.ack(id, msg)
+	case errors.As(err, &deferred):
+		log.Printf("worker %d: deferring notification %s. err: %v", id, notification.ID, err)
+		config.recordDeferred(id, notification, deferred)
+		config.ack(id, msg)
+	case errors.Is(err, ErrMuted):
+		log.Printf("worker %d: suppressing notification %s. err: %v", id, notification.ID, err)
+		config.recordSuppressed(id, notification, err)
+		config.ack(id, msg)
+	case IsPermanent(err):
+		log.Printf("worker %d: dead-lettering notification %s. err: %v", id, notification.ID, err)
+		config.recordFailure(id, notification, "failed", err)
+		config.nack(id, msg, false)
+	case attempt(notification, msg) >= MaxDeliveryAttempts:
+		log.Printf("worker %d: dead-lettering notification %s after %d attempts. err: %v", id, notification.ID, attempt(notification, msg), err)
+		config.recordFailure(id, notification, "failed", err)
+		config.nack(id, msg, false)
+	case config.DB == nil:
+		// without an outbox to wait in, the broker redelivers it straight away
+		log.Printf("worker %d: requeueing notification %s (attempt %d). err: %v", id, notification.ID, attempt(notification, msg), err)
+		config.nack(id, msg, true)
+	default:
+		delay := firstRetryDelay << (attempt(notification, msg) - 1)
+		log.Printf("worker %d: retrying notification %s in %s (attempt %d). err: %v", id, notification.ID, delay, attempt(notification, msg), err)
+		if !config.recordRetry(id, notification, delay, err) {
+			// it isn't in the outbox, so the broker has to keep it
+			config.nack(id, msg, true)
+			return
+		}
+		config.ack(id, msg)
 	}
+}
+
+// attempt numbers this delivery of the notification. Attempts counts the
+// failures recorded before the notification was published and msg.Attempts
+// the broker's deliveries of this message.
+func attempt(notification Notification, msg Message) int {
+	return int(notification.Attempts) + max(msg.Attempts, 1)
+}
 
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key (queue name)
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        body,
-		})
+// recordSent marks the notification as sent in the database, keeping the
+// provider's message id so delivery webhooks can find it again.
+func (config *Config) recordSent(id int, notification Notification, messageID string) {
+	if config.DB == nil {
+		return
+	}
+	err := config.DB.MarkNotificationSent(context.Background(), database.MarkNotificationSentParams{
+		ID:                notification.ID,
+		ProviderMessageID: sql.NullString{String: messageID, Valid: messageID != ""},
+	})
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("worker %d: error marking notification %s sent. err: %v", id, notification.ID, err)
 	}
 }
 
-func worker(id int, queueName string, config *Config) {
-	//    to consume message on the queue
-
-	conn, err := amqp.Dial(config.RABBITMQUrl)
+// recordFailure stores a failed delivery attempt and the status it leaves the notification in.
+func (config *Config) recordFailure(id int, notification Notification, status string, sendErr error) {
+	if config.DB == nil {
+		return
+	}
+	err := config.DB.MarkNotificationAttemptFailed(context.Background(), database.MarkNotificationAttemptFailedParams{
+		ID:        notification.ID,
+		Status:    status,
+		LastError: sql.NullString{Valid: true, String: sendErr.Error()},
+	})
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("worker %d: error recording failed attempt for notification %s. err: %v", id, notification.ID, err)
 	}
-	defer conn.Close()
+}
 
-	ch, err := conn.Channel()
+// recordRetry records a failed attempt and puts the notification back in the
+// outbox for delay. It reports whether the notification is in the outbox.
+func (config *Config) recordRetry(id int, notification Notification, delay time.Duration, sendErr error) bool {
+	err := config.DB.RetryNotificationLater(context.Background(), database.RetryNotificationLaterParams{
+		ID:           notification.ID,
+		DelaySeconds: delay.Seconds(),
+		LastError:    sql.NullString{Valid: true, String: sendErr.Error()},
+	})
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("worker %d: error putting notification %s back in the outbox. err: %v", id, notification.ID, err)
+		return false
 	}
-	defer ch.Close()
-
-	msgs, err := ch.Consume(
-		queueName, // queue name
-		"",        // consumer tag
-		true,      // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // arguments
-	)
+	return true
+}
+
+// recordDeferred puts the notification back in the outbox until it is due.
+func (config *Config) recordDeferred(id int, notification Notification, deferred *DeferredError) {
+	if config.DB == nil {
+		return
+	}
+	err := config.DB.DeferNotification(context.Background(), database.DeferNotificationParams{
+		ID:           notification.ID,
+		DelaySeconds: time.Until(deferred.Until).Seconds(),
+		LastError:    sql.NullString{Valid: true, String: deferred.Error()},
+	})
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("worker %d: error deferring notification %s. err: %v", id, notification.ID, err)
 	}
+}
 
-	for msg := range msgs {
-		log.Printf("Worker %d processing: %s", id, msg.Body)
-		// Here you can call a function to send the actual notification
-		// Unmarshal the body
-		notification := Notification{}
-		err = json.Unmarshal(msg.Body, &notification)
-		if err != nil {
-			log.Fatalf("error unmarshalling message body. err: %v", err)
-		}
+// recordSuppressed marks a notification the user's preferences dropped.
+func (config *Config) recordSuppressed(id int, notification Notification, reason error) {
+	if config.DB == nil {
+		return
+	}
+	err := config.DB.MarkNotificationSuppressed(context.Background(), database.MarkNotificationSuppressedParams{
+		ID:        notification.ID,
+		LastError: sql.NullString{Valid: true, String: reason.Error()},
+	})
+	if err != nil {
+		log.Printf("worker %d: error suppressing notification %s. err: %v", id, notification.ID, err)
+	}
+}
 
-		SendNotification(notification, config.SMTPModel)
+func (config *Config) ack(id int, msg Message) {
+	if err := config.Broker.Ack(msg); err != nil {
+		log.Printf("worker %d: error acking message %s. err: %v", id, msg.ID, err)
 	}
+}
 
+func (config *Config) nack(id int, msg Message, requeue bool) {
+	if err := config.Broker.Nack(msg, requeue); err != nil {
+		log.Printf("worker %d: error nacking message %s. err: %v", id, msg.ID, err)
+	}
 }
 
-func (config *Config) startWorkerPool(numWorkers int, queueName string) {
+// StartWorkerPool starts numWorkers workers that consume the notifications
+// queue and send each notification. Workers stop when ctx is cancelled.
+func (config *Config) StartWorkerPool(ctx context.Context, numWorkers int) {
 	for i := range numWorkers {
-		go worker(i, queueName, config)
+		go worker(ctx, i, config)
 	}
 }
@@ -0,0 +1,229 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// DefaultTimezone is the timezone quiet hours and the daily cap use unless the
+// user picks another one.
+const DefaultTimezone = "Africa/Lagos"
+
+// ErrMuted is returned for notifications to users who muted all notifications.
+var ErrMuted = errors.New("user has muted notifications")
+
+// DeferredError is returned for notifications the user's preferences hold back
+// until Until, e.g. during quiet hours or once the daily cap is reached.
+type DeferredError struct {
+	Until  time.Time
+	Reason string
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("deferred until %s: %s", e.Until.Format(time.RFC3339), e.Reason)
+}
+
+// DefaultPreferences are the preferences of a user who never saved any:
+// no quiet hours, no fallback channels, not muted and no daily cap.
+func DefaultPreferences(userID uuid.UUID) database.NotificationPreference {
+	return database.NotificationPreference{
+		UserID:          userID,
+		Timezone:        DefaultTimezone,
+		ChannelPriority: []string{},
+	}
+}
+
+// GetPreferences returns the user's notification preferences, or the defaults
+// when they have none saved.
+func GetPreferences(ctx context.Context, db *database.Queries, userID uuid.UUID) (database.NotificationPreference, error) {
+	prefs, err := db.GetNotificationPreferences(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultPreferences(userID), nil
+	}
+	if err != nil {
+		return prefs, fmt.Errorf("error getting notification preferences. err: %v", err)
+	}
+	return prefs, nil
+}
+
+// LoadLocation resolves a preferences timezone. Africa/Lagos maps to the fixed
+// Lagos zone so the default works without the host's tz database.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == DefaultTimezone {
+		return Lagos, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight.
+func ParseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, use HH:MM", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// QuietHoursEnd returns when the quiet hours now falls in end. ok is false when
+// the user has no quiet hours or now is outside them. Quiet hours may span
+// midnight, e.g. 22:00 to 07:00.
+func QuietHoursEnd(prefs database.NotificationPreference, now time.Time) (end time.Time, ok bool, err error) {
+	if prefs.QuietHoursStart == "" || prefs.QuietHoursEnd == "" {
+		return time.Time{}, false, nil
+	}
+	start, err := ParseClock(prefs.QuietHoursStart)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	stop, err := ParseClock(prefs.QuietHoursEnd)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	loc, err := LoadLocation(prefs.Timezone)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case start == stop:
+		return time.Time{}, false, nil
+	case start < stop && minute >= start && minute < stop:
+		return midnight.Add(time.Duration(stop) * time.Minute), true, nil
+	case start > stop && minute >= start:
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(stop) * time.Minute), true, nil
+	case start > stop && minute < stop:
+		return midnight.Add(time.Duration(stop) * time.Minute), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// checkPreferences returns ErrMuted or a DeferredError when the user's
+// preferences say the notification can't go out now.
+func (config *Config) checkPreferences(ctx context.Context, prefs database.NotificationPreference, now time.Time) error {
+	if prefs.Muted {
+		return ErrMuted
+	}
+	end, quiet, err := QuietHoursEnd(prefs, now)
+	if err != nil {
+		return Permanent(err)
+	}
+	if quiet {
+		return &DeferredError{Until: end, Reason: "quiet hours"}
+	}
+	if prefs.DailyCap <= 0 {
+		return nil
+	}
+
+	loc, err := LoadLocation(prefs.Timezone)
+	if err != nil {
+		return Permanent(err)
+	}
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	sent, err := config.DB.CountNotificationsSentSince(ctx, database.CountNotificationsSentSinceParams{
+		UserID:       prefs.UserID,
+		SinceSeconds: now.Sub(midnight).Seconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("error counting notifications sent today. err: %v", err)
+	}
+	if sent >= int64(prefs.DailyCap) {
+		return &DeferredError{Until: midnight.AddDate(0, 0, 1), Reason: "daily cap reached"}
+	}
+	return nil
+}
+
+// channelOrder lists the channels to try for a notification: the user's
+// channel priority, with the notification's own channel first when the
+// priority doesn't mention it.
+func channelOrder(prefs database.NotificationPreference, contactMethod string) []string {
+	if !slices.Contains(prefs.ChannelPriority, contactMethod) {
+		return append([]string{contactMethod}, prefs.ChannelPriority...)
+	}
+	return prefs.ChannelPriority
+}
+
+// onChannel returns a copy of the notification moved to another channel, with
+// the user's contact for it and its content rendered for that channel.
+func (config *Config) onChannel(ctx context.Context, notification Notification, channel string) (Notification, error) {
+	user, err := config.DB.GetUser(ctx, notification.UserID)
+	if err != nil {
+		return notification, fmt.Errorf("error getting user. err: %v", err)
+	}
+	contact, err := contactFor(channel, user)
+	if err != nil {
+		return notification, err
+	}
+	data, err := config.templateData(ctx, notification)
+	if err != nil {
+		return notification, err
+	}
+	data.UnsubscribeURL = notification.UnsubscribeURL
+	content, err := RenderNotification(notification.Event, channel, data)
+	if err != nil {
+		return notification, fmt.Errorf("error rendering notification. err: %v", err)
+	}
+
+	notification.ContactMethod = channel
+	notification.Contact = contact
+	notification.Subject = content.Subject
+	notification.Body = content.Body
+	notification.HTMLBody = content.HTMLBody
+	return notification, nil
+}
+
+// templateData loads what the notification's templates were rendered with.
+func (config *Config) templateData(ctx context.Context, notification Notification) (TemplateData, error) {
+	if notification.Event == EventDigest {
+		digestID := uuid.NullUUID{UUID: notification.ID, Valid: true}
+		listings, err := config.DB.GetDigestListings(ctx, digestID)
+		if err != nil {
+			return TemplateData{}, fmt.Errorf("error getting digest listings. err: %v", err)
+		}
+		frequency, err := config.DB.GetDigestFrequency(ctx, digestID)
+		if err != nil {
+			return TemplateData{}, fmt.Errorf("error getting digest frequency. err: %v", err)
+		}
+		return NewDigestTemplateData(listings, frequency, config.ListingBaseURL), nil
+	}
+
+	if !notification.ListingID.Valid {
+		return TemplateData{}, fmt.Errorf("notification %s has no listing", notification.ID)
+	}
+	listing, err := config.DB.GetListing(ctx, notification.ListingID.UUID)
+	if err != nil {
+		return TemplateData{}, fmt.Errorf("error getting listing. err: %v", err)
+	}
+	alert := database.Alert{}
+	if notification.AlertID.Valid {
+		alert, err = config.DB.GetAlert(ctx, notification.AlertID.UUID)
+		if err != nil {
+			return TemplateData{}, fmt.Errorf("error getting alert. err: %v", err)
+		}
+	}
+	data := NewTemplateData(listing, alert, config.ListingBaseURL)
+	// listing notifications without an alert went to users who saved the listing
+	data.Favorite = !notification.AlertID.Valid
+	if notification.Event == EventPriceDrop || notification.Event == EventPriceRise {
+		// the price change was recorded with the notification
+		change, err := config.DB.GetListingPriceAt(ctx, database.GetListingPriceAtParams{
+			ListingID: listing.ID,
+			At:        notification.CreatedAt,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return TemplateData{}, fmt.Errorf("error getting listing price change. err: %v", err)
+		}
+		data.OldPrice = change.PreviousPrice.Int64
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// QueueName is the queue the API publishes notifications to and the worker
+// pool consumes from. It is a quorum queue, so it can't reuse the name of the
+// classic LegacyQueueName queue: RabbitMQ refuses to redeclare a queue with
+// different arguments.
+const QueueName = "notifications.quorum"
+
+// LegacyQueueName is the classic queue notifications used to go through.
+// RabbitMQ brokers drain it into QueueName and delete it when they start.
+const LegacyQueueName = "notifications"
+
+// MaxDeliveryAttempts is how many times the workers try to send a notification
+// before it is dead-lettered.
+const MaxDeliveryAttempts = 5
+
+// Publisher publishes notifications as JSON onto the notifications queue.
+type Publisher struct {
+	broker Broker
+}
+
+func NewPublisher(broker Broker) *Publisher {
+	return &Publisher{broker: broker}
+}
+
+func (p *Publisher) Publish(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error marshalling notification. err: %v", err)
+	}
+	return p.broker.Publish(ctx, QueueName, Message{
+		ID:   notification.ID.String(),
+		Body: body,
+	})
+}
+
+// DeadLetter is a notification message that exhausted its retries or couldn't be decoded.
+type DeadLetter struct {
+	ID       string `json:"id"`
+	Attempts int    `json:"attempts"`
+	// Notification is nil when the message body isn't a valid notification
+	Notification *Notification `json:"notification"`
+	Body         string        `json:"body"`
+}
+
+// DeadLetters lists the dead-lettered notifications.
+func (p *Publisher) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	msgs, err := p.broker.DeadLetters(ctx, QueueName)
+	if err != nil {
+		return nil, err
+	}
+	deadLetters := []DeadLetter{}
+	for _, msg := range msgs {
+		deadLetter := DeadLetter{ID: msg.ID, Attempts: msg.Attempts, Body: string(msg.Body)}
+		notification := Notification{}
+		if err := json.Unmarshal(msg.Body, &notification); err == nil {
+			deadLetter.Notification = &notification
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, nil
+}
+
+// ReplayDeadLetter puts a dead-lettered notification back on the notifications queue.
+func (p *Publisher) ReplayDeadLetter(ctx context.Context, id string) error {
+	return p.broker.Replay(ctx, QueueName, id)
+}
@@ -0,0 +1,419 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// declareQueue declares a notification queue together with its dead-letter
+// exchange and queue. Publishers and consumers both declare queues through here
+// so they always agree on their settings.
+func declareQueue(ch *amqp.Channel, name string) (amqp.Queue, error) {
+	if err := declareDeadLetterQueue(ch, name); err != nil {
+		return amqp.Queue{}, err
+	}
+	return ch.QueueDeclare(
+		name,  // queue name
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			// quorum queues count redeliveries in the x-delivery-count header
+			"x-queue-type":           "quorum",
+			"x-delivery-limit":       MaxDeliveryAttempts,
+			"x-dead-letter-exchange": deadLetterExchange(name),
+		},
+	)
+}
+
+// declareDeadLetterQueue declares the exchange and queue that rejected messages from queue are routed to.
+func declareDeadLetterQueue(ch *amqp.Channel, queue string) error {
+	exchange := deadLetterExchange(queue)
+	err := ch.ExchangeDeclare(
+		exchange, // exchange name
+		"fanout", // kind
+		true,     // durable
+		false,    // auto-delete
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("error declaring dead-letter exchange. err: %v", err)
+	}
+	_, err = ch.QueueDeclare(
+		deadLetterQueue(queue), // queue name
+		true,                   // durable
+		false,                  // auto-delete
+		false,                  // exclusive
+		false,                  // no-wait
+		nil,                    // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("error declaring dead-letter queue. err: %v", err)
+	}
+	return ch.QueueBind(deadLetterQueue(queue), "", exchange, false, nil)
+}
+
+func deadLetterExchange(queue string) string {
+	return queue + ".dlx"
+}
+
+func deadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// deliveryAttempts reads how many times the delivery has been handed out,
+// including this time, from the quorum queue's x-delivery-count header.
+func deliveryAttempts(d amqp.Delivery) int {
+	switch count := d.Headers["x-delivery-count"].(type) {
+	case int64:
+		return int(count) + 1
+	case int32:
+		return int(count) + 1
+	case int:
+		return count + 1
+	default:
+		return 1
+	}
+}
+
+// RabbitMQBroker keeps one long-lived RabbitMQ connection. Publishing goes
+// through a single confirm-mode channel with persistent delivery; every
+// consumer gets its own channel.
+type RabbitMQBroker struct {
+	url string
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	closed   bool
+}
+
+// NewRabbitMQBroker connects to RabbitMQ and moves anything left on the
+// classic LegacyQueueName queue onto QueueName.
+func NewRabbitMQBroker(rabbitmqURL string) (*RabbitMQBroker, error) {
+	b := &RabbitMQBroker{url: rabbitmqURL}
+	b.mu.Lock()
+	err := b.connect()
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	moved, err := b.migrateLegacyQueue(context.Background(), LegacyQueueName, QueueName)
+	if err != nil {
+		// the queue is left in place, the next start tries again
+		log.Printf("error migrating %s to %s. err: %v", LegacyQueueName, QueueName, err)
+	} else if moved > 0 {
+		log.Printf("moved %d message(s) from %s to %s", moved, LegacyQueueName, QueueName)
+	}
+	return b, nil
+}
+
+// migrateLegacyQueue moves every message on the legacy queue onto queue, then
+// deletes the legacy queue. Each message is only acked on the legacy queue
+// once the broker has confirmed it on the new one. A missing legacy queue
+// means there is nothing to migrate.
+func (b *RabbitMQBroker) migrateLegacyQueue(ctx context.Context, legacy, queue string) (int, error) {
+	ch, err := b.openChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	_, err = ch.QueueDeclarePassive(
+		legacy, // queue name
+		true,   // durable
+		false,  // auto-delete
+		false,  // exclusive
+		false,  // no-wait
+		nil,    // arguments
+	)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error checking legacy queue. err: %v", err)
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(legacy, false)
+		if err != nil {
+			return moved, fmt.Errorf("error reading legacy queue. err: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if err := b.Publish(ctx, queue, Message{ID: d.MessageId, Body: d.Body}); err != nil {
+			return moved, err
+		}
+		if err := d.Ack(false); err != nil {
+			return moved, fmt.Errorf("error acking legacy message. err: %v", err)
+		}
+		moved++
+	}
+	// only delete it empty, in case something published to it meanwhile
+	if _, err := ch.QueueDelete(legacy, false, true, false); err != nil {
+		return moved, fmt.Errorf("error deleting legacy queue. err: %v", err)
+	}
+	return moved, nil
+}
+
+// connect (re)opens the connection and the confirm-mode publishing channel. Callers must hold b.mu.
+func (b *RabbitMQBroker) connect() error {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return fmt.Errorf("error connecting to rabbitmq. err: %v", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error opening rabbitmq channel. err: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("error enabling publisher confirms. err: %v", err)
+	}
+	b.conn = conn
+	b.ch = ch
+	b.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+// ensureConnected reconnects if the connection was dropped. Callers must hold b.mu.
+func (b *RabbitMQBroker) ensureConnected() error {
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.conn != nil && !b.conn.IsClosed() {
+		return nil
+	}
+	b.reset()
+	return b.connect()
+}
+
+// reset drops the current connection so the next call reconnects. Callers must hold b.mu.
+func (b *RabbitMQBroker) reset() {
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.conn = nil
+	b.ch = nil
+	b.confirms = nil
+}
+
+// Publish sends the message with persistent delivery and waits for the broker to confirm it.
+func (b *RabbitMQBroker) Publish(ctx context.Context, queue string, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.ensureConnected(); err != nil {
+		return err
+	}
+	if _, err := declareQueue(b.ch, queue); err != nil {
+		b.reset()
+		return fmt.Errorf("error declaring queue. err: %v", err)
+	}
+
+	err := b.ch.Publish(
+		"",    // exchange
+		queue, // routing key (queue name)
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.ID,
+			Timestamp:    time.Now().UTC(),
+			Body:         msg.Body,
+		})
+	if err != nil {
+		b.reset()
+		return fmt.Errorf("error publishing message. err: %v", err)
+	}
+
+	select {
+	case confirm, ok := <-b.confirms:
+		if !ok {
+			b.reset()
+			return errors.New("rabbitmq channel closed before confirming message")
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("rabbitmq rejected message %s", msg.ID)
+		}
+		return nil
+	case <-ctx.Done():
+		// the confirm may still arrive; drop the channel so it can't be
+		// mistaken for the confirm of the next publish
+		b.reset()
+		return ctx.Err()
+	}
+}
+
+func (b *RabbitMQBroker) Consume(ctx context.Context, queue string) (<-chan Message, error) {
+	ch, err := b.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := declareQueue(ch, queue); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("error declaring queue. err: %v", err)
+	}
+	// only hand each consumer one unacked message at a time
+	if err := ch.Qos(1, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("error setting qos. err: %v", err)
+	}
+
+	deliveries, err := ch.Consume(
+		queue, // queue name
+		"",    // consumer tag
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("error consuming queue. err: %v", err)
+	}
+
+	msgs := make(chan Message)
+	go func() {
+		defer close(msgs)
+		defer ch.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d, ok := <-deliveries:
+				if !ok {
+					return
+				}
+				msg := Message{ID: d.MessageId, Body: d.Body, Attempts: deliveryAttempts(d), delivery: d}
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					d.Nack(false, true)
+					return
+				}
+			}
+		}
+	}()
+	return msgs, nil
+}
+
+func (b *RabbitMQBroker) Ack(msg Message) error {
+	d, ok := msg.delivery.(amqp.Delivery)
+	if !ok {
+		return errors.New("message was not delivered by rabbitmq")
+	}
+	return d.Ack(false)
+}
+
+func (b *RabbitMQBroker) Nack(msg Message, requeue bool) error {
+	d, ok := msg.delivery.(amqp.Delivery)
+	if !ok {
+		return errors.New("message was not delivered by rabbitmq")
+	}
+	return d.Nack(false, requeue)
+}
+
+// openChannel opens a new channel on the shared connection.
+func (b *RabbitMQBroker) openChannel() (*amqp.Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.ensureConnected(); err != nil {
+		return nil, err
+	}
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("error opening rabbitmq channel. err: %v", err)
+	}
+	return ch, nil
+}
+
+// getDeadLetters fetches every message on the dead-letter queue without acking
+// them; they go back on the queue when ch is closed.
+func getDeadLetters(ch *amqp.Channel, queue string) ([]amqp.Delivery, error) {
+	if err := declareDeadLetterQueue(ch, queue); err != nil {
+		return nil, err
+	}
+	deliveries := []amqp.Delivery{}
+	for {
+		d, ok, err := ch.Get(deadLetterQueue(queue), false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dead-letter queue. err: %v", err)
+		}
+		if !ok {
+			return deliveries, nil
+		}
+		deliveries = append(deliveries, d)
+	}
+}
+
+func (b *RabbitMQBroker) DeadLetters(ctx context.Context, queue string) ([]Message, error) {
+	ch, err := b.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	deliveries, err := getDeadLetters(ch, queue)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []Message{}
+	for _, d := range deliveries {
+		msgs = append(msgs, Message{ID: d.MessageId, Body: d.Body, Attempts: deliveryAttempts(d)})
+	}
+	return msgs, nil
+}
+
+func (b *RabbitMQBroker) Replay(ctx context.Context, queue, id string) error {
+	ch, err := b.openChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	deliveries, err := getDeadLetters(ch, queue)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		if d.MessageId != id {
+			continue
+		}
+		if err := b.Publish(ctx, queue, Message{ID: d.MessageId, Body: d.Body}); err != nil {
+			return err
+		}
+		return d.Ack(false)
+	}
+	return ErrMessageNotFound
+}
+
+func (b *RabbitMQBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	b.ch = nil
+	b.confirms = nil
+	return err
+}
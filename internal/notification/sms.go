@@ -0,0 +1,218 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SMSProvider sends a text message through an SMS gateway and returns the
+// gateway's message id.
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, message string) (string, error)
+}
+
+// HTTPSMSProvider talks to a Termii style JSON API: the message is POSTed as
+// JSON and the gateway answers with its message id.
+type HTTPSMSProvider struct {
+	URL      string
+	APIKey   string
+	SenderID string
+	Client   *http.Client
+}
+
+func NewHTTPSMSProvider(url, apiKey, senderID string) *HTTPSMSProvider {
+	return &HTTPSMSProvider{
+		URL:      url,
+		APIKey:   apiKey,
+		SenderID: senderID,
+		Client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type httpSMSRequest struct {
+	To      string `json:"to"`
+	From    string `json:"from"`
+	SMS     string `json:"sms"`
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	APIKey  string `json:"api_key"`
+}
+
+type httpSMSResponse struct {
+	MessageID string `json:"message_id"`
+	Message   string `json:"message"`
+}
+
+func (p *HTTPSMSProvider) SendSMS(ctx context.Context, to, message string) (string, error) {
+	body, err := json.Marshal(httpSMSRequest{
+		To:      to,
+		From:    p.SenderID,
+		SMS:     message,
+		Type:    "plain",
+		Channel: "generic",
+		APIKey:  p.APIKey,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling sms request. err: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", Permanent(fmt.Errorf("error creating sms request. err: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling sms provider. err: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("sms provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		// the provider won't accept a bad request no matter how often it's retried
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return "", Permanent(err)
+		}
+		return "", err
+	}
+	smsResp := httpSMSResponse{}
+	if err := json.Unmarshal(respBody, &smsResp); err != nil {
+		return "", fmt.Errorf("error decoding sms provider response. err: %v", err)
+	}
+	return smsResp.MessageID, nil
+}
+
+// maxSMSSegments caps how many segments one notification may use, since every
+// segment is billed as a separate message.
+const maxSMSSegments = 3
+
+// SMSSender sends notifications as text messages to Nigerian phone numbers.
+type SMSSender struct {
+	provider SMSProvider
+}
+
+func NewSMSSender(provider SMSProvider) *SMSSender {
+	return &SMSSender{provider: provider}
+}
+
+func (s *SMSSender) Send(ctx context.Context, notification Notification) (string, error) {
+	to, err := NormalizePhoneNumber(notification.Contact)
+	if err != nil {
+		return "", Permanent(err)
+	}
+	return s.provider.SendSMS(ctx, to, smsText(notification, maxSMSSegments))
+}
+
+// smsText builds the message from the subject and body, keeping it to the GSM
+// alphabet where possible and trimming it to maxSegments segments.
+func smsText(notification Notification, maxSegments int) string {
+	text := notification.Subject
+	if notification.Body != "" {
+		text += "\n" + notification.Body
+	}
+	// ₦ isn't in the GSM alphabet and would halve the characters per segment
+	text = strings.ReplaceAll(strings.TrimSpace(text), "₦", "NGN")
+	// the unsubscribe link goes last and is never trimmed
+	suffix := ""
+	if notification.UnsubscribeURL != "" {
+		suffix = "\nStop: " + notification.UnsubscribeURL
+	}
+	if SMSSegments(text+suffix) <= maxSegments {
+		return text + suffix
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && SMSSegments(string(runes)+"..."+suffix) > maxSegments {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "..." + suffix
+}
+
+// gsmBasic is the GSM 03.38 basic character set; each takes one septet.
+const gsmBasic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsmExtension characters are sent with an escape and take two septets.
+const gsmExtension = "^{}\\[~]|€\f"
+
+// SMSSegments returns how many SMS segments text needs. GSM-7 text fits 160
+// characters in one segment or 153 per segment when split; anything outside the
+// GSM alphabet is sent as UCS-2 with 70, or 67 per split segment.
+func SMSSegments(text string) int {
+	if text == "" {
+		return 0
+	}
+	septets := 0
+	gsm := true
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsmBasic, r):
+			septets++
+		case strings.ContainsRune(gsmExtension, r):
+			septets += 2
+		default:
+			gsm = false
+		}
+	}
+	if !gsm {
+		// UCS-2 counts UTF-16 code units
+		units := 0
+		for _, r := range text {
+			units += utf8.RuneLen(r)/4 + 1
+		}
+		return segments(units, 70, 67)
+	}
+	return segments(septets, 160, 153)
+}
+
+func segments(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// NormalizePhoneNumber converts a Nigerian phone number such as 0803 123 4567,
+// 8031234567 or 234-803-123-4567 to E.164 (+2348031234567). Numbers already
+// in international format are kept as they are.
+func NormalizePhoneNumber(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+
+	international := strings.HasPrefix(digits, "+")
+	digits = strings.TrimPrefix(digits, "+")
+	if digits == "" || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) != -1 {
+		return "", fmt.Errorf("invalid phone number %q", phone)
+	}
+
+	switch {
+	case strings.HasPrefix(digits, "234"):
+		if len(digits) != 13 {
+			return "", fmt.Errorf("invalid nigerian phone number %q", phone)
+		}
+		return "+" + digits, nil
+	case international:
+		if len(digits) < 8 || len(digits) > 15 {
+			return "", fmt.Errorf("invalid phone number %q", phone)
+		}
+		return "+" + digits, nil
+	case len(digits) == 11 && digits[0] == '0':
+		return "+234" + digits[1:], nil
+	case len(digits) == 10 && digits[0] != '0':
+		return "+234" + digits, nil
+	default:
+		return "", fmt.Errorf("invalid nigerian phone number %q", phone)
+	}
+}
@@ -0,0 +1,115 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// Delivery statuses reported by provider webhooks.
+const (
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusBounced   = "bounced"
+	StatusFailed    = "failed"
+)
+
+// disableAfterFailures is how many of an alert's latest notifications must have
+// failed before the alert is disabled. A bounce disables it straight away.
+const disableAfterFailures = 3
+
+// statusRank orders statuses so late or repeated webhooks can't move a
+// notification backwards, e.g. a 'delivered' arriving after 'read'.
+var statusRank = map[string]int{
+	"pending":       0,
+	"enqueued":      0,
+	"retrying":      0,
+	"sent":          1,
+	StatusDelivered: 2,
+	StatusRead:      3,
+	StatusBounced:   4,
+	StatusFailed:    4,
+}
+
+// DeliveryStatus is a status update a provider sent for one message.
+type DeliveryStatus struct {
+	ContactMethod     string
+	ProviderMessageID string
+	Status            string
+	// Reason is the provider's explanation for bounces and failures
+	Reason string
+}
+
+// RecordDeliveryStatus applies a provider's status update to the notification
+// it sent, and disables the notification's alert when its contact looks dead.
+// Updates for messages we don't know are ignored.
+func RecordDeliveryStatus(ctx context.Context, db *database.Queries, update DeliveryStatus) error {
+	if _, ok := statusRank[update.Status]; !ok {
+		return fmt.Errorf("unknown delivery status: %s", update.Status)
+	}
+	dbNotification, err := db.GetNotificationByProviderMessageID(ctx, database.GetNotificationByProviderMessageIDParams{
+		ContactMethod:     update.ContactMethod,
+		ProviderMessageID: sql.NullString{String: update.ProviderMessageID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("ignoring %s status for unknown %s message %s", update.Status, update.ContactMethod, update.ProviderMessageID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting notification. err: %v", err)
+	}
+	if statusRank[update.Status] <= statusRank[dbNotification.Status] {
+		return nil
+	}
+
+	err = db.UpdateNotificationDeliveryStatus(ctx, database.UpdateNotificationDeliveryStatusParams{
+		Status:    update.Status,
+		LastError: sql.NullString{String: update.Reason, Valid: update.Reason != ""},
+		ID:        dbNotification.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating notification status. err: %v", err)
+	}
+	if update.Status != StatusBounced && update.Status != StatusFailed {
+		return nil
+	}
+	if !dbNotification.AlertID.Valid {
+		return nil
+	}
+	return disableUndeliverableAlert(ctx, db, dbNotification, update)
+}
+
+// disableUndeliverableAlert turns the alert off after a bounce, or once its
+// latest notifications have all failed.
+func disableUndeliverableAlert(ctx context.Context, db *database.Queries, dbNotification database.Notification, update DeliveryStatus) error {
+	if update.Status == StatusFailed {
+		failures, err := db.CountRecentUndeliverableNotifications(ctx, database.CountRecentUndeliverableNotificationsParams{
+			AlertID: dbNotification.AlertID,
+			Recent:  disableAfterFailures,
+		})
+		if err != nil {
+			return fmt.Errorf("error counting failed notifications. err: %v", err)
+		}
+		if failures < disableAfterFailures {
+			return nil
+		}
+	}
+
+	reason := fmt.Sprintf("%s %s %s", dbNotification.ContactMethod, dbNotification.Contact, update.Status)
+	if update.Reason != "" {
+		reason += ": " + update.Reason
+	}
+	err := db.DisableAlert(ctx, database.DisableAlertParams{
+		ID:             dbNotification.AlertID.UUID,
+		DisabledReason: sql.NullString{String: reason, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error disabling alert. err: %v", err)
+	}
+	log.Printf("disabled alert %s. reason: %s", dbNotification.AlertID.UUID, reason)
+	return nil
+}
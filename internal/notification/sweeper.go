@@ -0,0 +1,100 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// sweepBatchSize is how many pending notifications one sweep claims.
+const sweepBatchSize = 100
+
+// StartSweeper re-publishes notifications that are still pending minAge after
+// they were written, e.g. because RabbitMQ was down when the API created them.
+// Pending notifications are the outbox: the API writes them in the same
+// transaction as the listing, so this is what guarantees none are lost.
+// Notifications deferred by the user's preferences wait until deliver_after.
+func (config *Config) StartSweeper(ctx context.Context, interval, minAge time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				enqueued, err := config.sweep(ctx, minAge)
+				if err != nil {
+					log.Printf("sweeper: error re-enqueueing pending notifications. err: %v", err)
+				}
+				if enqueued > 0 {
+					log.Printf("sweeper: re-enqueued %d pending notification(s)", enqueued)
+				}
+			}
+		}
+	}()
+}
+
+// sweep claims a batch of stale pending notifications with
+// SELECT ... FOR UPDATE SKIP LOCKED, so several sweepers can run at once,
+// publishes them and marks them enqueued.
+func (config *Config) sweep(ctx context.Context, minAge time.Duration) (int, error) {
+	tx, err := config.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction. err: %v", err)
+	}
+	defer tx.Rollback()
+	qtx := config.DB.WithTx(tx)
+
+	pending, err := qtx.ClaimPendingNotifications(ctx, database.ClaimPendingNotificationsParams{
+		MinAgeSeconds: minAge.Seconds(),
+		BatchSize:     sweepBatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error claiming pending notifications. err: %v", err)
+	}
+
+	publisher := NewPublisher(config.Broker)
+	enqueued := 0
+	var sweepErr error
+	for _, dbNotification := range pending {
+		// keep what was published so far on any error; the rest stay pending for the next sweep
+		if err := publisher.Publish(ctx, DbNotificationToModelsNotification(dbNotification)); err != nil {
+			sweepErr = fmt.Errorf("error publishing notification. err: %v", err)
+			break
+		}
+		if err := markEnqueued(ctx, tx, qtx, dbNotification.ID); err != nil {
+			sweepErr = err
+			break
+		}
+		enqueued++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing sweep. err: %v", err)
+	}
+	return enqueued, sweepErr
+}
+
+// markEnqueued marks the notification enqueued inside a savepoint, so a failed
+// update doesn't abort the transaction and undo the notifications marked
+// before it.
+func markEnqueued(ctx context.Context, tx *sql.Tx, qtx *database.Queries, id uuid.UUID) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT mark_enqueued"); err != nil {
+		return fmt.Errorf("error creating savepoint. err: %v", err)
+	}
+	if err := qtx.MarkNotificationEnqueued(ctx, id); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT mark_enqueued"); rollbackErr != nil {
+			return fmt.Errorf("error rolling back to savepoint. err: %v", rollbackErr)
+		}
+		return fmt.Errorf("error marking notification enqueued. err: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT mark_enqueued"); err != nil {
+		return fmt.Errorf("error releasing savepoint. err: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// Notification events
+const (
+	EventNewMatch      = "new_match"
+	EventPriceDrop     = "price_drop"
+	EventPriceRise     = "price_rise"
+	EventListingRented = "listing_rented"
+	EventDigest        = "digest"
+)
+
+// Events and Channels list every event and contact method that has templates.
+var (
+	Events   = []string{EventNewMatch, EventPriceDrop, EventPriceRise, EventListingRented, EventDigest}
+	Channels = []string{"email", "sms", "whatsapp"}
+)
+
+// ErrTemplateNotFound is returned when there's no template for an event and channel.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Every event has a {event}.{channel}.txt template defining "subject" and
+// "body", and email also has an {event}.email.html template.
+//
+//go:embed templates/*
+var templateFiles embed.FS
+
+var templateFuncs = map[string]any{
+	"naira": formatNaira,
+	"area":  formatAlertArea,
+}
+
+// textTemplates is keyed by {event}.{channel}. Every file is parsed on its
+// own because they all define "subject" and "body".
+var textTemplates = parseTextTemplates()
+
+var htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.html"))
+
+func parseTextTemplates() map[string]*texttemplate.Template {
+	templates := map[string]*texttemplate.Template{}
+	files, err := fs.Glob(templateFiles, "templates/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+		templates[name] = texttemplate.Must(texttemplate.New(name).Funcs(templateFuncs).ParseFS(templateFiles, file))
+	}
+	return templates
+}
+
+// TemplateData is what notification templates render from.
+type TemplateData struct {
+	Listing database.Listing
+	Alert   database.Alert
+	// Favorite is set when the user saved the listing instead of matching
+	// it with an alert, Alert is empty then
+	Favorite bool
+	// OldPrice is the price before a price drop or rise
+	OldPrice   int64
+	ListingURL string
+	// UnsubscribeURL turns off the alert, or all notifications for digests
+	UnsubscribeURL string
+	// Items and Frequency are only set for digests
+	Items     []DigestItem
+	Frequency string
+}
+
+// DigestItem is one listing in a digest.
+type DigestItem struct {
+	Listing database.Listing
+	URL     string
+}
+
+func NewTemplateData(listing database.Listing, alert database.Alert, listingBaseURL string) TemplateData {
+	return TemplateData{
+		Listing:    listing,
+		Alert:      alert,
+		ListingURL: listingURL(listingBaseURL, listing),
+	}
+}
+
+// NewDigestTemplateData builds the data for a digest of listings. ListingURL
+// links to all listings.
+func NewDigestTemplateData(listings []database.Listing, frequency, listingBaseURL string) TemplateData {
+	data := TemplateData{
+		ListingURL: strings.TrimSuffix(listingBaseURL, "/") + "/listings",
+		Frequency:  frequency,
+	}
+	for _, listing := range listings {
+		data.Items = append(data.Items, DigestItem{Listing: listing, URL: listingURL(listingBaseURL, listing)})
+	}
+	return data
+}
+
+func listingURL(listingBaseURL string, listing database.Listing) string {
+	return fmt.Sprintf("%s/listings/%s", strings.TrimSuffix(listingBaseURL, "/"), listing.ID)
+}
+
+// Content is a rendered notification. HTMLBody is only set for email.
+type Content struct {
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	HTMLBody string `json:"html_body,omitempty"`
+}
+
+// RenderNotification renders the event's template for the channel.
+func RenderNotification(event, channel string, data TemplateData) (Content, error) {
+	name := fmt.Sprintf("%s.%s", event, channel)
+	tmpl, ok := textTemplates[name]
+	if !ok {
+		return Content{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var err error
+	content := Content{}
+	if content.Subject, err = executeText(tmpl, "subject", data); err != nil {
+		return Content{}, err
+	}
+	if content.Body, err = executeText(tmpl, "body", data); err != nil {
+		return Content{}, err
+	}
+	if html := htmlTemplates.Lookup(name + ".html"); html != nil {
+		var buf bytes.Buffer
+		if err := html.Execute(&buf, data); err != nil {
+			return Content{}, fmt.Errorf("error rendering template %s.html. err: %v", name, err)
+		}
+		content.HTMLBody = buf.String()
+	}
+	return content, nil
+}
+
+func executeText(tmpl *texttemplate.Template, name string, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("error rendering %s template. err: %v", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// SampleTemplateData is fixed example data for the event, for previews and
+// template tests.
+func SampleTemplateData(event string) TemplateData {
+	listing := database.Listing{
+		ID:           uuid.MustParse("6f1c2d3e-4a5b-4c6d-8e7f-901234567890"),
+		AgentID:      uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-8e9f0a1b2c3d"),
+		Title:        "Spacious 2 bedroom flat",
+		Description:  "Newly renovated flat with running water, prepaid meter and parking for two cars.",
+		Price:        1500000,
+		Location:     "Lekki",
+		PropertyType: "2 bedroom flat",
+		Status:       "active",
+		CreatedAt:    time.Date(2025, time.January, 6, 9, 0, 0, 0, time.UTC),
+	}
+	alert := database.Alert{
+		ID:            uuid.MustParse("1b2c3d4e-5f6a-4b7c-9d8e-0f1a2b3c4d5e"),
+		UserID:        uuid.MustParse("2c3d4e5f-6a7b-4c8d-9e0f-1a2b3c4d5e6f"),
+		MinPrice:      1000000,
+		MaxPrice:      2000000,
+		Locations:     []string{"Lekki"},
+		PropertyType:  "2 bedroom flat",
+		ContactMethod: "email",
+		Active:        true,
+	}
+	second := listing
+	second.ID = uuid.MustParse("7a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d")
+	second.Title = "Mini flat off Admiralty Way"
+	second.Price = 1200000
+
+	if event == EventDigest {
+		data := NewDigestTemplateData([]database.Listing{listing, second}, FrequencyDaily, "https://rentradar.ng")
+		data.UnsubscribeURL = "https://api.rentradar.ng/unsubscribe/sample-token"
+		return data
+	}
+	data := NewTemplateData(listing, alert, "https://rentradar.ng")
+	data.OldPrice = 1800000
+	if event == EventPriceRise {
+		data.OldPrice = 1200000
+	}
+	data.UnsubscribeURL = "https://api.rentradar.ng/unsubscribe/sample-token"
+	return data
+}
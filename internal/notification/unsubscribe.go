@@ -0,0 +1,152 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// UnsubscribeTTL is how long unsubscribe links in notifications keep working.
+const UnsubscribeTTL = 60 * 24 * time.Hour
+
+// unsubscribeAudience keeps other tokens signed with the same secret from
+// being used as unsubscribe tokens.
+const unsubscribeAudience = "unsubscribe"
+
+// ErrInvalidUnsubscribeToken is returned for tampered, expired or malformed tokens.
+var ErrInvalidUnsubscribeToken = errors.New("invalid or expired unsubscribe token")
+
+// Unsubscriber signs and checks the tokens in unsubscribe links. A token names
+// the user and, unless it opts out of everything, the alert to disable or the
+// saved listing to stop updates about.
+type Unsubscriber struct {
+	// BaseURL is the public url of the api serving /unsubscribe/{token}
+	BaseURL string
+	Secret  []byte
+	TTL     time.Duration
+}
+
+func NewUnsubscriber(baseURL, secret string) *Unsubscriber {
+	return &Unsubscriber{
+		BaseURL: baseURL,
+		Secret:  []byte(secret),
+		TTL:     UnsubscribeTTL,
+	}
+}
+
+type unsubscribeClaims struct {
+	AlertID   string `json:"alert_id,omitempty"`
+	ListingID string `json:"listing_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Unsubscription is what an unsubscribe token was signed for. Without an
+// alert or a listing it covers all of the user's notifications.
+type Unsubscription struct {
+	UserID    uuid.UUID
+	AlertID   uuid.NullUUID
+	ListingID uuid.NullUUID
+}
+
+// Token signs an unsubscribe token for the user's alert, or for all of the
+// user's notifications when alertID is null.
+func (u *Unsubscriber) Token(userID uuid.UUID, alertID uuid.NullUUID) (string, error) {
+	return u.sign(Unsubscription{UserID: userID, AlertID: alertID})
+}
+
+// FavoriteToken signs an unsubscribe token for updates about a listing the
+// user saved.
+func (u *Unsubscriber) FavoriteToken(userID, listingID uuid.UUID) (string, error) {
+	return u.sign(Unsubscription{UserID: userID, ListingID: uuid.NullUUID{UUID: listingID, Valid: true}})
+}
+
+func (u *Unsubscriber) sign(unsubscription Unsubscription) (string, error) {
+	now := time.Now().UTC()
+	claims := unsubscribeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   unsubscription.UserID.String(),
+			Audience:  jwt.ClaimStrings{unsubscribeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(u.TTL)),
+		},
+	}
+	if unsubscription.AlertID.Valid {
+		claims.AlertID = unsubscription.AlertID.UUID.String()
+	}
+	if unsubscription.ListingID.Valid {
+		claims.ListingID = unsubscription.ListingID.UUID.String()
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(u.Secret)
+	if err != nil {
+		return "", fmt.Errorf("error signing unsubscribe token. err: %v", err)
+	}
+	return token, nil
+}
+
+// URL returns the unsubscribe link for the user's alert. Without an
+// Unsubscriber there is no link and URL returns "".
+func (u *Unsubscriber) URL(userID uuid.UUID, alertID uuid.NullUUID) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	token, err := u.Token(userID, alertID)
+	if err != nil {
+		return "", err
+	}
+	return u.url(token), nil
+}
+
+// FavoriteURL returns the link that stops updates about a listing the user
+// saved. Without an Unsubscriber there is no link and FavoriteURL returns "".
+func (u *Unsubscriber) FavoriteURL(userID, listingID uuid.UUID) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	token, err := u.FavoriteToken(userID, listingID)
+	if err != nil {
+		return "", err
+	}
+	return u.url(token), nil
+}
+
+func (u *Unsubscriber) url(token string) string {
+	return fmt.Sprintf("%s/unsubscribe/%s", strings.TrimSuffix(u.BaseURL, "/"), token)
+}
+
+// Parse checks the token and returns what it was signed for.
+func (u *Unsubscriber) Parse(token string) (Unsubscription, error) {
+	claims := unsubscribeClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return u.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(unsubscribeAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return Unsubscription{}, ErrInvalidUnsubscribeToken
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Unsubscription{}, ErrInvalidUnsubscribeToken
+	}
+	unsubscription := Unsubscription{UserID: userID}
+	if unsubscription.AlertID, err = parseOptionalID(claims.AlertID); err != nil {
+		return Unsubscription{}, ErrInvalidUnsubscribeToken
+	}
+	if unsubscription.ListingID, err = parseOptionalID(claims.ListingID); err != nil {
+		return Unsubscription{}, ErrInvalidUnsubscribeToken
+	}
+	return unsubscription, nil
+}
+
+func parseOptionalID(id string) (uuid.NullUUID, error) {
+	if id == "" {
+		return uuid.NullUUID{}, nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: parsed, Valid: true}, nil
+}
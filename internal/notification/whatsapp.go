@@ -0,0 +1,313 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+)
+
+// DefaultWhatsAppAPIURL is the WhatsApp Business Cloud API base url.
+const DefaultWhatsAppAPIURL = "https://graph.facebook.com/v19.0"
+
+// ProviderError is an error reported by a delivery provider, with the
+// provider's own error code so it ends up in the notification's last_error.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s error %d (http %d): %s", e.Provider, e.Code, e.StatusCode, e.Message)
+}
+
+// whatsAppRetryableCodes are Cloud API error codes for rate limits and
+// temporary outages; every other client error is permanent.
+var whatsAppRetryableCodes = map[int]bool{
+	1:      true, // unknown API error
+	2:      true, // service temporarily unavailable
+	4:      true, // app rate limit
+	80007:  true, // business account rate limit
+	130429: true, // throughput rate limit
+	131016: true, // service unavailable
+	131048: true, // spam rate limit
+	131056: true, // pair rate limit
+}
+
+// WhatsAppSender sends notifications as WhatsApp template messages through the
+// Cloud API. New matches use TemplateName, which takes four body parameters:
+// the listing title, price, location and a link to the listing, in that order.
+// Rented listings use RentedTemplateName, which takes the title, location and
+// link. Price drops use PriceDropTemplateName and price rises
+// PriceRiseTemplateName, which both take the title, old price, new price,
+// location and link. Digests use DigestTemplateName, which
+// takes the number of listings, their locations and a link to all listings.
+// Every template takes the unsubscribe link as its last parameter. An event
+// without a template fails permanently, so the next channel in the user's
+// priority is tried.
+type WhatsAppSender struct {
+	APIURL                string
+	PhoneNumberID         string
+	AccessToken           string
+	TemplateName          string
+	RentedTemplateName    string
+	PriceDropTemplateName string
+	PriceRiseTemplateName string
+	DigestTemplateName    string
+	Language              string
+	// ListingBaseURL is prefixed to /listings/{id} to build the link parameter
+	ListingBaseURL string
+	DB             *database.Queries
+	Client         *http.Client
+}
+
+func NewWhatsAppSender(db *database.Queries, phoneNumberID, accessToken, templateName, listingBaseURL string) *WhatsAppSender {
+	return &WhatsAppSender{
+		APIURL:         DefaultWhatsAppAPIURL,
+		PhoneNumberID:  phoneNumberID,
+		AccessToken:    accessToken,
+		TemplateName:   templateName,
+		Language:       "en",
+		ListingBaseURL: listingBaseURL,
+		DB:             db,
+		Client:         &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type whatsAppMessage struct {
+	MessagingProduct string           `json:"messaging_product"`
+	To               string           `json:"to"`
+	Type             string           `json:"type"`
+	Template         whatsAppTemplate `json:"template"`
+}
+
+type whatsAppTemplate struct {
+	Name       string              `json:"name"`
+	Language   whatsAppLanguage    `json:"language"`
+	Components []whatsAppComponent `json:"components"`
+}
+
+type whatsAppLanguage struct {
+	Code string `json:"code"`
+}
+
+type whatsAppComponent struct {
+	Type       string              `json:"type"`
+	Parameters []whatsAppParameter `json:"parameters"`
+}
+
+type whatsAppParameter struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type whatsAppResponse struct {
+	Messages []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+	Error *struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+func (s *WhatsAppSender) Send(ctx context.Context, notification Notification) (string, error) {
+	to, err := NormalizePhoneNumber(notification.Contact)
+	if err != nil {
+		return "", Permanent(err)
+	}
+	templateName, params, err := s.template(ctx, notification)
+	if err != nil {
+		return "", err
+	}
+	// an approved template takes a fixed number of parameters, so the
+	// unsubscribe link is always sent; notifications from before signed links
+	// get the site, where the alert can still be turned off
+	unsubscribeURL := notification.UnsubscribeURL
+	if unsubscribeURL == "" {
+		unsubscribeURL = s.ListingBaseURL
+	}
+	params = append(params, whatsAppParameter{Type: "text", Text: unsubscribeURL})
+
+	body, err := json.Marshal(whatsAppMessage{
+		MessagingProduct: "whatsapp",
+		// the Cloud API takes the number without the leading +
+		To:   strings.TrimPrefix(to, "+"),
+		Type: "template",
+		Template: whatsAppTemplate{
+			Name:     templateName,
+			Language: whatsAppLanguage{Code: s.Language},
+			Components: []whatsAppComponent{{
+				Type:       "body",
+				Parameters: params,
+			}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling whatsapp message. err: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/messages", strings.TrimSuffix(s.APIURL, "/"), s.PhoneNumberID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", Permanent(fmt.Errorf("error creating whatsapp request. err: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling whatsapp api. err: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+
+	waResp := whatsAppResponse{}
+	decodeErr := json.Unmarshal(respBody, &waResp)
+	if resp.StatusCode >= 300 {
+		providerErr := &ProviderError{Provider: "whatsapp", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+		if decodeErr == nil && waResp.Error != nil {
+			providerErr.Code = waResp.Error.Code
+			providerErr.Message = waResp.Error.Message
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || whatsAppRetryableCodes[providerErr.Code] {
+			return "", providerErr
+		}
+		return "", Permanent(providerErr)
+	}
+	if decodeErr != nil || len(waResp.Messages) == 0 {
+		return "", fmt.Errorf("unexpected whatsapp api response: %s", string(respBody))
+	}
+	return waResp.Messages[0].ID, nil
+}
+
+// template picks the template for the notification and fills in its parameters.
+func (s *WhatsAppSender) template(ctx context.Context, notification Notification) (string, []whatsAppParameter, error) {
+	if notification.Event == EventDigest {
+		if s.DigestTemplateName == "" {
+			return "", nil, Permanent(errors.New("no whatsapp digest template configured"))
+		}
+		listings, err := s.DB.GetDigestListings(ctx, uuid.NullUUID{UUID: notification.ID, Valid: true})
+		if err != nil {
+			return "", nil, fmt.Errorf("error getting digest listings. err: %v", err)
+		}
+		link := strings.TrimSuffix(s.ListingBaseURL, "/") + "/listings"
+		return s.DigestTemplateName, whatsAppDigestParams(listings, link), nil
+	}
+
+	templateName := s.listingTemplateName(notification.Event)
+	if templateName == "" {
+		return "", nil, Permanent(fmt.Errorf("no whatsapp template configured for %s notifications", notification.Event))
+	}
+	if !notification.ListingID.Valid {
+		return "", nil, Permanent(fmt.Errorf("notification %s has no listing", notification.ID))
+	}
+	listing, err := s.DB.GetListing(ctx, notification.ListingID.UUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, Permanent(fmt.Errorf("listing %s no longer exists", notification.ListingID.UUID))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting listing. err: %v", err)
+	}
+	link := s.listingLink(listing)
+	switch notification.Event {
+	case EventListingRented:
+		return templateName, whatsAppRentedParams(listing, link), nil
+	case EventPriceDrop, EventPriceRise:
+		// the price change was recorded with the notification
+		change, err := s.DB.GetListingPriceAt(ctx, database.GetListingPriceAtParams{
+			ListingID: listing.ID,
+			At:        notification.CreatedAt,
+		})
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !change.PreviousPrice.Valid) {
+			return "", nil, Permanent(fmt.Errorf("no price change recorded for listing %s", listing.ID))
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("error getting listing price change. err: %v", err)
+		}
+		return templateName, whatsAppPriceChangeParams(listing, change.PreviousPrice.Int64, link), nil
+	}
+	return templateName, whatsAppTemplateParams(listing, link), nil
+}
+
+// listingTemplateName is the template for a listing event, empty when none is configured.
+func (s *WhatsAppSender) listingTemplateName(event string) string {
+	switch event {
+	case EventListingRented:
+		return s.RentedTemplateName
+	case EventPriceDrop:
+		return s.PriceDropTemplateName
+	case EventPriceRise:
+		return s.PriceRiseTemplateName
+	}
+	return s.TemplateName
+}
+
+func (s *WhatsAppSender) listingLink(listing database.Listing) string {
+	return fmt.Sprintf("%s/listings/%s", strings.TrimSuffix(s.ListingBaseURL, "/"), listing.ID)
+}
+
+// whatsAppTemplateParams maps a listing onto the template's {{1}}..{{4}} body
+// parameters. Send adds the unsubscribe link as {{5}}, so the template must
+// take exactly 5.
+func whatsAppTemplateParams(listing database.Listing, link string) []whatsAppParameter {
+	values := []string{listing.Title, formatNaira(listing.Price), listing.Location, link}
+	params := []whatsAppParameter{}
+	for _, value := range values {
+		params = append(params, whatsAppParameter{Type: "text", Text: value})
+	}
+	return params
+}
+
+// whatsAppRentedParams maps a rented listing onto the rented template's
+// {{1}}..{{3}} body parameters. Send adds the unsubscribe link as {{4}}.
+func whatsAppRentedParams(listing database.Listing, link string) []whatsAppParameter {
+	return []whatsAppParameter{
+		{Type: "text", Text: listing.Title},
+		{Type: "text", Text: listing.Location},
+		{Type: "text", Text: link},
+	}
+}
+
+// whatsAppPriceChangeParams maps a price change onto the price drop and price
+// rise templates' {{1}}..{{5}} body parameters. Send adds the unsubscribe link
+// as {{6}}.
+func whatsAppPriceChangeParams(listing database.Listing, oldPrice int64, link string) []whatsAppParameter {
+	return []whatsAppParameter{
+		{Type: "text", Text: listing.Title},
+		{Type: "text", Text: formatNaira(oldPrice)},
+		{Type: "text", Text: formatNaira(listing.Price)},
+		{Type: "text", Text: listing.Location},
+		{Type: "text", Text: link},
+	}
+}
+
+// whatsAppDigestParams maps a digest onto the digest template's {{1}}..{{3}}
+// body parameters. Send adds the unsubscribe link as {{4}}.
+func whatsAppDigestParams(listings []database.Listing, link string) []whatsAppParameter {
+	locations := []string{}
+	seen := map[string]bool{}
+	for _, listing := range listings {
+		if !seen[listing.Location] {
+			seen[listing.Location] = true
+			locations = append(locations, listing.Location)
+		}
+	}
+	return []whatsAppParameter{
+		{Type: "text", Text: strconv.Itoa(len(listings))},
+		{Type: "text", Text: strings.Join(locations, ", ")},
+		{Type: "text", Text: link},
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/muhammadolammi/rentradar/internal/database"
 	"github.com/muhammadolammi/rentradar/internal/handlers"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 func main() {
@@ -28,6 +33,13 @@ func main() {
 		log.Println("empty dbURL")
 		return
 	}
+	// rabbitmq (default) or memory
+	notification_broker := os.Getenv("NOTIFICATION_BROKER")
+	rabbitmq_url := os.Getenv("RABBITMQ_URL")
+	if rabbitmq_url == "" && notification_broker != "memory" {
+		log.Println("empty rabbitmqURL")
+		return
+	}
 	api_key := os.Getenv("API_KEY")
 	if dbURL == "" {
 		log.Println("empty apiKEY")
@@ -43,6 +55,30 @@ func main() {
 		log.Println("empty sudoKEY")
 		return
 	}
+	listing_base_url := os.Getenv("LISTING_BASE_URL")
+	if listing_base_url == "" {
+		log.Println("empty listingBaseURL")
+		return
+	}
+	public_api_url := os.Getenv("PUBLIC_API_URL")
+	if public_api_url == "" {
+		log.Println("empty publicApiURL")
+		return
+	}
+	unsubscribe_secret := os.Getenv("UNSUBSCRIBE_SECRET")
+	if unsubscribe_secret == "" {
+		log.Println("empty unsubscribeSECRET")
+		return
+	}
+	max_alerts_per_user := 20
+	if value := os.Getenv("MAX_ALERTS_PER_USER"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("invalid MAX_ALERTS_PER_USER %q, use a whole number, 0 for no cap", value)
+			return
+		}
+		max_alerts_per_user = parsed
+	}
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -51,12 +87,51 @@ func main() {
 	}
 	dbQueries := database.New(db)
 
+	// the location hierarchy ships with the binary
+	if err := locations.Seed(context.Background(), dbQueries); err != nil {
+		log.Println(err)
+		return
+	}
+
+	broker, err := notification.NewBroker(notification_broker, rabbitmq_url)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer broker.Close()
+
+	// the notification workers run in this process whichever broker carries the queue
+	notificationConfig, err := notification.ConfigFromEnv(db, broker)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	//  3 workers consume the notifications queue and send each message, acking it once it is handled.
+	notificationConfig.StartWorkerPool(context.Background(), 3)
+	//  Every minute, re-publish notifications the API couldn't hand to the broker.
+	notificationConfig.StartSweeper(context.Background(), time.Minute, time.Minute)
+	//  Every minute, roll held matches from finished hourly and daily windows into digests.
+	notificationConfig.StartDigestScheduler(context.Background(), time.Minute)
+
 	apiConfig := handlers.Config{
-		PORT:    port,
-		DB:      dbQueries,
-		APIKEY:  api_key,
-		JWTKEY:  jwt_key,
-		SUDOKEY: sudo_key,
+		PORT:      port,
+		DB:        dbQueries,
+		DBConn:    db,
+		Publisher: notification.NewPublisher(broker),
+		APIKEY:    api_key,
+		JWTKEY:    jwt_key,
+		SUDOKEY:   sudo_key,
+
+		ListingBaseURL: listing_base_url,
+		Unsubscriber:   notification.NewUnsubscriber(public_api_url, unsubscribe_secret),
+		// optional, defaults to 20
+		MaxAlertsPerUser: max_alerts_per_user,
+		Channels:         notificationConfig.EnabledChannels(),
+		// optional, the matching webhook answers 503 until its secret is set
+		EmailWebhookSecret:  os.Getenv("EMAIL_WEBHOOK_SECRET"),
+		SMSWebhookSecret:    os.Getenv("SMS_WEBHOOK_SECRET"),
+		WhatsAppAppSecret:   os.Getenv("WHATSAPP_APP_SECRET"),
+		WhatsAppVerifyToken: os.Getenv("WHATSAPP_VERIFY_TOKEN"),
 	}
 	server(&apiConfig)
 }
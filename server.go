@@ -17,7 +17,7 @@ func server(apiConfig *handlers.Config) {
 	corsOptions := cors.Options{
 		AllowedOrigins: []string{"http://localhost"},
 
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"}, // You can customize this based on your needs
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum age for cache, in seconds
@@ -32,38 +32,71 @@ func server(apiConfig *handlers.Config) {
 	router.Use(middleware.Recoverer)
 
 	router.Use(cors.Handler(corsOptions))
-	router.Use(apiConfig.VerifyApiKey())
 
-	// ADD ROUTES
-	apiRoute.Get("/hello", handlers.SuccessResponse)
-	apiRoute.Get("/error", handlers.ErrorResponse)
+	// provider webhooks authenticate with their own signatures, not the API key
+	router.Post("/webhooks/email", apiConfig.EmailWebhookHandler)
+	router.Post("/webhooks/sms", apiConfig.SMSWebhookHandler)
+	router.Get("/webhooks/whatsapp", apiConfig.WhatsAppWebhookVerifyHandler)
+	router.Post("/webhooks/whatsapp", apiConfig.WhatsAppWebhookHandler)
+	// unsubscribe links are opened from messages, the signed token is the auth
+	router.Get("/unsubscribe/{token}", apiConfig.GetUnsubscribeHandler)
+	router.Post("/unsubscribe/{token}", apiConfig.PostUnsubscribeHandler)
 
-	// Handle Auth
-	apiRoute.Post("/register", apiConfig.RegisterHandler)
-	apiRoute.Post("/login", apiConfig.LoginHandler)
+	router.Group(func(router chi.Router) {
+		router.Use(apiConfig.VerifyApiKey())
 
-	// users Handlers
-	apiRoute.Get("/user", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetUserHandler))
+		// ADD ROUTES
+		apiRoute.Get("/hello", handlers.SuccessResponse)
+		apiRoute.Get("/error", handlers.ErrorResponse)
 
-	//  Listings handlers
-	apiRoute.Get("/listings", apiConfig.GetListingsHandler)
-	apiRoute.Post("/listings", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostListingsHandler))
-	apiRoute.Get("/listings/{ID}", apiConfig.GetListingHandler)
+		// Handle Auth
+		apiRoute.Post("/register", apiConfig.RegisterHandler)
+		apiRoute.Post("/login", apiConfig.LoginHandler)
 
-	// Listing handlers
-	apiRoute.Post("/listings", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostListingsHandler))
-	router.Get("/listings/{ID}", apiConfig.GetListingHandler)
-	router.Get("/listings", apiConfig.GetListingsHandler)
+		// users Handlers
+		apiRoute.Get("/user", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetUserHandler))
+		apiRoute.Get("/user/preferences", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetPreferencesHandler))
+		apiRoute.Put("/user/preferences", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PutPreferencesHandler))
 
-	// alert handlers
-	router.Post("/alerts", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostAlertsHandler))
-	router.Get("/alerts", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetAlertsHandler))
+		//  Listings handlers
+		apiRoute.Get("/listings", apiConfig.GetListingsHandler)
+		apiRoute.Post("/listings", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostListingsHandler))
+		apiRoute.Get("/listings/{ID}", apiConfig.GetListingHandler)
+		apiRoute.Get("/locations", apiConfig.GetLocationsHandler)
+		apiRoute.Get("/locations/autocomplete", apiConfig.GetLocationsAutocompleteHandler)
+		apiRoute.Get("/listings/{ID}/price-history", apiConfig.GetListingPriceHistoryHandler)
+		apiRoute.Patch("/listings/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PatchListingHandler))
+		apiRoute.Delete("/listings/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.DeleteListingHandler))
 
-	// favorite handlers
-	router.Post("/favorites", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostFavoritesHandler))
-	router.Get("/favorites", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetFavoritesHandler))
+		// Listing handlers
+		apiRoute.Post("/listings", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostListingsHandler))
+		router.Get("/listings/{ID}", apiConfig.GetListingHandler)
+		router.Get("/locations", apiConfig.GetLocationsHandler)
+		router.Get("/locations/autocomplete", apiConfig.GetLocationsAutocompleteHandler)
+		router.Get("/listings/{ID}/price-history", apiConfig.GetListingPriceHistoryHandler)
+		router.Patch("/listings/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PatchListingHandler))
+		router.Delete("/listings/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.DeleteListingHandler))
+		router.Get("/listings", apiConfig.GetListingsHandler)
+
+		// alert handlers
+		router.Post("/alerts", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostAlertsHandler))
+		router.Get("/alerts", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetAlertsHandler))
+		router.Get("/alerts/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetAlertHandler))
+		router.Patch("/alerts/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PatchAlertHandler))
+		router.Delete("/alerts/{ID}", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.DeleteAlertHandler))
+
+		// favorite handlers
+		router.Post("/favorites", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.PostFavoritesHandler))
+		router.Get("/favorites", apiConfig.AuthMiddleware(false, []byte(apiConfig.JWTKEY), apiConfig.GetFavoritesHandler))
+
+		// admin handlers
+		router.Get("/admin/dead-letters", apiConfig.AuthMiddleware(true, []byte(apiConfig.JWTKEY), apiConfig.GetDeadLettersHandler))
+		router.Post("/admin/dead-letters/{ID}/replay", apiConfig.AuthMiddleware(true, []byte(apiConfig.JWTKEY), apiConfig.ReplayDeadLetterHandler))
+		router.Get("/admin/templates/{event}/{channel}/preview", apiConfig.AuthMiddleware(true, []byte(apiConfig.JWTKEY), apiConfig.PreviewTemplateHandler))
+
+		router.Mount("/api", apiRoute)
+	})
 
-	router.Mount("/api", apiRoute)
 	srv := &http.Server{
 		Addr:              ":" + apiConfig.PORT,
 		Handler:           router,
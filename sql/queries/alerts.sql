@@ -2,8 +2,11 @@
 
 -- name: CreateAlert :one
 INSERT INTO alerts (
-user_id, min_price,max_price, location, property_type,contact_method )
-VALUES ( $1, $2, $3, $4, $5,$6)
+user_id, min_price,max_price, locations, property_type,contact_method, frequency, expires_at,
+latitude, longitude, radius_km, min_bedrooms, max_bedrooms, min_bathrooms, max_bathrooms,
+include_keywords, exclude_keywords, location_ids )
+VALUES ( $1, $2, $3, coalesce($4::text[], '{}'), $5,$6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+coalesce($16::text[], '{}'), coalesce($17::text[], '{}'), coalesce($18::uuid[], '{}'))
 RETURNING *;
 
 
@@ -12,4 +15,72 @@ SELECT * FROM alerts WHERE $1=id;
 
 
 -- name: GetUserAlerts :many
-SELECT * FROM alerts WHERE $1=user_id;
\ No newline at end of file
+SELECT * FROM alerts WHERE $1=user_id;
+
+-- name: CountUserAlerts :one
+SELECT count(*) FROM alerts WHERE user_id = $1;
+
+-- name: GetMatchingAlerts :many
+SELECT * FROM alerts
+WHERE min_price <= sqlc.arg('price')::bigint
+  AND max_price >= sqlc.arg('price')::bigint
+  AND (
+    (cardinality(locations) = 0 AND cardinality(location_ids) = 0)
+    OR EXISTS (SELECT 1 FROM unnest(locations) l WHERE lower(l) = lower(sqlc.arg('location')::text))
+    -- the listing's location or any place it's in
+    OR location_ids && ARRAY(
+      WITH RECURSIVE up AS (
+        SELECT id, parent_id FROM locations WHERE id = sqlc.narg('location_id')::uuid
+        UNION ALL
+        SELECT l.id, l.parent_id FROM locations l JOIN up ON l.id = up.parent_id
+      )
+      SELECT id FROM up
+    )
+  )
+  AND lower(property_type) = lower(sqlc.arg('property_type')::text)
+  AND (min_bedrooms = 0 OR sqlc.narg('bedrooms')::int >= min_bedrooms)
+  AND (max_bedrooms = 0 OR sqlc.narg('bedrooms')::int <= max_bedrooms)
+  AND (min_bathrooms = 0 OR sqlc.narg('bathrooms')::int >= min_bathrooms)
+  AND (max_bathrooms = 0 OR sqlc.narg('bathrooms')::int <= max_bathrooms)
+  AND active
+  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP);
+
+-- name: DisableAlert :exec
+UPDATE alerts
+SET active = false, disabled_reason = $2
+WHERE id = $1;
+
+-- name: UpdateAlert :one
+UPDATE alerts
+SET
+  min_price = $2,
+  max_price = $3,
+  locations = coalesce($4::text[], '{}'),
+  property_type = $5,
+  contact_method = $6,
+  frequency = $7,
+  active = $8,
+  disabled_reason = $9,
+  expires_at = $10,
+  latitude = $11,
+  longitude = $12,
+  radius_km = $13,
+  min_bedrooms = $14,
+  max_bedrooms = $15,
+  min_bathrooms = $16,
+  max_bathrooms = $17,
+  include_keywords = coalesce($18::text[], '{}'),
+  exclude_keywords = coalesce($19::text[], '{}'),
+  location_ids = coalesce($20::uuid[], '{}')
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUnlocatedAlerts :many
+SELECT * FROM alerts
+WHERE cardinality(location_ids) = 0 AND cardinality(locations) > 0;
+
+-- name: SetAlertLocations :exec
+UPDATE alerts SET location_ids = coalesce($2::uuid[], '{}') WHERE id = $1;
+
+-- name: DeleteAlert :exec
+DELETE FROM alerts WHERE id = $1;
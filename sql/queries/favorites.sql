@@ -5,3 +5,14 @@ RETURNING *;
 
 -- name: GetUserFavorites :many
 SELECT * FROM favorites WHERE user_id = $1;
+
+-- name: GetListingFavoriteUsers :many
+SELECT users.* FROM favorites
+JOIN users ON users.id = favorites.user_id
+WHERE favorites.listing_id = $1;
+
+-- name: DeleteListingFavorites :exec
+DELETE FROM favorites WHERE listing_id = $1;
+
+-- name: DeleteFavorite :exec
+DELETE FROM favorites WHERE user_id = $1 AND listing_id = $2;
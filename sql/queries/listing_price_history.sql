@@ -0,0 +1,15 @@
+-- name: CreateListingPrice :one
+INSERT INTO listing_price_history (listing_id, price, previous_price)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetListingPriceHistory :many
+SELECT * FROM listing_price_history
+WHERE listing_id = $1
+ORDER BY changed_at;
+
+-- name: GetListingPriceAt :one
+SELECT * FROM listing_price_history
+WHERE listing_id = sqlc.arg('listing_id') AND changed_at <= sqlc.arg('at')
+ORDER BY changed_at DESC
+LIMIT 1;
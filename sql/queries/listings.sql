@@ -1,25 +1,99 @@
 
 -- name: GetListings :many
-SELECT *
-FROM listings
-WHERE
-  (location = coalesce(sqlc.narg('location'), location))
-  AND (price >= coalesce(sqlc.narg('min_price')::bigint, price))
-  AND (price <= coalesce(sqlc.narg('max_price')::bigint, price))
-  AND (property_type = coalesce(sqlc.narg('property_type'), property_type))
-ORDER BY created_at DESC
-LIMIT sqlc.arg('limit')
-OFFSET sqlc.arg('offset');
+SELECT sqlc.embed(listings), m.distance_km, m.rank,
+  -- the best fragments of the description, matches between U+E000 and U+E001
+  CASE WHEN m.query IS NOT NULL THEN ts_headline('english', listings.description, m.query,
+    'StartSel=' || chr(57344) || ', StopSel=' || chr(57345) || ', MaxFragments=2, MaxWords=20, MinWords=8')
+  END AS snippet
+FROM search_listings(
+  sqlc.narg('location')::text, sqlc.narg('min_price')::bigint, sqlc.narg('max_price')::bigint, sqlc.narg('property_type')::text,
+  sqlc.narg('min_bedrooms')::int, sqlc.narg('min_bathrooms')::int, sqlc.narg('furnishing')::text, sqlc.narg('serviced')::boolean,
+  sqlc.narg('rent_period')::text, sqlc.narg('max_move_in_cost')::bigint,
+  sqlc.narg('near_lat')::float8, sqlc.narg('near_lng')::float8, sqlc.narg('radius_km')::float8,
+  sqlc.narg('min_lat')::float8, sqlc.narg('min_lng')::float8, sqlc.narg('max_lat')::float8, sqlc.narg('max_lng')::float8,
+  sqlc.narg('location_id')::uuid, sqlc.narg('search')::text, sqlc.arg('require_distance')::boolean
+) m
+JOIN listings ON listings.id = m.listing_id
+-- keyset pagination: only the listings after the cursor in the sort order
+WHERE (sqlc.narg('cursor_id')::uuid IS NULL OR CASE sqlc.arg('sort')::text
+    WHEN 'price_asc' THEN (listings.price, listings.id) > (sqlc.narg('cursor_price')::bigint, sqlc.narg('cursor_id')::uuid)
+    WHEN 'price_desc' THEN (listings.price, listings.id) < (sqlc.narg('cursor_price')::bigint, sqlc.narg('cursor_id')::uuid)
+    WHEN 'distance' THEN (m.distance_km, listings.id) > (sqlc.narg('cursor_score')::float8, sqlc.narg('cursor_id')::uuid)
+    WHEN 'relevance' THEN (m.rank, listings.id) < (sqlc.narg('cursor_score')::float8, sqlc.narg('cursor_id')::uuid)
+    ELSE (listings.created_at, listings.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  END)
+ORDER BY
+  CASE WHEN sqlc.arg('sort')::text = 'price_asc' THEN listings.price END ASC,
+  CASE WHEN sqlc.arg('sort')::text = 'price_desc' THEN listings.price END DESC,
+  CASE WHEN sqlc.arg('sort')::text = 'distance' THEN m.distance_km END ASC,
+  CASE WHEN sqlc.arg('sort')::text = 'relevance' THEN m.rank END DESC,
+  CASE WHEN sqlc.arg('sort')::text = 'newest' THEN listings.created_at END DESC,
+  CASE WHEN sqlc.arg('sort')::text IN ('price_asc', 'distance') THEN listings.id END ASC,
+  CASE WHEN sqlc.arg('sort')::text NOT IN ('price_asc', 'distance') THEN listings.id END DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CountListings :one
+SELECT count(*)
+FROM search_listings(
+  sqlc.narg('location')::text, sqlc.narg('min_price')::bigint, sqlc.narg('max_price')::bigint, sqlc.narg('property_type')::text,
+  sqlc.narg('min_bedrooms')::int, sqlc.narg('min_bathrooms')::int, sqlc.narg('furnishing')::text, sqlc.narg('serviced')::boolean,
+  sqlc.narg('rent_period')::text, sqlc.narg('max_move_in_cost')::bigint,
+  sqlc.narg('near_lat')::float8, sqlc.narg('near_lng')::float8, sqlc.narg('radius_km')::float8,
+  sqlc.narg('min_lat')::float8, sqlc.narg('min_lng')::float8, sqlc.narg('max_lat')::float8, sqlc.narg('max_lng')::float8,
+  sqlc.narg('location_id')::uuid, sqlc.narg('search')::text, sqlc.arg('require_distance')::boolean
+) m;
 
 -- name: CreateListing :one
 INSERT INTO listings (
 agent_id, title,
-description, price,location,property_type,images, status  )
-VALUES ( $1, $2, $3, $4, $5,$6,$7,$8)
+description, price,location,property_type,images, status,
+latitude, longtitude, bedrooms, bathrooms,
+furnishing, serviced, rent_period, agency_fee, legal_fee, caution_fee, location_id  )
+VALUES ( $1, $2, $3, $4, $5,$6,$7,$8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 RETURNING *;
 
 
 
 
 -- name: GetListing :one
-SELECT * FROM listings WHERE $1=id;
\ No newline at end of file
+SELECT * FROM listings WHERE $1=id;
+
+-- name: UpdateListing :one
+UPDATE listings
+SET
+  title = $2,
+  description = $3,
+  price = $4,
+  location = $5,
+  property_type = $6,
+  images = $7,
+  latitude = $8,
+  longtitude = $9,
+  bedrooms = $10,
+  bathrooms = $11,
+  furnishing = $13,
+  serviced = $14,
+  rent_period = $15,
+  agency_fee = $16,
+  legal_fee = $17,
+  caution_fee = $18,
+  location_id = $19,
+  status_changed_at = CASE WHEN status <> $12 THEN CURRENT_TIMESTAMP ELSE status_changed_at END,
+  rented_at = CASE WHEN $12 = 'rented' AND status <> 'rented' THEN CURRENT_TIMESTAMP ELSE rented_at END,
+  status = $12,
+  updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUnlocatedListings :many
+SELECT * FROM listings WHERE location_id IS NULL;
+
+-- name: SetListingLocation :exec
+UPDATE listings SET location_id = $2 WHERE id = $1;
+
+-- name: DeleteListing :exec
+UPDATE listings
+SET
+  deleted_at = CURRENT_TIMESTAMP,
+  updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND deleted_at IS NULL;
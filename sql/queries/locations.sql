@@ -0,0 +1,52 @@
+-- name: UpsertLocation :one
+INSERT INTO locations (slug, parent_id, name, kind, depth, keys, search_text)
+VALUES ($1, $2, $3, $4, $5, $6, array_to_string($6::text[], ' '))
+ON CONFLICT (slug) DO UPDATE
+SET
+  parent_id = EXCLUDED.parent_id,
+  name = EXCLUDED.name,
+  kind = EXCLUDED.kind,
+  depth = EXCLUDED.depth,
+  keys = EXCLUDED.keys,
+  search_text = EXCLUDED.search_text
+RETURNING *;
+
+-- name: AutocompleteLocations :many
+SELECT sqlc.embed(locations), m.score
+FROM locations
+CROSS JOIN LATERAL (
+  -- an exact key beats a prefix of one, which beats a fuzzy match
+  SELECT greatest(
+    (SELECT CASE WHEN bool_or(k = sqlc.arg('query')::text) THEN 2 WHEN bool_or(k LIKE sqlc.arg('query')::text || '%') THEN 1.5 ELSE 0 END FROM unnest(keys) k),
+    word_similarity(sqlc.arg('query')::text, search_text)
+  )::float8 AS score
+) m
+WHERE (
+    EXISTS (SELECT 1 FROM unnest(keys) k WHERE k LIKE sqlc.arg('query')::text || '%')
+    OR sqlc.arg('query')::text <% search_text
+  )
+  AND kind = coalesce(sqlc.narg('kind'), kind)
+ORDER BY m.score DESC, depth, name
+LIMIT sqlc.arg('limit');
+
+-- name: GetLocation :one
+SELECT * FROM locations WHERE id = $1;
+
+-- name: GetLocationsByKey :many
+SELECT * FROM locations
+WHERE sqlc.arg('key')::text = ANY(keys)
+ORDER BY depth, slug;
+
+-- name: GetLocationAncestors :many
+WITH RECURSIVE up AS (
+  SELECT * FROM locations WHERE id = $1
+  UNION ALL
+  SELECT l.* FROM locations l JOIN up ON l.id = up.parent_id
+)
+SELECT * FROM up
+ORDER BY depth;
+
+-- name: GetChildLocations :many
+SELECT * FROM locations
+WHERE parent_id IS NOT DISTINCT FROM sqlc.narg('parent_id')
+ORDER BY name;
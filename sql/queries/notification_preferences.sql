@@ -0,0 +1,19 @@
+-- name: GetNotificationPreferences :one
+SELECT * FROM notification_preferences WHERE user_id = $1;
+
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (
+user_id, quiet_hours_start, quiet_hours_end,
+timezone, channel_priority, muted, daily_cap  )
+VALUES ( $1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id) DO UPDATE
+SET
+  quiet_hours_start = EXCLUDED.quiet_hours_start,
+  quiet_hours_end = EXCLUDED.quiet_hours_end,
+  timezone = EXCLUDED.timezone,
+  channel_priority = EXCLUDED.channel_priority,
+  muted = EXCLUDED.muted,
+  daily_cap = EXCLUDED.daily_cap,
+  updated_at = CURRENT_TIMESTAMP
+RETURNING *;
@@ -1,13 +1,191 @@
 
-
 -- name: GetUnsentNotifications :many
 SELECT * FROM notifications
-WHERE status="pending";
+WHERE status = 'pending';
 
 
 -- name: CreateNotification :one
 INSERT INTO notifications (
-user_id, listing_id,
-sent_at, contact, contact_method, status  )
-VALUES ( $1, $2, $3, $4, $5,$6)
+user_id, listing_id, alert_id,
+contact, contact_method, status, subject, body, event, html_body, unsubscribe_url  )
+VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 RETURNING *;
+
+
+-- name: GetNotification :one
+SELECT * FROM notifications WHERE $1=id;
+
+
+-- name: MarkNotificationSent :exec
+UPDATE notifications
+SET
+  status = 'sent',
+  attempts = attempts + 1,
+  last_error = NULL,
+  last_attempt_at = CURRENT_TIMESTAMP,
+  sent_at = CURRENT_TIMESTAMP,
+  provider_message_id = $2
+WHERE id = $1;
+
+
+-- name: MarkNotificationAttemptFailed :exec
+UPDATE notifications
+SET
+  status = $2,
+  attempts = attempts + 1,
+  last_error = $3,
+  last_attempt_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+
+-- name: ClaimPendingNotifications :many
+SELECT * FROM notifications
+WHERE status = 'pending'
+  AND created_at < CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg('min_age_seconds')::float8)
+  AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP)
+ORDER BY created_at
+LIMIT sqlc.arg('batch_size')
+FOR UPDATE SKIP LOCKED;
+
+
+-- name: MarkNotificationEnqueued :exec
+UPDATE notifications
+SET status = 'enqueued'
+WHERE id = $1 AND status = 'pending'
+  AND (deliver_after IS NULL OR deliver_after <= CURRENT_TIMESTAMP);
+
+
+-- name: GetNotificationByProviderMessageID :one
+SELECT * FROM notifications
+WHERE contact_method = $1 AND provider_message_id = $2;
+
+
+-- name: UpdateNotificationDeliveryStatus :exec
+UPDATE notifications
+SET
+  status = sqlc.arg('status'),
+  last_error = COALESCE(sqlc.narg('last_error'), last_error),
+  delivered_at = CASE
+    WHEN sqlc.arg('status') IN ('delivered', 'read') THEN COALESCE(delivered_at, CURRENT_TIMESTAMP)
+    ELSE delivered_at
+  END,
+  read_at = CASE
+    WHEN sqlc.arg('status') = 'read' THEN COALESCE(read_at, CURRENT_TIMESTAMP)
+    ELSE read_at
+  END
+WHERE id = sqlc.arg('id');
+
+
+-- name: CountRecentUndeliverableNotifications :one
+SELECT count(*) FROM (
+  SELECT status FROM notifications
+  WHERE alert_id = sqlc.arg('alert_id')
+    AND status IN ('sent', 'delivered', 'read', 'bounced', 'failed')
+  ORDER BY created_at DESC
+  LIMIT sqlc.arg('recent')
+) recent
+WHERE status IN ('bounced', 'failed');
+
+
+-- name: ClaimHeldNotifications :many
+SELECT notifications.* FROM notifications
+JOIN alerts ON alerts.id = notifications.alert_id
+WHERE notifications.status = 'held'
+  AND alerts.frequency = sqlc.arg('frequency')
+  AND notifications.created_at < sqlc.arg('before')
+  AND alerts.active
+  AND (alerts.expires_at IS NULL OR alerts.expires_at > CURRENT_TIMESTAMP)
+ORDER BY notifications.user_id, notifications.created_at
+FOR UPDATE OF notifications SKIP LOCKED;
+
+
+-- name: SuppressListingNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE listing_id = $1 AND status IN ('pending', 'held');
+
+
+-- name: SuppressInactiveHeldNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = 'alert paused, disabled or expired'
+FROM alerts
+WHERE alerts.id = notifications.alert_id
+  AND notifications.status = 'held'
+  AND (NOT alerts.active OR alerts.expires_at <= CURRENT_TIMESTAMP);
+
+
+-- name: MarkNotificationsDigested :exec
+UPDATE notifications
+SET status = 'digested', digest_id = sqlc.arg('digest_id')
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+
+-- name: GetDigestListings :many
+SELECT listings.* FROM notifications
+JOIN listings ON listings.id = notifications.listing_id
+WHERE notifications.digest_id = $1
+ORDER BY notifications.created_at;
+
+
+-- name: GetDigestFrequency :one
+SELECT alerts.frequency FROM notifications
+JOIN alerts ON alerts.id = notifications.alert_id
+WHERE notifications.digest_id = $1
+LIMIT 1;
+
+
+-- name: CountNotificationsSentSince :one
+SELECT count(*) FROM notifications
+WHERE user_id = sqlc.arg('user_id')
+  AND status IN ('sent', 'delivered', 'read', 'bounced')
+  AND sent_at >= CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg('since_seconds')::float8);
+
+
+-- name: DeferNotification :exec
+UPDATE notifications
+SET
+  status = 'pending',
+  deliver_after = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg('delay_seconds')::float8),
+  last_error = sqlc.arg('last_error')
+WHERE id = sqlc.arg('id');
+
+
+-- name: RetryNotificationLater :exec
+UPDATE notifications
+SET
+  status = 'pending',
+  attempts = attempts + 1,
+  deliver_after = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg('delay_seconds')::float8),
+  last_error = sqlc.arg('last_error'),
+  last_attempt_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg('id');
+
+
+-- name: MarkNotificationSuppressed :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE id = $1;
+
+
+-- name: UpdateNotificationChannel :exec
+UPDATE notifications
+SET
+  contact_method = $2,
+  contact = $3,
+  subject = $4,
+  body = $5,
+  html_body = $6
+WHERE id = $1;
+
+-- name: SuppressHeldAlertNotifications :exec
+UPDATE notifications
+SET
+  status = 'suppressed',
+  last_error = $2
+WHERE alert_id = $1 AND status = 'held';
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE notifications
+    ADD COLUMN alert_id UUID,
+    ADD CONSTRAINT fk_notifications_alert
+        FOREIGN KEY (alert_id)
+        REFERENCES alerts(id)
+        ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE notifications DROP COLUMN alert_id;
@@ -0,0 +1,23 @@
+-- +goose Up
+--  status is now one of ENUM('pending','retrying','sent','failed')
+ALTER TABLE notifications
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN last_attempt_at TIMESTAMP,
+    -- only set once the notification actually went out
+    ALTER COLUMN sent_at DROP DEFAULT,
+    ALTER COLUMN sent_at DROP NOT NULL;
+
+UPDATE notifications SET sent_at = NULL WHERE status <> 'sent';
+
+-- +goose Down
+UPDATE notifications SET sent_at = created_at WHERE sent_at IS NULL;
+
+ALTER TABLE notifications
+    ALTER COLUMN sent_at SET NOT NULL,
+    ALTER COLUMN sent_at SET DEFAULT CURRENT_TIMESTAMP,
+    DROP COLUMN last_attempt_at,
+    DROP COLUMN last_error,
+    DROP COLUMN attempts,
+    DROP COLUMN created_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+--  pending notifications are the outbox: written with the listing, then
+--  published and moved to 'enqueued'. The sweeper scans this index.
+CREATE INDEX idx_notifications_pending
+    ON notifications (created_at)
+    WHERE status = 'pending';
+
+-- +goose Down
+DROP INDEX idx_notifications_pending;
@@ -0,0 +1,28 @@
+-- +goose Up
+--  status can now also move on from 'sent' to 'delivered', 'read' or 'bounced'
+--  as provider webhooks report back
+ALTER TABLE notifications
+    ADD COLUMN provider_message_id TEXT,
+    ADD COLUMN delivered_at TIMESTAMP,
+    ADD COLUMN read_at TIMESTAMP;
+
+CREATE INDEX idx_notifications_provider_message_id
+    ON notifications (contact_method, provider_message_id)
+    WHERE provider_message_id IS NOT NULL;
+
+--  alerts whose contact keeps bouncing are switched off
+ALTER TABLE alerts
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN disabled_reason TEXT;
+
+-- +goose Down
+ALTER TABLE alerts
+    DROP COLUMN disabled_reason,
+    DROP COLUMN active;
+
+DROP INDEX idx_notifications_provider_message_id;
+
+ALTER TABLE notifications
+    DROP COLUMN read_at,
+    DROP COLUMN delivered_at,
+    DROP COLUMN provider_message_id;
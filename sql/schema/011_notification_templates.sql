@@ -0,0 +1,11 @@
+-- +goose Up
+--  event is one of ENUM('new_match','price_drop','listing_rented'); html_body
+--  is the rendered email HTML, empty for other channels
+ALTER TABLE notifications
+    ADD COLUMN event TEXT NOT NULL DEFAULT 'new_match',
+    ADD COLUMN html_body TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE notifications
+    DROP COLUMN html_body,
+    DROP COLUMN event;
@@ -0,0 +1,30 @@
+-- +goose Up
+--  frequency is one of ENUM('instant','hourly','daily')
+ALTER TABLE alerts
+    ADD COLUMN frequency TEXT NOT NULL DEFAULT 'instant';
+
+--  matches for hourly and daily alerts are 'held' until the digest scheduler
+--  rolls them into one 'digest' notification, which has no single listing.
+--  Held matches then move to 'digested' and point at their digest.
+ALTER TABLE notifications
+    ALTER COLUMN listing_id DROP NOT NULL,
+    ADD COLUMN digest_id UUID,
+    ADD CONSTRAINT fk_notifications_digest
+        FOREIGN KEY (digest_id)
+        REFERENCES notifications(id)
+        ON DELETE SET NULL;
+
+CREATE INDEX idx_notifications_held
+    ON notifications (created_at)
+    WHERE status = 'held';
+
+-- +goose Down
+DROP INDEX idx_notifications_held;
+
+DELETE FROM notifications WHERE listing_id IS NULL;
+
+ALTER TABLE notifications
+    DROP COLUMN digest_id,
+    ALTER COLUMN listing_id SET NOT NULL;
+
+ALTER TABLE alerts DROP COLUMN frequency;
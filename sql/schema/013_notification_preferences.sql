@@ -0,0 +1,31 @@
+-- +goose Up
+--  one row per user, users without a row get the defaults.
+--  quiet hours are HH:MM in the user's timezone, both empty when off.
+--  channel_priority is the order channels are tried in, e.g. {whatsapp,sms}.
+--  daily_cap is the most notifications sent per day, 0 for no cap.
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY,
+    quiet_hours_start TEXT NOT NULL DEFAULT '',
+    quiet_hours_end TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'Africa/Lagos',
+    channel_priority TEXT[] NOT NULL DEFAULT '{}',
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    daily_cap INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+     CONSTRAINT fk_notification_preferences_user
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+    );
+
+--  notifications deferred by quiet hours or the daily cap go back to
+--  'pending' and the sweeper leaves them alone until deliver_after.
+--  'suppressed' notifications were dropped because the user is muted.
+ALTER TABLE notifications
+    ADD COLUMN deliver_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE notifications DROP COLUMN deliver_after;
+
+DROP TABLE notification_preferences;
@@ -0,0 +1,9 @@
+-- +goose Up
+--  signed link that disables the notification's alert, or all notifications
+--  for digests that cover several alerts. Rendered into the body and sent as
+--  the email List-Unsubscribe header.
+ALTER TABLE notifications
+    ADD COLUMN unsubscribe_url TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE notifications DROP COLUMN unsubscribe_url;
@@ -0,0 +1,8 @@
+-- +goose Up
+--  alerts stop matching listings once they expire. Paused alerts are
+--  inactive with disabled_reason 'paused'.
+ALTER TABLE alerts
+    ADD COLUMN expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE alerts DROP COLUMN expires_at;
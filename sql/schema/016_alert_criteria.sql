@@ -0,0 +1,46 @@
+-- +goose Up
+--  listings can say how many bedrooms and bathrooms they have
+ALTER TABLE listings
+    ADD COLUMN bedrooms INT,
+    ADD COLUMN bathrooms INT;
+
+--  an alert matches listings in any of its locations, within radius_km of
+--  its point, and inside its bedroom and bathroom ranges (0 means no bound).
+--  Listings have to mention every include keyword and none of the exclude
+--  keywords in their title or description.
+ALTER TABLE alerts
+    ADD COLUMN locations TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN radius_km DOUBLE PRECISION,
+    ADD COLUMN min_bedrooms INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_bedrooms INT NOT NULL DEFAULT 0,
+    ADD COLUMN min_bathrooms INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_bathrooms INT NOT NULL DEFAULT 0,
+    ADD COLUMN include_keywords TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN exclude_keywords TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE alerts SET locations = ARRAY[location];
+
+ALTER TABLE alerts DROP COLUMN location;
+
+-- +goose Down
+ALTER TABLE alerts ADD COLUMN location TEXT NOT NULL DEFAULT '';
+
+UPDATE alerts SET location = coalesce(locations[1], '');
+
+ALTER TABLE alerts
+    DROP COLUMN exclude_keywords,
+    DROP COLUMN include_keywords,
+    DROP COLUMN max_bathrooms,
+    DROP COLUMN min_bathrooms,
+    DROP COLUMN max_bedrooms,
+    DROP COLUMN min_bedrooms,
+    DROP COLUMN radius_km,
+    DROP COLUMN longitude,
+    DROP COLUMN latitude,
+    DROP COLUMN locations;
+
+ALTER TABLE listings
+    DROP COLUMN bathrooms,
+    DROP COLUMN bedrooms;
@@ -0,0 +1,22 @@
+-- +goose Up
+--  listings go active -> inactive -> active, or active -> rented.
+--  status_changed_at is when the status last changed and rented_at when
+--  the listing was rented.
+ALTER TABLE listings
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN status_changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN rented_at TIMESTAMP;
+
+UPDATE listings SET updated_at = created_at, status_changed_at = created_at;
+
+UPDATE listings SET rented_at = created_at WHERE status = 'rented';
+
+CREATE INDEX idx_favorites_listing ON favorites (listing_id);
+
+-- +goose Down
+DROP INDEX idx_favorites_listing;
+
+ALTER TABLE listings
+    DROP COLUMN rented_at,
+    DROP COLUMN status_changed_at,
+    DROP COLUMN updated_at;
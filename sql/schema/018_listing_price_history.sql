@@ -0,0 +1,24 @@
+-- +goose Up
+--  every price a listing has had, starting with the one it was listed at
+CREATE TABLE listing_price_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    listing_id UUID NOT NULL,
+    price BIGINT NOT NULL,
+    -- null for the price the listing was created with
+    previous_price BIGINT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_listing_price_history_listing
+        FOREIGN KEY (listing_id)
+        REFERENCES listings(id)
+        ON DELETE CASCADE
+    );
+
+CREATE INDEX idx_listing_price_history_listing
+    ON listing_price_history (listing_id, changed_at);
+
+INSERT INTO listing_price_history (listing_id, price, changed_at)
+SELECT id, price, created_at FROM listings;
+
+-- +goose Down
+DROP TABLE listing_price_history;
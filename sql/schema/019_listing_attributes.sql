@@ -0,0 +1,20 @@
+-- +goose Up
+-- price is the rent for one rent_period; the fees are paid once on top of it
+ALTER TABLE listings
+    ADD COLUMN furnishing TEXT NOT NULL DEFAULT 'unfurnished'
+        CHECK (furnishing IN ('unfurnished', 'semi_furnished', 'furnished')),
+    ADD COLUMN serviced BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN rent_period TEXT NOT NULL DEFAULT 'yearly'
+        CHECK (rent_period IN ('monthly', 'quarterly', 'yearly')),
+    ADD COLUMN agency_fee BIGINT NOT NULL DEFAULT 0 CHECK (agency_fee >= 0),
+    ADD COLUMN legal_fee BIGINT NOT NULL DEFAULT 0 CHECK (legal_fee >= 0),
+    ADD COLUMN caution_fee BIGINT NOT NULL DEFAULT 0 CHECK (caution_fee >= 0);
+
+-- +goose Down
+ALTER TABLE listings
+    DROP COLUMN caution_fee,
+    DROP COLUMN legal_fee,
+    DROP COLUMN agency_fee,
+    DROP COLUMN rent_period,
+    DROP COLUMN serviced,
+    DROP COLUMN furnishing;
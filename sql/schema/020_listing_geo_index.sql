@@ -0,0 +1,8 @@
+-- +goose Up
+-- bounding-box searches use point(longtitude, latitude) <@ box(...), which
+-- this index serves; listings without coordinates index as null
+CREATE INDEX idx_listings_point
+    ON listings USING gist (point(longtitude, latitude));
+
+-- +goose Down
+DROP INDEX idx_listings_point;
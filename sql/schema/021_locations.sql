@@ -0,0 +1,29 @@
+-- +goose Up
+-- Nigeria's state > LGA > area > neighbourhood hierarchy. Rows are seeded from
+-- the dataset embedded in internal/locations on startup; keys holds the
+-- normalised name and aliases free-text locations are resolved against.
+CREATE TABLE locations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    parent_id UUID REFERENCES locations(id) ON DELETE CASCADE,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('state', 'lga', 'area', 'neighbourhood')),
+    depth INT NOT NULL,
+    keys TEXT[] NOT NULL DEFAULT '{}'
+    );
+
+CREATE INDEX idx_locations_parent ON locations (parent_id);
+CREATE INDEX idx_locations_keys ON locations USING gin (keys);
+
+-- location stays as the text the agent typed
+ALTER TABLE listings
+    ADD COLUMN location_id UUID REFERENCES locations(id) ON DELETE SET NULL;
+CREATE INDEX idx_listings_location_id ON listings (location_id);
+
+ALTER TABLE alerts
+    ADD COLUMN location_ids UUID[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE alerts DROP COLUMN location_ids;
+ALTER TABLE listings DROP COLUMN location_id;
+DROP TABLE locations;
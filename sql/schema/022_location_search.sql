@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- the keys in one string, so word_similarity can find typos in any of them
+ALTER TABLE locations
+    ADD COLUMN search_text TEXT NOT NULL DEFAULT '';
+
+UPDATE locations SET search_text = array_to_string(keys, ' ');
+
+CREATE INDEX idx_locations_search_text
+    ON locations USING gin (search_text gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX idx_locations_search_text;
+ALTER TABLE locations DROP COLUMN search_text;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- title matches weigh more than description matches
+ALTER TABLE listings
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_listings_search_vector
+    ON listings USING gin (search_vector);
+
+-- +goose Down
+DROP INDEX idx_listings_search_vector;
+ALTER TABLE listings DROP COLUMN search_vector;
@@ -0,0 +1,12 @@
+-- +goose Up
+--  deleting a listing only sets deleted_at, so the notifications about it
+--  and their delivery history stay. Deleted listings are left out of
+--  searches and can't be opened or changed.
+ALTER TABLE listings ADD COLUMN deleted_at TIMESTAMP;
+
+-- +goose Down
+--  deleting the rows would cascade to their notifications, so deleted listings
+--  are kept as inactive instead
+UPDATE listings SET status = 'inactive' WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE listings DROP COLUMN deleted_at;
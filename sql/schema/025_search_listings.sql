@@ -0,0 +1,75 @@
+-- +goose Up
+--  the listings a search matches, shared by GetListings and CountListings so
+--  a page's items and its total always agree. distance_km is from near_lat,
+--  near_lng and query is the parsed search, both null when not given. A plain
+--  sql function like this is inlined into the calling query, so the indexes on
+--  listings are still used.
+-- +goose StatementBegin
+CREATE FUNCTION search_listings(
+    p_location TEXT,
+    p_min_price BIGINT,
+    p_max_price BIGINT,
+    p_property_type TEXT,
+    p_min_bedrooms INT,
+    p_min_bathrooms INT,
+    p_furnishing TEXT,
+    p_serviced BOOLEAN,
+    p_rent_period TEXT,
+    p_max_move_in_cost BIGINT,
+    p_near_lat FLOAT8,
+    p_near_lng FLOAT8,
+    p_radius_km FLOAT8,
+    p_min_lat FLOAT8,
+    p_min_lng FLOAT8,
+    p_max_lat FLOAT8,
+    p_max_lng FLOAT8,
+    p_location_id UUID,
+    p_search TEXT,
+    p_require_distance BOOLEAN
+) RETURNS TABLE (listing_id UUID, distance_km FLOAT8, rank FLOAT8, query tsquery)
+LANGUAGE sql STABLE AS $$
+SELECT listings.id, d.distance_km, s.rank, s.query
+FROM listings
+CROSS JOIN LATERAL (
+  -- haversine distance from near, null without near or coordinates
+  SELECT (2 * 6371 * asin(least(1, sqrt(
+    power(sin(radians(listings.latitude - p_near_lat) / 2), 2)
+    + cos(radians(p_near_lat)) * cos(radians(listings.latitude)) * power(sin(radians(listings.longtitude - p_near_lng) / 2), 2)
+  ))))::float8 AS distance_km
+) d
+CROSS JOIN LATERAL (
+  SELECT q AS query, ts_rank(listings.search_vector, q)::float8 AS rank
+  FROM websearch_to_tsquery('english', p_search) q
+) s
+WHERE
+  (p_search IS NULL OR listings.search_vector @@ s.query)
+  AND (listings.location = coalesce(p_location, listings.location))
+  AND (listings.price >= coalesce(p_min_price, listings.price))
+  AND (listings.price <= coalesce(p_max_price, listings.price))
+  AND (listings.property_type = coalesce(p_property_type, listings.property_type))
+  AND (p_min_bedrooms IS NULL OR listings.bedrooms >= p_min_bedrooms)
+  AND (p_min_bathrooms IS NULL OR listings.bathrooms >= p_min_bathrooms)
+  AND (listings.furnishing = coalesce(p_furnishing, listings.furnishing))
+  AND (listings.serviced = coalesce(p_serviced, listings.serviced))
+  AND (listings.rent_period = coalesce(p_rent_period, listings.rent_period))
+  AND (p_max_move_in_cost IS NULL
+    OR listings.price + listings.agency_fee + listings.legal_fee + listings.caution_fee <= p_max_move_in_cost)
+  AND (p_radius_km IS NULL OR d.distance_km <= p_radius_km)
+  AND (p_location_id IS NULL OR listings.location_id IN (
+    -- the location and everything in it
+    WITH RECURSIVE sub AS (
+      SELECT locations.id FROM locations WHERE locations.id = p_location_id
+      UNION ALL
+      SELECT l.id FROM locations l JOIN sub ON l.parent_id = sub.id
+    )
+    SELECT sub.id FROM sub
+  ))
+  AND (p_min_lat IS NULL OR point(listings.longtitude, listings.latitude) <@ box(point(p_min_lng, p_min_lat), point(p_max_lng, p_max_lat)))
+  AND (NOT p_require_distance OR d.distance_km IS NOT NULL)
+  AND listings.status = 'active'
+  AND listings.deleted_at IS NULL
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION search_listings;
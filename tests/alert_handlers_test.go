@@ -2,11 +2,18 @@ package tests
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 // TestAlertEndpoints tests creating and retrieving alerts for a user.
@@ -117,3 +124,262 @@ func TestAlertEndpoints(t *testing.T) {
 	}
 	t.Logf("✅ Successfully retrieved %d alert(s)", len(alertsResp))
 }
+
+func jsonRequest(t *testing.T, env *TestEnv, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	reqBody := bytes.NewBuffer(nil)
+	if body != nil {
+		bodyJSON, _ := json.Marshal(body)
+		reqBody = bytes.NewBuffer(bodyJSON)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	return w
+}
+
+// TestAlertCRUD tests reading, pausing, resuming, expiring and deleting an alert.
+func TestAlertCRUD(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	token := registerAndLogin(t, env, map[string]string{
+		"email":        "alertcrud@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Alert",
+		"last_name":    "Crud",
+		"role":         "user",
+		"phone_number": "08000000016",
+	})
+	otherToken := registerAndLogin(t, env, map[string]string{
+		"email":        "alertcrudother@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Other",
+		"last_name":    "User",
+		"role":         "user",
+		"phone_number": "08000000017",
+	})
+
+	w := jsonRequest(t, env, http.MethodPost, "/alerts", token, map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       "Yaba",
+		"property_type":  "apartment",
+		"contact_method": "email",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var alert database.Alert
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil {
+		t.Fatalf("error parsing create alert response: %v", err)
+	}
+	path := "/alerts/" + alert.ID.String()
+
+	// ---------- Richer criteria ----------
+	t.Log("--- Creating alert with richer criteria")
+	w = jsonRequest(t, env, http.MethodPost, "/alerts", token, map[string]any{
+		"min_price":        100000,
+		"max_price":        300000,
+		"locations":        []string{"Yaba", " Surulere ", "yaba"},
+		"latitude":         6.5158,
+		"longitude":        3.3898,
+		"radius_km":        5,
+		"min_bedrooms":     2,
+		"max_bedrooms":     3,
+		"include_keywords": []string{"prepaid meter"},
+		"property_type":    "apartment",
+		"contact_method":   "email",
+	})
+	var rich database.Alert
+	if err := json.Unmarshal(w.Body.Bytes(), &rich); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if len(rich.Locations) != 2 || rich.Locations[1] != "Surulere" || rich.RadiusKm.Float64 != 5 || rich.MaxBedrooms != 3 {
+		t.Fatalf("expected the richer criteria to be saved, got %+v", rich)
+	}
+	invalid := []map[string]any{
+		{"min_price": 1, "max_price": 2, "property_type": "apartment", "contact_method": "email"},
+		{"min_price": 1, "max_price": 2, "location": "Yaba", "min_bedrooms": 3, "max_bedrooms": 2, "contact_method": "email"},
+		{"min_price": 1, "max_price": 2, "radius_km": 5, "contact_method": "email"},
+	}
+	for _, body := range invalid {
+		if w := jsonRequest(t, env, http.MethodPost, "/alerts", token, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d, body: %s", body, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Richer criteria saved and validated")
+
+	// ---------- Get Alert ----------
+	t.Log("--- Getting alert")
+	if w := jsonRequest(t, env, http.MethodGet, path, token, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from GetAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		if w := jsonRequest(t, env, method, path, otherToken, map[string]any{}); w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s on another user's alert, got %d, body: %s", method, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Only the owner can see the alert")
+
+	// ---------- Pause and resume ----------
+	t.Log("--- Pausing alert")
+	w = jsonRequest(t, env, http.MethodPatch, path, token, map[string]any{"active": false, "max_price": 400000})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil {
+		t.Fatalf("error parsing update alert response: %v", err)
+	}
+	if alert.Active || alert.DisabledReason.String != "paused" || alert.MaxPrice != 400000 || alert.MinPrice != 100000 {
+		t.Fatalf("expected a paused alert with max_price 400000, got %+v", alert)
+	}
+	matches, _ := env.DB.GetMatchingAlerts(ctx, database.GetMatchingAlertsParams{Price: 200000, Location: "Yaba", PropertyType: "apartment"})
+	for _, match := range matches {
+		if match.ID == alert.ID {
+			t.Fatal("expected a paused alert not to match listings")
+		}
+	}
+	w = jsonRequest(t, env, http.MethodPatch, path, token, map[string]any{"active": true})
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil || !alert.Active || alert.DisabledReason.Valid {
+		t.Fatalf("expected a resumed alert, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alert paused and resumed")
+
+	// ---------- Expiry ----------
+	t.Log("--- Expiring alert")
+	if w := jsonRequest(t, env, http.MethodPatch, path, token, map[string]any{"expires_at": "2020-01-01T00:00:00Z"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an expiry in the past, got %d, body: %s", w.Code, w.Body.String())
+	}
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	if w := jsonRequest(t, env, http.MethodPatch, path, token, map[string]any{"expires_at": expiresAt}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 setting expires_at, got %d, body: %s", w.Code, w.Body.String())
+	}
+	// move the expiry into the past the way time would
+	_, err := env.DB.UpdateAlert(ctx, database.UpdateAlertParams{
+		ID:            alert.ID,
+		MinPrice:      alert.MinPrice,
+		MaxPrice:      alert.MaxPrice,
+		Locations:     alert.Locations,
+		PropertyType:  alert.PropertyType,
+		ContactMethod: alert.ContactMethod,
+		Frequency:     alert.Frequency,
+		Active:        true,
+		ExpiresAt:     sql.NullTime{Valid: true, Time: time.Now().Add(-time.Hour).UTC()},
+	})
+	if err != nil {
+		t.Fatalf("error expiring alert: %v", err)
+	}
+	matches, _ = env.DB.GetMatchingAlerts(ctx, database.GetMatchingAlertsParams{Price: 200000, Location: "Yaba", PropertyType: "apartment"})
+	for _, match := range matches {
+		if match.ID == alert.ID {
+			t.Fatal("expected an expired alert not to match listings")
+		}
+	}
+	t.Log("✅ Expired alert stops matching")
+
+	// ---------- Delete Alert ----------
+	t.Log("--- Deleting alert")
+	if w := jsonRequest(t, env, http.MethodDelete, path, token, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from DeleteAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := jsonRequest(t, env, http.MethodGet, path, token, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted alert, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alert deleted")
+}
+
+// TestAlertValidation tests the field errors PostAlertsHandler returns and the
+// per-user alert cap.
+func TestAlertValidation(t *testing.T) {
+	env := SetupTestEnv(t)
+	env.App.MaxAlertsPerUser = 2
+
+	// a fresh user without a phone number, so earlier runs don't count toward the cap
+	token := registerAndLogin(t, env, map[string]string{
+		"email":      "alertvalidation-" + uuid.NewString() + "@example.com",
+		"password":   "StrongPass123",
+		"first_name": "Alert",
+		"last_name":  "Validation",
+		"role":       "user",
+	})
+	valid := func() map[string]any {
+		return map[string]any{
+			"min_price":      100000,
+			"max_price":      300000,
+			"location":       "Yaba",
+			"property_type":  "apartment",
+			"contact_method": "email",
+		}
+	}
+
+	// ---------- Field errors ----------
+	t.Log("--- Posting invalid alerts")
+	tests := []struct {
+		name   string
+		change map[string]any
+		field  string
+	}{
+		{"min_price above max_price", map[string]any{"min_price": 400000}, "max_price"},
+		{"negative min_price", map[string]any{"min_price": -1}, "min_price"},
+		{"empty property_type", map[string]any{"property_type": " "}, "property_type"},
+		{"misspelled contact_method", map[string]any{"contact_method": "wathsapp"}, "contact_method"},
+		{"sms without a phone number", map[string]any{"contact_method": "sms"}, "contact_method"},
+		{"whatsapp without a phone number", map[string]any{"contact_method": "whatsapp"}, "contact_method"},
+		{"expiry in the past", map[string]any{"expires_at": "2020-01-01T00:00:00Z"}, "expires_at"},
+	}
+	for _, tc := range tests {
+		body := valid()
+		for key, value := range tc.change {
+			body[key] = value
+		}
+		w := jsonRequest(t, env, http.MethodPost, "/alerts", token, body)
+		var resp struct {
+			Fields map[string]string `json:"fields"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusBadRequest || resp.Fields[tc.field] == "" {
+			t.Fatalf("%s: expected 400 with a %s error, got %d, body: %s", tc.name, tc.field, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Invalid alerts rejected with field errors")
+
+	// ---------- Channels without a sender ----------
+	t.Log("--- Posting an alert for a channel without a sender")
+	phoneToken := registerAndLogin(t, env, map[string]string{
+		"email":        "alertchannels-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Alert",
+		"last_name":    "Channels",
+		"role":         "user",
+		"phone_number": "08000000031",
+	})
+	env.App.Channels = []string{"email"}
+	body := valid()
+	body["contact_method"] = "sms"
+	w := jsonRequest(t, env, http.MethodPost, "/alerts", phoneToken, body)
+	env.App.Channels = notification.Channels
+	var channelResp struct {
+		Fields map[string]string `json:"fields"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &channelResp)
+	if w.Code != http.StatusBadRequest || channelResp.Fields["contact_method"] == "" {
+		t.Fatalf("expected 400 with a contact_method error for sms without a sender, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alerts limited to channels with a sender")
+
+	// ---------- Alert cap ----------
+	t.Log("--- Creating alerts up to the cap")
+	for range 2 {
+		if w := jsonRequest(t, env, http.MethodPost, "/alerts", token, valid()); w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from PostAlertsHandler, got %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := jsonRequest(t, env, http.MethodPost, "/alerts", token, valid()); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 over the alert cap, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alert cap enforced")
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// TestDeadLetterEndpoints feeds the worker pool a poison message and a
+// notification that can never be delivered, then lists and replays them.
+func TestDeadLetterEndpoints(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	workers := &notification.Config{DB: env.DB, Broker: env.Broker}
+	workers.StartWorkerPool(ctx, 1)
+
+	token := registerAndLogin(t, env, map[string]string{
+		"email":        "deadletteruser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Dead",
+		"last_name":    "Letter",
+		"role":         "user",
+		"phone_number": "08000000004",
+	})
+
+	// ---------- Publish messages the workers must reject ----------
+	t.Log("--- Publishing poison messages")
+	if err := env.Broker.Publish(ctx, notification.QueueName, notification.Message{ID: "poison", Body: []byte("not json")}); err != nil {
+		t.Fatalf("error publishing poison message: %v", err)
+	}
+	undeliverable := notification.Notification{ID: uuid.New(), ContactMethod: "pigeon", Contact: "nowhere"}
+	if err := env.App.Publisher.Publish(ctx, undeliverable); err != nil {
+		t.Fatalf("error publishing notification: %v", err)
+	}
+
+	// ---------- List dead letters ----------
+	t.Log("--- Listing dead letters")
+	var deadLetters []notification.DeadLetter
+	deadline := time.Now().Add(5 * time.Second)
+	for len(deadLetters) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, "/admin/dead-letters", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("API-KEY", env.App.APIKEY)
+		req.Header.Set("SUDO-KEY", env.App.SUDOKEY)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetDeadLettersHandler, got %d, body: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &deadLetters); err != nil {
+			t.Fatalf("error parsing dead letters response: %v", err)
+		}
+	}
+	if len(deadLetters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(deadLetters))
+	}
+	for _, deadLetter := range deadLetters {
+		if deadLetter.ID == "poison" && deadLetter.Notification != nil {
+			t.Fatal("expected poison message to have no decoded notification")
+		}
+		if deadLetter.ID == undeliverable.ID.String() && deadLetter.Notification == nil {
+			t.Fatal("expected undeliverable notification to be decoded")
+		}
+	}
+	t.Log("✅ Both messages dead-lettered")
+
+	// ---------- Replay ----------
+	t.Log("--- Replaying dead letter")
+	req := httptest.NewRequest(http.MethodPost, "/admin/dead-letters/"+undeliverable.ID.String()+"/replay", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	req.Header.Set("SUDO-KEY", env.App.SUDOKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from ReplayDeadLetterHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/dead-letters/missing/replay", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	req.Header.Set("SUDO-KEY", env.App.SUDOKEY)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 replaying unknown dead letter, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Dead letter replayed")
+}
+
+// droppingBroker is a MemoryBroker whose first consumers are dropped straight
+// away, like a RabbitMQ consumer losing its connection.
+type droppingBroker struct {
+	*notification.MemoryBroker
+	drops atomic.Int32
+}
+
+func (b *droppingBroker) Consume(ctx context.Context, queue string) (<-chan notification.Message, error) {
+	if b.drops.Add(-1) >= 0 {
+		msgs := make(chan notification.Message)
+		close(msgs)
+		return msgs, nil
+	}
+	return b.MemoryBroker.Consume(ctx, queue)
+}
+
+// TestWorkerConsumesAgainAfterLosingBroker drops the worker's consumer and
+// expects the worker to consume again and handle the message.
+func TestWorkerConsumesAgainAfterLosingBroker(t *testing.T) {
+	broker := &droppingBroker{MemoryBroker: notification.NewMemoryBroker()}
+	defer broker.Close()
+	broker.drops.Store(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := broker.Publish(ctx, notification.QueueName, notification.Message{ID: "poison", Body: []byte("not json")}); err != nil {
+		t.Fatalf("error publishing poison message: %v", err)
+	}
+	workers := &notification.Config{Broker: broker}
+	workers.StartWorkerPool(ctx, 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deadLetters, err := broker.DeadLetters(ctx, notification.QueueName)
+		if err != nil {
+			t.Fatalf("error listing dead letters: %v", err)
+		}
+		if len(deadLetters) == 1 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("expected the worker to consume again and dead-letter the poison message")
+}
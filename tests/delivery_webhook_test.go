@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+func signSHA256(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestDeliveryWebhooks sends a matched notification, reports it delivered and
+// then bounced through the email webhook, and expects the alert to be disabled.
+func TestDeliveryWebhooks(t *testing.T) {
+	env := SetupTestEnv(t)
+	location := fmt.Sprintf("Surulere-%d", time.Now().UnixNano())
+
+	// ---------- Alert and matching listing ----------
+	tenantToken := registerAndLogin(t, env, map[string]string{
+		"email":        "webhookuser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Web",
+		"last_name":    "Hook",
+		"role":         "user",
+		"phone_number": "08000000006",
+	})
+	alertJSON, _ := json.Marshal(map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       location,
+		"property_type":  "apartment",
+		"contact_method": "email",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(alertJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tenantToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "webhookagent@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Web",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"company_name": "webhook_homes",
+		"phone_number": "08000000007",
+	})
+	listingJSON, _ := json.Marshal(map[string]any{
+		"title":         "Room and parlour",
+		"description":   "Newly built",
+		"price":         200000,
+		"location":      location,
+		"property_type": "apartment",
+		"images":        []string{"img1.jpg"},
+	})
+	req = httptest.NewRequest(http.MethodPost, "/listings", bytes.NewBuffer(listingJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// ---------- Pretend the worker sent it ----------
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgs, err := env.Broker.Consume(ctx, notification.QueueName)
+	if err != nil {
+		t.Fatalf("error consuming notifications: %v", err)
+	}
+	var sent notification.Notification
+	for msg := range msgs {
+		env.Broker.Ack(msg)
+		json.Unmarshal(msg.Body, &sent)
+		if sent.Contact == "webhookuser@example.com" {
+			break
+		}
+	}
+	if sent.Contact != "webhookuser@example.com" || !sent.AlertID.Valid {
+		t.Fatal("no notification published for the alert")
+	}
+	messageID := fmt.Sprintf("<%s@rentradar.test>", sent.ID)
+	err = env.DB.MarkNotificationSent(ctx, database.MarkNotificationSentParams{
+		ID:                sent.ID,
+		ProviderMessageID: sql.NullString{String: messageID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("error marking notification sent: %v", err)
+	}
+
+	postEmailEvent := func(event map[string]string, signature string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(event)
+		if signature == "" {
+			signature = signSHA256("test-email-secret", body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/email", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Signature", signature)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// ---------- Bad signature ----------
+	t.Log("--- Rejecting unsigned webhook")
+	w = postEmailEvent(map[string]string{"message_id": messageID, "event": "delivered"}, "deadbeef")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad signature, got %d", w.Code)
+	}
+
+	// ---------- Delivered ----------
+	t.Log("--- Recording delivery")
+	w = postEmailEvent(map[string]string{"message_id": messageID, "event": "delivered"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from EmailWebhookHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	dbNotification, err := env.DB.GetNotification(ctx, sent.ID)
+	if err != nil {
+		t.Fatalf("error getting notification: %v", err)
+	}
+	if dbNotification.Status != "delivered" || !dbNotification.DeliveredAt.Valid {
+		t.Fatalf("expected a delivered notification, got status %q", dbNotification.Status)
+	}
+	t.Log("✅ Delivery recorded")
+
+	// ---------- Bounced ----------
+	t.Log("--- Recording bounce")
+	w = postEmailEvent(map[string]string{"message_id": messageID, "event": "bounced", "reason": "mailbox does not exist"}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from EmailWebhookHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	dbNotification, _ = env.DB.GetNotification(ctx, sent.ID)
+	if dbNotification.Status != "bounced" || dbNotification.LastError.String != "mailbox does not exist" {
+		t.Fatalf("expected a bounced notification, got status %q error %q", dbNotification.Status, dbNotification.LastError.String)
+	}
+	alert, err := env.DB.GetAlert(ctx, sent.AlertID.UUID)
+	if err != nil {
+		t.Fatalf("error getting alert: %v", err)
+	}
+	if alert.Active || !alert.DisabledReason.Valid {
+		t.Fatalf("expected the alert to be disabled after a bounce, got %+v", alert)
+	}
+	t.Log("✅ Bounce disabled the alert")
+
+	// ---------- WhatsApp subscription handshake ----------
+	req = httptest.NewRequest(http.MethodGet, "/webhooks/whatsapp?hub.mode=subscribe&hub.verify_token=test-verify-token&hub.challenge=42", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "42" {
+		t.Fatalf("expected the challenge back, got %d %q", w.Code, w.Body.String())
+	}
+}
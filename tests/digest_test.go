@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// TestHourlyAlertDigest creates an hourly alert, posts a listing that matches
+// it and expects the match to be held until the digest goes out.
+func TestHourlyAlertDigest(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	// a fresh location so alerts from earlier runs don't match
+	location := fmt.Sprintf("Surulere-%d", time.Now().UnixNano())
+
+	// ---------- Tenant creates an hourly alert ----------
+	t.Log("--- Creating hourly alert")
+	tenantToken := registerAndLogin(t, env, map[string]string{
+		"email":        "digestuser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Digest",
+		"last_name":    "User",
+		"role":         "user",
+		"phone_number": "08000000012",
+	})
+	alertJSON, _ := json.Marshal(map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       location,
+		"property_type":  "apartment",
+		"contact_method": "email",
+		"frequency":      "hourly",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(alertJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tenantToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alert created")
+
+	// ---------- Invalid frequency is rejected ----------
+	badJSON, _ := json.Marshal(map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       location,
+		"contact_method": "email",
+		"frequency":      "weekly",
+	})
+	req = httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(badJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tenantToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid frequency, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Invalid frequency rejected")
+
+	// ---------- Agent posts a matching listing ----------
+	t.Log("--- Posting matching listing")
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "digestagent@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Digest",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"company_name": "digest_homes",
+		"phone_number": "08000000013",
+	})
+	listingJSON, _ := json.Marshal(map[string]any{
+		"title":         "Self contain near the stadium",
+		"description":   "Self contain with running water",
+		"price":         150000,
+		"location":      location,
+		"property_type": "apartment",
+		"images":        []string{"img1.jpg"},
+	})
+	req = httptest.NewRequest(http.MethodPost, "/listings", bytes.NewBuffer(listingJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var listingResp struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listingResp); err != nil {
+		t.Fatalf("error parsing create listing response: %v", err)
+	}
+	t.Log("✅ Listing created")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgs, err := env.Broker.Consume(ctx, notification.QueueName)
+	if err != nil {
+		t.Fatalf("error consuming notifications: %v", err)
+	}
+
+	// ---------- Nothing is published for the held match ----------
+	t.Log("--- Checking the match is held")
+	select {
+	case msg := <-msgs:
+		env.Broker.Ack(msg)
+		n := notification.Notification{}
+		if err := json.Unmarshal(msg.Body, &n); err != nil {
+			t.Fatalf("error parsing notification: %v", err)
+		}
+		if n.ListingID.UUID == listingResp.ID {
+			t.Fatalf("expected the match to be held for the digest, got %+v", n)
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+	t.Log("✅ Match held")
+
+	// ---------- The digest rolls it up ----------
+	t.Log("--- Sending hourly digests")
+	config := &notification.Config{DB: env.DB, DBConn: env.DBConn, Broker: env.Broker, ListingBaseURL: env.App.ListingBaseURL}
+	sent, err := config.SendDigests(ctx, notification.FrequencyHourly, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error sending digests: %v", err)
+	}
+	if sent == 0 {
+		t.Fatal("expected at least one digest")
+	}
+	for msg := range msgs {
+		env.Broker.Ack(msg)
+		n := notification.Notification{}
+		if err := json.Unmarshal(msg.Body, &n); err != nil {
+			t.Fatalf("error parsing notification: %v", err)
+		}
+		if n.Contact != "digestuser@example.com" || n.Event != notification.EventDigest {
+			continue
+		}
+		listings, err := env.DB.GetDigestListings(ctx, uuid.NullUUID{UUID: n.ID, Valid: true})
+		if err != nil {
+			t.Fatalf("error getting digest listings: %v", err)
+		}
+		found := false
+		for _, listing := range listings {
+			found = found || listing.ID == listingResp.ID
+		}
+		if !found {
+			t.Fatalf("expected the digest to hold the matching listing, got %+v", listings)
+		}
+		if n.Subject == "" || n.Body == "" || n.HTMLBody == "" {
+			t.Fatalf("expected a digest with content, got %+v", n)
+		}
+		t.Log("✅ Digest published")
+		return
+	}
+	t.Fatal("no digest published for the hourly alert")
+}
+
+// TestPausedAlertDigest holds a match for an hourly alert, pauses the alert
+// and expects the match to be suppressed instead of digested.
+func TestPausedAlertDigest(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	// a fresh location so alerts from earlier runs don't match
+	location := fmt.Sprintf("Ojota-%d", time.Now().UnixNano())
+
+	tenantToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pauseddigest-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Paused",
+		"last_name":    "Digest",
+		"role":         "user",
+		"phone_number": "08000000024",
+	})
+	w := jsonRequest(t, env, http.MethodPost, "/alerts", tenantToken, map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       location,
+		"property_type":  "apartment",
+		"contact_method": "email",
+		"frequency":      "hourly",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var alert struct {
+		ID uuid.UUID `json:"ID"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil {
+		t.Fatalf("error parsing create alert response: %v", err)
+	}
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pauseddigestagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Paused",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000025",
+	})
+	w = jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+		"title":         "Room and parlour",
+		"description":   "Room and parlour close to the market",
+		"price":         150000,
+		"location":      location,
+		"property_type": "apartment",
+		"images":        []string{"img1.jpg"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	t.Log("--- Pausing the alert")
+	w = jsonRequest(t, env, http.MethodPatch, "/alerts/"+alert.ID.String(), tenantToken, map[string]any{"active": false})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	config := &notification.Config{DB: env.DB, DBConn: env.DBConn, Broker: env.Broker, ListingBaseURL: env.App.ListingBaseURL}
+	if _, err := config.SendDigests(context.Background(), notification.FrequencyHourly, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("error sending digests: %v", err)
+	}
+	var status string
+	err := env.DBConn.QueryRow(`SELECT status FROM notifications WHERE alert_id = $1`, alert.ID).Scan(&status)
+	if err != nil {
+		t.Fatalf("error getting the held match: %v", err)
+	}
+	if status != "suppressed" {
+		t.Fatalf("expected the paused alert's match to be suppressed, got %s", status)
+	}
+	t.Log("✅ Paused alert's match suppressed")
+}
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// fakeSMTPServer is a minimal SMTP server that records the messages it accepts.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	messages  chan fakeSMTPMessage
+}
+
+type fakeSMTPMessage struct {
+	from, to string
+	tls      bool
+	data     string
+}
+
+// startFakeSMTPServer listens on a random local port. When tlsConfig is set
+// the server advertises STARTTLS.
+func startFakeSMTPServer(t *testing.T, tlsConfig *tls.Config) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting fake smtp server: %v", err)
+	}
+	s := &fakeSMTPServer{listener: listener, tlsConfig: tlsConfig, messages: make(chan fakeSMTPMessage, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	msg := fakeSMTPMessage{}
+	tp.PrintfLine("220 fake smtp ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			if s.tlsConfig != nil && !msg.tls {
+				tp.PrintfLine("250-fake smtp")
+				tp.PrintfLine("250 STARTTLS")
+			} else {
+				tp.PrintfLine("250 fake smtp")
+			}
+		case cmd == "STARTTLS":
+			tp.PrintfLine("220 ready to start tls")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			tp.PrintfLine("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = strings.Trim(line[len("RCPT TO:"):], "<>")
+			if strings.HasPrefix(msg.to, "unknown@") {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			tp.PrintfLine("250 ok")
+		case cmd == "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.messages <- msg
+			tp.PrintfLine("250 queued")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) nextMessage(t *testing.T) fakeSMTPMessage {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake smtp server didn't receive a message")
+		return fakeSMTPMessage{}
+	}
+}
+
+func TestEmailSenderSendsMultipartMessage(t *testing.T) {
+	server := startFakeSMTPServer(t, nil)
+	sender := notification.NewEmailSender(notification.SMTPModel{
+		Server:  "127.0.0.1",
+		Port:    server.port(),
+		From:    "RentRadar <alerts@rentradar.test>",
+		TLSMode: notification.SMTPTLSNone,
+	})
+
+	n := notification.Notification{
+		ID:             uuid.New(),
+		Contact:        "tenant@example.com",
+		ContactMethod:  "email",
+		Subject:        "New flat in Lekki: ₦1,500,000",
+		Body:           "A new listing matches your alert.\nPrice: ₦1,500,000",
+		UnsubscribeURL: "https://api.rentradar.test/unsubscribe/token",
+	}
+	messageID, err := sender.Send(context.Background(), n)
+	if err != nil {
+		t.Fatalf("error sending email: %v", err)
+	}
+
+	got := server.nextMessage(t)
+	if got.from != "alerts@rentradar.test" || got.to != "tenant@example.com" {
+		t.Fatalf("unexpected envelope from %q to %q", got.from, got.to)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("error parsing sent message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != n.Subject {
+		t.Fatalf("expected subject %q, got %q (err: %v)", n.Subject, subject, err)
+	}
+	if parsed.Header.Get("Message-ID") != messageID {
+		t.Fatalf("expected Message-ID %q, got %q", messageID, parsed.Header.Get("Message-ID"))
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Fatalf("invalid Date header: %v", err)
+	}
+	if parsed.Header.Get("List-Unsubscribe") != "<https://api.rentradar.test/unsubscribe/token>" ||
+		parsed.Header.Get("List-Unsubscribe-Post") != "List-Unsubscribe=One-Click" {
+		t.Fatalf("expected one-click List-Unsubscribe headers, got %q and %q", parsed.Header.Get("List-Unsubscribe"), parsed.Header.Get("List-Unsubscribe-Post"))
+	}
+	if parsed.Header.Get("MIME-Version") != "1.0" {
+		t.Fatalf("expected MIME-Version 1.0, got %q", parsed.Header.Get("MIME-Version"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q (err: %v)", mediaType, err)
+	}
+	parts := map[string]string{}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading message part: %v", err)
+		}
+		// multipart decodes quoted-printable parts for us
+		body, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	if parts["text/plain"] != n.Body {
+		t.Fatalf("expected text part %q, got %q", n.Body, parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "Price: ₦1,500,000") {
+		t.Fatalf("expected html part to contain the price, got %q", parts["text/html"])
+	}
+}
+
+func TestEmailSenderUpgradesWithStartTLS(t *testing.T) {
+	// borrow httptest's self-signed certificate for 127.0.0.1
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	server := startFakeSMTPServer(t, &tls.Config{Certificates: tlsServer.TLS.Certificates})
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsServer.Certificate())
+
+	sender := notification.NewEmailSender(notification.SMTPModel{
+		Server:    "127.0.0.1",
+		Port:      server.port(),
+		From:      "alerts@rentradar.test",
+		TLSConfig: &tls.Config{RootCAs: roots},
+	})
+	n := notification.Notification{ID: uuid.New(), Contact: "tenant@example.com", ContactMethod: "email", Subject: "Hello", Body: "Hi"}
+	if _, err := sender.Send(context.Background(), n); err != nil {
+		t.Fatalf("error sending email: %v", err)
+	}
+	if got := server.nextMessage(t); !got.tls {
+		t.Fatal("expected the message to be sent after STARTTLS")
+	}
+}
+
+func TestEmailSenderRejectedRecipientIsPermanent(t *testing.T) {
+	server := startFakeSMTPServer(t, nil)
+	sender := notification.NewEmailSender(notification.SMTPModel{
+		Server:  "127.0.0.1",
+		Port:    server.port(),
+		From:    "alerts@rentradar.test",
+		TLSMode: notification.SMTPTLSNone,
+	})
+	n := notification.Notification{ID: uuid.New(), Contact: "unknown@example.com", ContactMethod: "email", Subject: "Hello", Body: "Hi"}
+	_, err := sender.Send(context.Background(), n)
+	if err == nil || !notification.IsPermanent(err) {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+}
@@ -94,9 +94,13 @@ func TestFavoritesEndpoints(t *testing.T) {
 		req.Header.Set("API-KEY", env.App.APIKEY)
 		w = httptest.NewRecorder()
 		env.Router.ServeHTTP(w, req)
-		if err := json.Unmarshal(w.Body.Bytes(), &listingResp); err != nil {
+		var page struct {
+			Items []map[string]any `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Items) == 0 {
 			t.Fatalf("error parsing get listing: %v", err)
 		}
+		listingResp = page.Items[0]
 	} else if w.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d, body: %s", w.Code, w.Body.String())
 	} else {
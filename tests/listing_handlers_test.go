@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 func TestListingsEndpoints(t *testing.T) {
@@ -129,21 +134,24 @@ func TestListingsEndpoints(t *testing.T) {
 		t.Fatalf("expected 200 from GetListings, got %d, body: %s", w.Code, w.Body.String())
 	}
 
-	var getResp []map[string]any
+	var getResp struct {
+		Items []map[string]any `json:"items"`
+		Total int64            `json:"total"`
+	}
 	if err := json.Unmarshal(w.Body.Bytes(), &getResp); err != nil {
 		t.Fatalf("error parsing get listings response: %v", err)
 	}
 
-	if len(getResp) == 0 {
-		t.Fatalf("expected at least 1 listing in response")
+	if len(getResp.Items) == 0 || getResp.Total < int64(len(getResp.Items)) {
+		t.Fatalf("expected at least 1 listing in response, got %s", w.Body.String())
 	}
 
-	t.Logf("✅ Successfully retrieved %d listing(s)", len(getResp))
+	t.Logf("✅ Successfully retrieved %d listing(s)", len(getResp.Items))
 
 	// ---------- GET SINGLE LISTING ----------
 	t.Log("--- Getting Single Listing")
 
-	listingID := getResp[0]["id"].(string)
+	listingID := getResp.Items[0]["id"].(string)
 
 	req = httptest.NewRequest(http.MethodGet, "/listings/"+listingID, nil)
 	rctx := chi.NewRouteContext()
@@ -168,3 +176,622 @@ func TestListingsEndpoints(t *testing.T) {
 	}
 	t.Log("✅ Successfully retrieved single listing")
 }
+
+// favoriteEvents returns the events of the notifications the user got about the listing, oldest first.
+func favoriteEvents(t *testing.T, env *TestEnv, userID, listingID uuid.UUID) []string {
+	t.Helper()
+	rows, err := env.DBConn.Query(`SELECT event FROM notifications WHERE user_id = $1 AND listing_id = $2 ORDER BY created_at`, userID, listingID)
+	if err != nil {
+		t.Fatalf("error getting notifications: %v", err)
+	}
+	defer rows.Close()
+	events := []string{}
+	for rows.Next() {
+		var event string
+		if err := rows.Scan(&event); err != nil {
+			t.Fatalf("error scanning notification: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// TestListingLifecycle tests updating a listing, its status transitions, the
+// notifications to users who saved it, and deleting it.
+func TestListingLifecycle(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	agentEmail := "lifecycleagent-" + uuid.NewString() + "@example.com"
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        agentEmail,
+		"password":     "StrongPass123",
+		"first_name":   "Lifecycle",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000018",
+	})
+	userEmail := "lifecycleuser-" + uuid.NewString() + "@example.com"
+	userToken := registerAndLogin(t, env, map[string]string{
+		"email":      userEmail,
+		"password":   "StrongPass123",
+		"first_name": "Lifecycle",
+		"last_name":  "User",
+		"role":       "user",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, userEmail)
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+
+	w := jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+		"title":         "Lifecycle flat",
+		"description":   "Flat for the lifecycle test",
+		"price":         1800000,
+		"location":      "Yaba",
+		"property_type": "apartment",
+		"images":        []string{"https://example.com/flat.jpg"},
+	})
+	var listing struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if _, err := env.DB.CreateFavorite(ctx, database.CreateFavoriteParams{UserID: user.ID, ListingID: listing.ID}); err != nil {
+		t.Fatalf("error saving listing: %v", err)
+	}
+	path := "/listings/" + listing.ID.String()
+
+	// ---------- Only the agent can change it ----------
+	if w := jsonRequest(t, env, http.MethodPatch, path, userToken, map[string]any{"price": 1}); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's PATCH, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := jsonRequest(t, env, http.MethodDelete, path, userToken, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's DELETE, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Other users can't change the listing")
+
+	// ---------- Price change ----------
+	t.Log("--- Dropping the price")
+	w = jsonRequest(t, env, http.MethodPatch, path, agentToken, map[string]any{"price": 1500000})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchListingHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if events := favoriteEvents(t, env, user.ID, listing.ID); len(events) != 1 || events[0] != notification.EventPriceDrop {
+		t.Fatalf("expected a price_drop notification for the saved listing, got %v", events)
+	}
+	t.Log("✅ Price drop notified")
+
+	// ---------- Status transitions ----------
+	t.Log("--- Changing status")
+	for _, step := range []struct {
+		status string
+		code   int
+	}{
+		{"inactive", http.StatusOK},
+		{"rented", http.StatusBadRequest},
+		{"active", http.StatusOK},
+		{"rented", http.StatusOK},
+		{"active", http.StatusBadRequest},
+	} {
+		w := jsonRequest(t, env, http.MethodPatch, path, agentToken, map[string]any{"status": step.status})
+		if w.Code != step.code {
+			t.Fatalf("expected %d changing status to %s, got %d, body: %s", step.code, step.status, w.Code, w.Body.String())
+		}
+	}
+	rented, err := env.DB.GetListing(ctx, listing.ID)
+	if err != nil {
+		t.Fatalf("error getting listing: %v", err)
+	}
+	if rented.Status != "rented" || !rented.RentedAt.Valid {
+		t.Fatalf("expected a rented listing with rented_at set, got status %q rented_at %v", rented.Status, rented.RentedAt)
+	}
+	if events := favoriteEvents(t, env, user.ID, listing.ID); len(events) != 2 || events[1] != notification.EventListingRented {
+		t.Fatalf("expected a listing_rented notification for the saved listing, got %v", events)
+	}
+	t.Log("✅ Status transitions enforced and rental notified")
+
+	// ---------- Delete ----------
+	t.Log("--- Deleting listing")
+	if w := jsonRequest(t, env, http.MethodDelete, path, agentToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from DeleteListingHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	deleted, err := env.DB.GetListing(ctx, listing.ID)
+	if err != nil || !deleted.DeletedAt.Valid {
+		t.Fatalf("expected the listing to be marked deleted, got deleted_at %v (err: %v)", deleted.DeletedAt, err)
+	}
+	if w := jsonRequest(t, env, http.MethodGet, path, "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted listing, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := jsonRequest(t, env, http.MethodPatch, path, agentToken, map[string]any{"title": "Back again"}); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 changing a deleted listing, got %d, body: %s", w.Code, w.Body.String())
+	}
+	// the notifications about it keep their history
+	if events := favoriteEvents(t, env, user.ID, listing.ID); len(events) != 2 {
+		t.Fatalf("expected the saved listing's notifications to be kept, got %v", events)
+	}
+	t.Log("✅ Listing deleted")
+}
+
+// TestListingPriceHistory drops a listing's price into an alert's range and
+// checks the price history and the price_drop alert.
+func TestListingPriceHistory(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pricehistoryagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Price",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000019",
+	})
+	userEmail := "pricehistoryuser-" + uuid.NewString() + "@example.com"
+	registerAndLogin(t, env, map[string]string{
+		"email":      userEmail,
+		"password":   "StrongPass123",
+		"first_name": "Price",
+		"last_name":  "User",
+		"role":       "user",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, userEmail)
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	location := "Gbagada-" + uuid.NewString()
+	alert, err := env.DB.CreateAlert(ctx, database.CreateAlertParams{
+		UserID:        user.ID,
+		MinPrice:      1000000,
+		MaxPrice:      1800000,
+		Locations:     []string{location},
+		PropertyType:  "apartment",
+		ContactMethod: "email",
+		Frequency:     notification.FrequencyInstant,
+	})
+	if err != nil {
+		t.Fatalf("error creating alert: %v", err)
+	}
+
+	w := jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+		"title":         "Price history flat",
+		"description":   "Flat for the price history test",
+		"price":         2000000,
+		"location":      location,
+		"property_type": "apartment",
+		"images":        []string{"https://example.com/flat.jpg"},
+	})
+	var listing struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if events := favoriteEvents(t, env, user.ID, listing.ID); len(events) != 0 {
+		t.Fatalf("expected no notification above the alert's max price, got %v", events)
+	}
+	// the user saved the listing too, but should only hear about the drop once
+	if _, err := env.DB.CreateFavorite(ctx, database.CreateFavoriteParams{UserID: user.ID, ListingID: listing.ID}); err != nil {
+		t.Fatalf("error saving listing: %v", err)
+	}
+	path := "/listings/" + listing.ID.String()
+
+	// ---------- Price drop into the alert's range ----------
+	t.Log("--- Dropping the price")
+	if w := jsonRequest(t, env, http.MethodPatch, path, agentToken, map[string]any{"price": 1700000}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchListingHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var alertID uuid.NullUUID
+	err = env.DBConn.QueryRow(`SELECT alert_id FROM notifications WHERE user_id = $1 AND listing_id = $2 AND event = $3`, user.ID, listing.ID, notification.EventPriceDrop).Scan(&alertID)
+	if err != nil {
+		t.Fatalf("expected one price_drop notification, got err: %v", err)
+	}
+	if alertID.UUID != alert.ID {
+		t.Fatalf("expected the price_drop notification to come from the alert, got %v", alertID)
+	}
+	t.Log("✅ Price drop alerted")
+
+	// ---------- Price history ----------
+	t.Log("--- Getting price history")
+	w = jsonRequest(t, env, http.MethodGet, path+"/price-history", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from GetListingPriceHistoryHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var history []struct {
+		Price         int64 `json:"price"`
+		PreviousPrice struct {
+			Int64 int64 `json:"Int64"`
+			Valid bool  `json:"Valid"`
+		} `json:"previous_price"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("error decoding price history: %v", err)
+	}
+	if len(history) != 2 || history[0].Price != 2000000 || history[0].PreviousPrice.Valid ||
+		history[1].Price != 1700000 || history[1].PreviousPrice.Int64 != 2000000 {
+		t.Fatalf("unexpected price history: %+v", history)
+	}
+	if w := jsonRequest(t, env, http.MethodGet, "/listings/"+uuid.NewString()+"/price-history", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown listing, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Price history recorded")
+}
+
+// TestListingAttributes creates listings with furnishing, rent period and fees
+// and filters by them.
+func TestListingAttributes(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "attributesagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Attributes",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000020",
+	})
+	location := "Ikoyi-" + uuid.NewString()
+	newListing := func(attributes map[string]any) *httptest.ResponseRecorder {
+		body := map[string]any{
+			"title":         "Attributes flat",
+			"description":   "Flat for the attributes test",
+			"price":         3000000,
+			"location":      location,
+			"property_type": "apartment",
+			"images":        []string{"https://example.com/flat.jpg"},
+		}
+		for k, v := range attributes {
+			body[k] = v
+		}
+		return jsonRequest(t, env, http.MethodPost, "/listings", agentToken, body)
+	}
+
+	// ---------- Create ----------
+	t.Log("--- Creating listings")
+	w := newListing(map[string]any{
+		"bedrooms":    3,
+		"bathrooms":   3,
+		"furnishing":  "furnished",
+		"serviced":    true,
+		"agency_fee":  300000,
+		"legal_fee":   300000,
+		"caution_fee": 500000,
+	})
+	var furnished struct {
+		Furnishing      string `json:"furnishing"`
+		RentPeriod      string `json:"rent_period"`
+		TotalMoveInCost int64  `json:"total_move_in_cost"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &furnished); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if furnished.Furnishing != "furnished" || furnished.RentPeriod != "yearly" || furnished.TotalMoveInCost != 4100000 {
+		t.Fatalf("unexpected listing attributes: %+v", furnished)
+	}
+	if w := newListing(map[string]any{"bedrooms": 1, "rent_period": "monthly"}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	for _, invalid := range []map[string]any{
+		{"furnishing": "partly"},
+		{"rent_period": "weekly"},
+		{"caution_fee": -1},
+	} {
+		if w := newListing(invalid); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d, body: %s", invalid, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Listings created")
+
+	// ---------- Filter ----------
+	t.Log("--- Filtering listings")
+	for query, want := range map[string]int{
+		"":                          2,
+		"&min_bedrooms=2":           1,
+		"&furnishing=furnished":     1,
+		"&serviced=false":           1,
+		"&rent_period=monthly":      1,
+		"&max_move_in_cost=3500000": 1,
+	} {
+		w := jsonRequest(t, env, http.MethodGet, "/listings?location="+location+query, "", nil)
+		var page struct {
+			Items []map[string]any `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetListingsHandler for %q, got %d, body: %s", query, w.Code, w.Body.String())
+		}
+		if len(page.Items) != want {
+			t.Fatalf("expected %d listings for %q, got %d", want, query, len(page.Items))
+		}
+	}
+	if w := jsonRequest(t, env, http.MethodGet, "/listings?serviced=maybe", "", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad serviced filter, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Listings filtered")
+}
+
+// TestListingGeoSearch searches listings near a point, within a radius and
+// within a bounding box.
+func TestListingGeoSearch(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "geoagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Geo",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000021",
+	})
+	// the property type keeps other tests' listings out of the results
+	propertyType := "geo-" + uuid.NewString()
+	places := []struct {
+		title    string
+		lat, lng float64
+	}{
+		{"Lekki Phase 1", 6.4474, 3.4723},
+		{"Victoria Island", 6.4281, 3.4219},
+		{"Ikeja GRA", 6.5795, 3.3569},
+	}
+	for _, place := range places {
+		w := jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+			"title":         place.title,
+			"description":   "Flat for the geo search test",
+			"price":         2500000,
+			"location":      "Lagos",
+			"property_type": propertyType,
+			"images":        []string{"https://example.com/flat.jpg"},
+			"latitude":      place.lat,
+			"longtitude":    place.lng,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+	search := func(query string) []string {
+		t.Helper()
+		w := jsonRequest(t, env, http.MethodGet, "/listings?property_type_name="+propertyType+"&"+query, "", nil)
+		var page struct {
+			Items []struct {
+				Title      string `json:"title"`
+				DistanceKm struct {
+					Float64 float64 `json:"Float64"`
+					Valid   bool    `json:"Valid"`
+				} `json:"distance_km"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetListingsHandler for %q, got %d, body: %s", query, w.Code, w.Body.String())
+		}
+		titles := []string{}
+		for _, listing := range page.Items {
+			if !listing.DistanceKm.Valid {
+				t.Fatalf("expected a distance for %q in %q", listing.Title, query)
+			}
+			titles = append(titles, listing.Title)
+		}
+		return titles
+	}
+
+	t.Log("--- Searching near Lekki")
+	if titles := search("near=6.4474,3.4723"); len(titles) != 3 || titles[0] != "Lekki Phase 1" || titles[2] != "Ikeja GRA" {
+		t.Fatalf("expected every listing ordered by distance from Lekki, got %v", titles)
+	}
+	if titles := search("near=6.4474,3.4723&radius_km=10"); len(titles) != 2 || titles[1] != "Victoria Island" {
+		t.Fatalf("expected Lekki and Victoria Island within 10km, got %v", titles)
+	}
+	t.Log("✅ Near and radius search")
+
+	t.Log("--- Searching a bounding box")
+	if titles := search("bbox=3.30,6.50,3.40,6.65"); len(titles) != 1 || titles[0] != "Ikeja GRA" {
+		t.Fatalf("expected only Ikeja GRA in the box, got %v", titles)
+	}
+	t.Log("✅ Bounding box search")
+
+	for _, invalid := range []string{"near=6.4", "near=95,3", "radius_km=5", "near=6.4,3.4&radius_km=-1", "bbox=3.4,6.6,3.3,6.5", "near=6.4,3.4&radius_km=5&bbox=3.3,6.5,3.4,6.6"} {
+		if w := jsonRequest(t, env, http.MethodGet, "/listings?"+invalid, "", nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d, body: %s", invalid, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Invalid searches rejected")
+}
+
+// TestListingSearch searches listing titles and descriptions and checks the
+// results are ranked and highlighted.
+func TestListingSearch(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "searchagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Search",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000024",
+	})
+	// the property type keeps other tests' listings out of the results
+	propertyType := "search-" + uuid.NewString()
+	for _, listing := range []struct{ title, description string }{
+		{"Self contain with borehole", "Newly built self contain in a quiet estate, with a borehole and prepaid meter."},
+		{"Mini flat", "Spacious mini flat <b>close to the express</b>, water from a borehole."},
+		{"Two bedroom flat", "Two bedroom flat with a public water supply."},
+	} {
+		w := jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+			"title":         listing.title,
+			"description":   listing.description,
+			"price":         800000,
+			"location":      "Yaba",
+			"property_type": propertyType,
+			"images":        []string{"https://example.com/flat.jpg"},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+	type result struct {
+		Title   string `json:"title"`
+		Snippet string `json:"snippet"`
+	}
+	search := func(q string) []result {
+		t.Helper()
+		w := jsonRequest(t, env, http.MethodGet, "/listings?property_type_name="+propertyType+"&q="+url.QueryEscape(q), "", nil)
+		var page struct {
+			Items []result `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetListingsHandler for %q, got %d, body: %s", q, w.Code, w.Body.String())
+		}
+		return page.Items
+	}
+
+	t.Log("--- Searching listings")
+	results := search("self contain with borehole")
+	if len(results) != 1 || results[0].Title != "Self contain with borehole" {
+		t.Fatalf("expected only the self contain, got %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>borehole</mark>") {
+		t.Fatalf("expected borehole highlighted in the snippet, got %q", results[0].Snippet)
+	}
+	results = search("borehole")
+	if len(results) != 2 || results[0].Title != "Self contain with borehole" {
+		t.Fatalf("expected the title match ranked first, got %+v", results)
+	}
+	if strings.Contains(results[1].Snippet, "<b>") {
+		t.Fatalf("expected the description's HTML escaped, got %q", results[1].Snippet)
+	}
+	if results := search("borehole -mini"); len(results) != 1 {
+		t.Fatalf("expected the excluded word to drop the mini flat, got %+v", results)
+	}
+	t.Log("✅ Search ranked and highlighted")
+}
+
+// TestListingPagination pages through listings with cursors in each sort order.
+func TestListingPagination(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pageagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Page",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000023",
+	})
+	// the property type keeps other tests' listings out of the results
+	propertyType := "page-" + uuid.NewString()
+	// two share a price so the id has to break the tie
+	prices := []int64{300000, 100000, 500000, 300000, 200000}
+	for i, price := range prices {
+		w := jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+			"title":         fmt.Sprintf("Flat %d", i),
+			"description":   "Flat for the pagination test",
+			"price":         price,
+			"location":      "Surulere",
+			"property_type": propertyType,
+			"images":        []string{"https://example.com/flat.jpg"},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+		}
+	}
+
+	type page struct {
+		Items []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+			Price int64  `json:"price"`
+		} `json:"items"`
+		NextCursor string `json:"next_cursor"`
+		Total      int64  `json:"total"`
+	}
+	// walk follows next_cursor to the last page and returns the prices in
+	// order, checking every page's total against the listings paged through
+	walk := func(sort, filter string) []int64 {
+		t.Helper()
+		seen := map[string]bool{}
+		got := []int64{}
+		totals := []int64{}
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(prices) {
+				t.Fatalf("expected to reach the last page sorting by %s", sort)
+			}
+			path := "/listings?limit=2&property_type_name=" + propertyType + "&sort=" + sort + "&cursor=" + url.QueryEscape(cursor) + filter
+			w := jsonRequest(t, env, http.MethodGet, path, "", nil)
+			resp := page{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("expected 200 from GetListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+			}
+			if len(resp.Items) > 2 {
+				t.Fatalf("expected at most 2 listings a page, got %d", len(resp.Items))
+			}
+			totals = append(totals, resp.Total)
+			for _, item := range resp.Items {
+				if seen[item.ID] {
+					t.Fatalf("listing %s was on two pages sorting by %s", item.Title, sort)
+				}
+				seen[item.ID] = true
+				got = append(got, item.Price)
+			}
+			if resp.NextCursor == "" {
+				for _, total := range totals {
+					if total != int64(len(got)) {
+						t.Fatalf("expected a total of %d listings sorting by %s%s, got %d", len(got), sort, filter, total)
+					}
+				}
+				return got
+			}
+			cursor = resp.NextCursor
+		}
+	}
+
+	t.Log("--- Paging through listings")
+	if got := walk("price_asc", ""); fmt.Sprint(got) != "[100000 200000 300000 300000 500000]" {
+		t.Fatalf("expected every listing cheapest first, got %v", got)
+	}
+	if got := walk("price_desc", ""); fmt.Sprint(got) != "[500000 300000 300000 200000 100000]" {
+		t.Fatalf("expected every listing dearest first, got %v", got)
+	}
+	if got := walk("newest", ""); fmt.Sprint(got) != "[200000 300000 500000 100000 300000]" {
+		t.Fatalf("expected every listing newest first, got %v", got)
+	}
+	t.Log("✅ Paged through every sort")
+
+	t.Log("--- Paging through filtered listings")
+	for filter, want := range map[string]string{
+		"&min_price=200000":                  "[200000 300000 300000 500000]",
+		"&max_price=300000":                  "[100000 200000 300000 300000]",
+		"&min_price=200000&max_price=300000": "[200000 300000 300000]",
+		"&max_move_in_cost=250000":           "[100000 200000]",
+		"&location=Surulere":                 "[100000 200000 300000 300000 500000]",
+		"&location=Yaba":                     "[]",
+		"&q=flat":                            "[100000 200000 300000 300000 500000]",
+	} {
+		if got := walk("price_asc", filter); fmt.Sprint(got) != want {
+			t.Fatalf("expected %s with %s, got %v", want, filter, got)
+		}
+	}
+	t.Log("✅ Totals match the filtered listings")
+
+	t.Log("--- Rejecting bad pages")
+	w := jsonRequest(t, env, http.MethodGet, "/listings?limit=2&property_type_name="+propertyType+"&sort=price_asc", "", nil)
+	first := page{}
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil || first.NextCursor == "" {
+		t.Fatalf("expected a next_cursor, got %d, body: %s", w.Code, w.Body.String())
+	}
+	for _, invalid := range []string{
+		"limit=0",
+		"limit=many",
+		"sort=cheapest",
+		"sort=distance",
+		"sort=relevance",
+		"cursor=not-a-cursor",
+		// a cursor only works with the sort it came from
+		"sort=newest&cursor=" + url.QueryEscape(first.NextCursor),
+	} {
+		if w := jsonRequest(t, env, http.MethodGet, "/listings?"+invalid, "", nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d, body: %s", invalid, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Bad pages rejected")
+}
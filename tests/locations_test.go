@@ -0,0 +1,249 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+func TestNormalizeLocation(t *testing.T) {
+	for in, want := range map[string]string{
+		"Lekki Phase 1":     "lekki phase 1",
+		"  lekki   PHASE 1": "lekki phase 1",
+		"V.I":               "v i",
+		"Ado-Odo/Ota":       "ado odo ota",
+		"":                  "",
+	} {
+		if got := locations.Normalize(in); got != want {
+			t.Fatalf("Normalize(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+// TestLocationDataset checks the embedded dataset has every state and no two
+// places under the same parent share a name.
+func TestLocationDataset(t *testing.T) {
+	states, err := locations.Dataset()
+	if err != nil {
+		t.Fatalf("error loading dataset: %v", err)
+	}
+	if len(states) != 37 {
+		t.Fatalf("expected 36 states and the FCT, got %d", len(states))
+	}
+	var check func(places []locations.Place, depth int)
+	check = func(places []locations.Place, depth int) {
+		if len(places) > 0 && depth >= len(locations.Kinds) {
+			t.Fatalf("%q is nested too deep", places[0].Name)
+		}
+		seen := map[string]bool{}
+		for _, place := range places {
+			key := locations.Normalize(place.Name)
+			if key == "" || seen[key] {
+				t.Fatalf("empty or duplicate location %q", place.Name)
+			}
+			seen[key] = true
+			check(place.Children, depth+1)
+		}
+	}
+	check(states, 0)
+}
+
+// TestLocationHierarchy resolves free-text locations and checks listings and
+// alerts match on the places they're in.
+func TestLocationHierarchy(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	// ---------- Resolving ----------
+	t.Log("--- Resolving locations")
+	for text, want := range map[string]string{
+		"Lekki Phase 1, Lagos": "lagos/eti-osa/lekki/lekki-phase-1",
+		"vi":                   "lagos/eti-osa/victoria-island",
+		"Flat 2, Ikate":        "lagos/eti-osa/lekki/ikate",
+		"Surulere, Oyo":        "oyo/surulere",
+		"Surulere":             "lagos/surulere",
+	} {
+		id, err := locations.Resolve(ctx, env.DB, text)
+		if err != nil || !id.Valid {
+			t.Fatalf("expected %q to resolve, got %v (err: %v)", text, id, err)
+		}
+		location, err := env.DB.GetLocation(ctx, id.UUID)
+		if err != nil || location.Slug != want {
+			t.Fatalf("expected %q to resolve to %s, got %s (err: %v)", text, want, location.Slug, err)
+		}
+	}
+	if id, err := locations.Resolve(ctx, env.DB, "Atlantis"); err != nil || id.Valid {
+		t.Fatalf("expected an unknown location not to resolve, got %v (err: %v)", id, err)
+	}
+	t.Log("✅ Locations resolved")
+
+	// ---------- Browsing ----------
+	w := jsonRequest(t, env, http.MethodGet, "/locations", "", nil)
+	var states []struct {
+		ID   uuid.UUID `json:"id"`
+		Name string    `json:"name"`
+		Kind string    `json:"kind"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from GetLocationsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if len(states) != 37 || states[0].Kind != "state" {
+		t.Fatalf("expected the 37 states, got %d", len(states))
+	}
+	t.Log("✅ States listed")
+
+	// ---------- Listings and alerts ----------
+	t.Log("--- Matching on a parent location")
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "locationagent-" + uuid.NewString() + "@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Location",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"phone_number": "08000000022",
+	})
+	userEmail := "locationuser-" + uuid.NewString() + "@example.com"
+	userToken := registerAndLogin(t, env, map[string]string{
+		"email":      userEmail,
+		"password":   "StrongPass123",
+		"first_name": "Location",
+		"last_name":  "User",
+		"role":       "user",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, userEmail)
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	// the property type keeps other tests' listings and alerts out
+	propertyType := "location-" + uuid.NewString()
+	w = jsonRequest(t, env, http.MethodPost, "/alerts", userToken, map[string]any{
+		"min_price":      100000,
+		"max_price":      5000000,
+		"locations":      []string{"Eti-Osa"},
+		"property_type":  propertyType,
+		"contact_method": "email",
+	})
+	var alert struct {
+		ID          uuid.UUID   `json:"ID"`
+		LocationIDs []uuid.UUID `json:"LocationIDs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if len(alert.LocationIDs) != 1 {
+		t.Fatalf("expected the alert to reference Eti-Osa, got %v", alert.LocationIDs)
+	}
+
+	w = jsonRequest(t, env, http.MethodPost, "/listings", agentToken, map[string]any{
+		"title":         "Ikate flat",
+		"description":   "Flat for the location test",
+		"price":         2500000,
+		"location":      "Ikate, Lekki",
+		"property_type": propertyType,
+		"images":        []string{"https://example.com/flat.jpg"},
+	})
+	var listing struct {
+		ID         uuid.UUID     `json:"id"`
+		LocationID uuid.NullUUID `json:"location_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if !listing.LocationID.Valid {
+		t.Fatal("expected the listing to reference Ikate")
+	}
+	var alertID uuid.NullUUID
+	err = env.DBConn.QueryRow(`SELECT alert_id FROM notifications WHERE user_id = $1 AND listing_id = $2 AND event = $3`, user.ID, listing.ID, notification.EventNewMatch).Scan(&alertID)
+	if err != nil || alertID.UUID != alert.ID {
+		t.Fatalf("expected the Eti-Osa alert to match the Ikate listing, got %v (err: %v)", alertID, err)
+	}
+	t.Log("✅ Alert on Eti-Osa matched a listing in Ikate")
+
+	for query, want := range map[string]int{
+		"location=Lagos":          1,
+		"location=lekki":          1,
+		"location=Ikoyi":          0,
+		"location=Ikate%2C+Lekki": 1,
+	} {
+		w := jsonRequest(t, env, http.MethodGet, "/listings?property_type_name="+propertyType+"&"+query, "", nil)
+		var page struct {
+			Items []map[string]any `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetListingsHandler for %q, got %d, body: %s", query, w.Code, w.Body.String())
+		}
+		if len(page.Items) != want {
+			t.Fatalf("expected %d listings for %q, got %d", want, query, len(page.Items))
+		}
+	}
+	t.Log("✅ Searching a parent location includes its children")
+
+	// ---------- Unknown location ids ----------
+	w = jsonRequest(t, env, http.MethodPost, "/alerts", userToken, map[string]any{
+		"min_price":      100000,
+		"max_price":      5000000,
+		"location_ids":   []uuid.UUID{uuid.New()},
+		"property_type":  propertyType,
+		"contact_method": "email",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown location id, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Unknown location id rejected")
+}
+
+func TestLocationAutocomplete(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	type suggestion struct {
+		Slug  string `json:"slug"`
+		Label string `json:"label"`
+		Path  []struct {
+			Name string `json:"name"`
+		} `json:"path"`
+	}
+	autocomplete := func(query string) []suggestion {
+		t.Helper()
+		w := jsonRequest(t, env, http.MethodGet, "/locations/autocomplete?"+query, "", nil)
+		suggestions := []suggestion{}
+		if err := json.Unmarshal(w.Body.Bytes(), &suggestions); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected 200 from GetLocationsAutocompleteHandler for %q, got %d, body: %s", query, w.Code, w.Body.String())
+		}
+		if len(suggestions) == 0 {
+			t.Fatalf("expected suggestions for %q", query)
+		}
+		return suggestions
+	}
+
+	t.Log("--- Autocompleting locations")
+	top := autocomplete("q=VI")[0]
+	if top.Slug != "lagos/eti-osa/victoria-island" || top.Label != "Victoria Island, Eti-Osa, Lagos" || len(top.Path) != 2 {
+		t.Fatalf("expected Victoria Island for VI, got %+v", top)
+	}
+	if top := autocomplete("q=lekk")[0]; top.Slug != "lagos/eti-osa/lekki" {
+		t.Fatalf("expected Lekki first for a prefix, got %+v", top)
+	}
+	found := false
+	for _, s := range autocomplete("q=lekky+phase+1") {
+		found = found || s.Slug == "lagos/eti-osa/lekki/lekki-phase-1"
+	}
+	if !found {
+		t.Fatal("expected Lekki Phase 1 for a misspelling")
+	}
+	if top := autocomplete("q=lag&kind=state")[0]; top.Slug != "lagos" {
+		t.Fatalf("expected the Lagos state, got %+v", top)
+	}
+	t.Log("✅ Suggestions ranked")
+
+	for _, invalid := range []string{"q=", "q=lekki&kind=city", "q=lekki&limit=100"} {
+		if w := jsonRequest(t, env, http.MethodGet, "/locations/autocomplete?"+invalid, "", nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d, body: %s", invalid, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Invalid queries rejected")
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// TestMatchesCriteria tests the radius and keyword criteria the matcher
+// checks after GetMatchingAlerts.
+func TestMatchesCriteria(t *testing.T) {
+	// Unilag, Akoka
+	unilag := database.Alert{
+		Latitude:  sql.NullFloat64{Valid: true, Float64: 6.5158},
+		Longitude: sql.NullFloat64{Valid: true, Float64: 3.3898},
+		RadiusKm:  sql.NullFloat64{Valid: true, Float64: 5},
+	}
+	// Yaba is about 2km from Unilag, Lekki Phase 1 about 15km
+	yaba := database.Listing{
+		Title:       "2 bedroom flat",
+		Description: "Clean flat with a Prepaid Meter",
+		Latitude:    sql.NullFloat64{Valid: true, Float64: 6.5095},
+		Longtitude:  sql.NullFloat64{Valid: true, Float64: 3.3711},
+	}
+	lekki := yaba
+	lekki.Latitude = sql.NullFloat64{Valid: true, Float64: 6.4478}
+	lekki.Longtitude = sql.NullFloat64{Valid: true, Float64: 3.4723}
+	noCoordinates := yaba
+	noCoordinates.Latitude, noCoordinates.Longtitude = sql.NullFloat64{}, sql.NullFloat64{}
+
+	withKeywords := func(alert database.Alert, include, exclude []string) database.Alert {
+		alert.IncludeKeywords = include
+		alert.ExcludeKeywords = exclude
+		return alert
+	}
+
+	tests := []struct {
+		name    string
+		alert   database.Alert
+		listing database.Listing
+		want    bool
+	}{
+		{"no criteria", database.Alert{}, noCoordinates, true},
+		{"inside radius", unilag, yaba, true},
+		{"outside radius", unilag, lekki, false},
+		{"radius without listing coordinates", unilag, noCoordinates, false},
+		{"include keyword ignores case", withKeywords(database.Alert{}, []string{"prepaid meter"}, nil), yaba, true},
+		{"missing include keyword", withKeywords(database.Alert{}, []string{"prepaid meter", "parking"}, nil), yaba, false},
+		{"exclude keyword", withKeywords(database.Alert{}, nil, []string{"prepaid"}), yaba, false},
+		{"radius and keywords", withKeywords(unilag, []string{"flat"}, []string{"shared"}), yaba, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := notification.MatchesCriteria(tc.alert, tc.listing); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	if distance := notification.DistanceKm(6.5158, 3.3898, 6.4478, 3.4723); math.Abs(distance-11.8) > 0.5 {
+		t.Fatalf("expected Unilag to Lekki Phase 1 to be about 11.8km, got %.2fkm", distance)
+	}
+}
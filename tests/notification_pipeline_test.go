@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// TestListingAlertNotificationPipeline creates an alert, posts a listing that
+// matches it and expects the matching notification on the broker.
+func TestListingAlertNotificationPipeline(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	// a fresh location so alerts from earlier runs don't match
+	location := fmt.Sprintf("Yaba-%d", time.Now().UnixNano())
+
+	// ---------- Tenant creates an alert ----------
+	t.Log("--- Creating tenant alert")
+	tenantToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pipelineuser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Pipe",
+		"last_name":    "Line",
+		"role":         "user",
+		"phone_number": "08000000002",
+	})
+	alertJSON, _ := json.Marshal(map[string]any{
+		"min_price":      100000,
+		"max_price":      300000,
+		"location":       location,
+		"property_type":  "apartment",
+		"contact_method": "email",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBuffer(alertJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tenantToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostAlertHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Alert created")
+
+	// ---------- Agent posts a matching listing ----------
+	t.Log("--- Posting matching listing")
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "pipelineagent@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Pipe",
+		"last_name":    "Agent",
+		"role":         "agent",
+		"company_name": "pipeline_homes",
+		"phone_number": "08000000003",
+	})
+	listingJSON, _ := json.Marshal(map[string]any{
+		"title":         "Clean mini flat",
+		"description":   "Mini flat close to the bus stop",
+		"price":         200000,
+		"location":      location,
+		"property_type": "apartment",
+		"images":        []string{"img1.jpg"},
+	})
+	req = httptest.NewRequest(http.MethodPost, "/listings", bytes.NewBuffer(listingJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var listingResp struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listingResp); err != nil {
+		t.Fatalf("error parsing create listing response: %v", err)
+	}
+	t.Log("✅ Listing created")
+
+	// ---------- Expect the notification on the broker ----------
+	t.Log("--- Waiting for notification")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgs, err := env.Broker.Consume(ctx, notification.QueueName)
+	if err != nil {
+		t.Fatalf("error consuming notifications: %v", err)
+	}
+	for msg := range msgs {
+		env.Broker.Ack(msg)
+		n := notification.Notification{}
+		if err := json.Unmarshal(msg.Body, &n); err != nil {
+			t.Fatalf("error parsing notification: %v", err)
+		}
+		if n.ListingID.UUID.String() != listingResp.ID {
+			continue
+		}
+		if n.Contact != "pipelineuser@example.com" || n.ContactMethod != "email" {
+			t.Fatalf("unexpected notification contact %q via %q", n.Contact, n.ContactMethod)
+		}
+		if n.Status != "pending" || n.Subject == "" || n.Body == "" {
+			t.Fatalf("expected a pending notification with content, got %+v", n)
+		}
+		t.Log("✅ Notification published for matching alert")
+		return
+	}
+	t.Fatal("no notification published for the matching alert")
+}
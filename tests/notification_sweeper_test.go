@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// TestSweeperRepublishesPendingNotifications writes a pending notification the
+// way the API does when the broker is down and expects the sweeper to publish it.
+func TestSweeperRepublishesPendingNotifications(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	registerAndLogin(t, env, map[string]string{
+		"email":        "sweeperagent@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Sweep",
+		"last_name":    "Er",
+		"role":         "agent",
+		"company_name": "sweeper_homes",
+		"phone_number": "08000000005",
+	})
+	agent, err := env.DB.GetUserWithEmail(ctx, "sweeperagent@example.com")
+	if err != nil {
+		t.Fatalf("error getting agent: %v", err)
+	}
+	listing, err := env.DB.CreateListing(ctx, database.CreateListingParams{
+		AgentID:      agent.ID,
+		Title:        "Sweeper listing",
+		Description:  "Listing for the sweeper test",
+		Price:        150000,
+		Location:     "Surulere",
+		PropertyType: "apartment",
+		Images:       json.RawMessage(`["img1.jpg"]`),
+		Status:       "active",
+	})
+	if err != nil {
+		t.Fatalf("error creating listing: %v", err)
+	}
+
+	// ---------- Notification left pending in the outbox ----------
+	t.Log("--- Writing pending notification")
+	pending, err := env.DB.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:        agent.ID,
+		ListingID:     uuid.NullUUID{UUID: listing.ID, Valid: true},
+		Contact:       agent.Email,
+		ContactMethod: "email",
+		Status:        "pending",
+		Subject:       "Sweeper subject",
+		Body:          "Sweeper body",
+	})
+	if err != nil {
+		t.Fatalf("error creating notification: %v", err)
+	}
+
+	// ---------- Sweeper publishes it ----------
+	t.Log("--- Running sweeper")
+	sweeper := &notification.Config{DB: env.DB, DBConn: env.DBConn, Broker: env.Broker}
+	sweeper.StartSweeper(ctx, 50*time.Millisecond, 0)
+
+	msgs, err := env.Broker.Consume(ctx, notification.QueueName)
+	if err != nil {
+		t.Fatalf("error consuming notifications: %v", err)
+	}
+	found := false
+	for msg := range msgs {
+		env.Broker.Ack(msg)
+		if msg.ID == pending.ID.String() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatal("sweeper never published the pending notification")
+	}
+
+	// the sweep commits right after publishing
+	var swept database.Notification
+	for ctx.Err() == nil {
+		swept, err = env.DB.GetNotification(ctx, pending.ID)
+		if err != nil {
+			t.Fatalf("error getting notification: %v", err)
+		}
+		if swept.Status == "enqueued" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if swept.Status != "enqueued" {
+		t.Fatalf("expected status enqueued after sweep, got %q", swept.Status)
+	}
+	t.Log("✅ Pending notification re-enqueued")
+}
+
+// failingSender fails every send with a transient error and counts the sends.
+type failingSender struct {
+	sends atomic.Int32
+}
+
+func (s *failingSender) Send(ctx context.Context, n notification.Notification) (string, error) {
+	s.sends.Add(1)
+	return "", errors.New("provider unavailable")
+}
+
+// TestWorkerRetriesTransientFailuresLater expects a notification whose send
+// fails transiently to be tried once and put back in the outbox with a delay,
+// rather than retried in the worker.
+func TestWorkerRetriesTransientFailuresLater(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	email := "retryuser-" + uuid.NewString() + "@example.com"
+	registerAndLogin(t, env, map[string]string{
+		"email":      email,
+		"password":   "StrongPass123",
+		"first_name": "Retry",
+		"last_name":  "User",
+		"role":       "user",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	failing, err := env.DB.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:        user.ID,
+		Contact:       user.Email,
+		ContactMethod: "email",
+		Status:        "enqueued",
+		Subject:       "Retry subject",
+		Body:          "Retry body",
+	})
+	if err != nil {
+		t.Fatalf("error creating notification: %v", err)
+	}
+
+	// ---------- Worker fails to send it ----------
+	t.Log("--- Sending through a failing provider")
+	broker := notification.NewMemoryBroker()
+	defer broker.Close()
+	sender := &failingSender{}
+	worker := &notification.Config{DB: env.DB, DBConn: env.DBConn, Broker: broker, Senders: map[string]notification.Sender{"email": sender}}
+	worker.StartWorkerPool(ctx, 1)
+	if err := notification.NewPublisher(broker).Publish(ctx, notification.DbNotificationToModelsNotification(failing)); err != nil {
+		t.Fatalf("error publishing notification: %v", err)
+	}
+
+	var retried database.Notification
+	for ctx.Err() == nil {
+		retried, err = env.DB.GetNotification(ctx, failing.ID)
+		if err != nil {
+			t.Fatalf("error getting notification: %v", err)
+		}
+		if retried.Status == "pending" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if retried.Status != "pending" || retried.Attempts != 1 || !retried.DeliverAfter.Valid {
+		t.Fatalf("expected the notification back in the outbox after 1 attempt, got %q after %d", retried.Status, retried.Attempts)
+	}
+	if sends := sender.sends.Load(); sends != 1 {
+		t.Fatalf("expected 1 send before backing off, got %d", sends)
+	}
+	// the broker doesn't redeliver it, the sweeper publishes it once it is due
+	time.Sleep(200 * time.Millisecond)
+	if sends := sender.sends.Load(); sends != 1 {
+		t.Fatalf("expected the broker not to redeliver the notification, got %d sends", sends)
+	}
+	t.Log("✅ Failed notification waits in the outbox")
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	lagos := notification.Lagos
+	cases := []struct {
+		name       string
+		start, end string
+		now        time.Time
+		quiet      bool
+		until      time.Time
+	}{
+		{"no quiet hours", "", "", time.Date(2025, 3, 1, 23, 0, 0, 0, lagos), false, time.Time{}},
+		{"inside same-day window", "13:00", "15:00", time.Date(2025, 3, 1, 14, 0, 0, 0, lagos), true, time.Date(2025, 3, 1, 15, 0, 0, 0, lagos)},
+		{"outside same-day window", "13:00", "15:00", time.Date(2025, 3, 1, 15, 0, 0, 0, lagos), false, time.Time{}},
+		{"late evening across midnight", "22:00", "07:00", time.Date(2025, 3, 1, 23, 30, 0, 0, lagos), true, time.Date(2025, 3, 2, 7, 0, 0, 0, lagos)},
+		{"early morning across midnight", "22:00", "07:00", time.Date(2025, 3, 2, 6, 59, 0, 0, lagos), true, time.Date(2025, 3, 2, 7, 0, 0, 0, lagos)},
+		{"daytime across midnight", "22:00", "07:00", time.Date(2025, 3, 2, 12, 0, 0, 0, lagos), false, time.Time{}},
+		// 22:30 UTC is 23:30 in Lagos
+		{"utc clock in lagos quiet hours", "22:00", "07:00", time.Date(2025, 3, 1, 22, 30, 0, 0, time.UTC), true, time.Date(2025, 3, 2, 7, 0, 0, 0, lagos)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prefs := notification.DefaultPreferences(uuid.New())
+			prefs.QuietHoursStart, prefs.QuietHoursEnd = c.start, c.end
+			until, quiet, err := notification.QuietHoursEnd(prefs, c.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if quiet != c.quiet || !until.Equal(c.until) {
+				t.Fatalf("expected quiet=%v until %v, got quiet=%v until %v", c.quiet, c.until, quiet, until)
+			}
+		})
+	}
+}
+
+// fakeSender records what it sends, or fails every send with err.
+type fakeSender struct {
+	err  error
+	sent []notification.Notification
+}
+
+func (s *fakeSender) Send(ctx context.Context, n notification.Notification) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.sent = append(s.sent, n)
+	return "fake-" + n.ID.String(), nil
+}
+
+func putPreferences(t *testing.T, env *TestEnv, token string, prefs map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	prefsJSON, _ := json.Marshal(prefs)
+	req := httptest.NewRequest(http.MethodPut, "/user/preferences", bytes.NewBuffer(prefsJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	return w
+}
+
+// TestNotificationPreferences saves preferences through the API and checks
+// SendNotification falls back, mutes and defers by them.
+func TestNotificationPreferences(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	token := registerAndLogin(t, env, map[string]string{
+		"email":        "prefsuser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Prefs",
+		"last_name":    "User",
+		"role":         "user",
+		"phone_number": "08000000014",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, "prefsuser@example.com")
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+
+	// ---------- Defaults ----------
+	t.Log("--- Reading default preferences")
+	req := httptest.NewRequest(http.MethodGet, "/user/preferences", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from GetPreferencesHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Preferences read")
+
+	// ---------- Invalid preferences are rejected ----------
+	for _, invalid := range []map[string]any{
+		{"quiet_hours_start": "22:00"},
+		{"quiet_hours_start": "25:00", "quiet_hours_end": "07:00"},
+		{"timezone": "Mars/Olympus"},
+		{"channel_priority": []string{"whatsapp", "pigeon"}},
+		{"channel_priority": []string{"sms", "sms"}},
+		{"daily_cap": -1},
+	} {
+		if w := putPreferences(t, env, token, invalid); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d, body: %s", invalid, w.Code, w.Body.String())
+		}
+	}
+	t.Log("✅ Invalid preferences rejected")
+
+	// ---------- Channel fallback ----------
+	t.Log("--- Falling back from whatsapp to sms")
+	w = putPreferences(t, env, token, map[string]any{
+		"quiet_hours_start": "",
+		"quiet_hours_end":   "",
+		"channel_priority":  []string{"whatsapp", "sms"},
+		"muted":             false,
+		"daily_cap":         0,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PutPreferencesHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	listing, err := env.DB.CreateListing(ctx, database.CreateListingParams{
+		AgentID:      user.ID,
+		Title:        "Preferences flat",
+		Description:  "Flat for the preferences test",
+		Price:        250000,
+		Location:     "Ikeja",
+		PropertyType: "apartment",
+		Images:       json.RawMessage(`["img1.jpg"]`),
+		Status:       "active",
+	})
+	if err != nil {
+		t.Fatalf("error creating listing: %v", err)
+	}
+	dbNotification, err := env.DB.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:        user.ID,
+		ListingID:     uuid.NullUUID{UUID: listing.ID, Valid: true},
+		Contact:       user.PhoneNumber.String,
+		ContactMethod: "whatsapp",
+		Status:        "pending",
+		Subject:       "Preferences subject",
+		Body:          "Preferences body",
+		Event:         notification.EventNewMatch,
+	})
+	if err != nil {
+		t.Fatalf("error creating notification: %v", err)
+	}
+	sms := &fakeSender{}
+	config := &notification.Config{
+		DB:             env.DB,
+		ListingBaseURL: env.App.ListingBaseURL,
+		Senders: map[string]notification.Sender{
+			"whatsapp": &fakeSender{err: notification.Permanent(errors.New("not on whatsapp"))},
+			"sms":      sms,
+		},
+	}
+	n := notification.DbNotificationToModelsNotification(dbNotification)
+	if _, err := config.SendNotification(ctx, n); err != nil {
+		t.Fatalf("expected the sms fallback to send, got %v", err)
+	}
+	if len(sms.sent) != 1 || sms.sent[0].ContactMethod != "sms" || sms.sent[0].Body == "Preferences body" {
+		t.Fatalf("expected one sms rendered for sms, got %+v", sms.sent)
+	}
+	moved, err := env.DB.GetNotification(ctx, n.ID)
+	if err != nil {
+		t.Fatalf("error getting notification: %v", err)
+	}
+	if moved.ContactMethod != "sms" {
+		t.Fatalf("expected the notification to move to sms, got %q", moved.ContactMethod)
+	}
+	t.Log("✅ Fell back to sms")
+
+	// ---------- Mute ----------
+	if w := putPreferences(t, env, token, map[string]any{"muted": true}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PutPreferencesHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if _, err := config.SendNotification(ctx, n); !errors.Is(err, notification.ErrMuted) {
+		t.Fatalf("expected ErrMuted, got %v", err)
+	}
+	t.Log("✅ Muted user skipped")
+
+	// ---------- Quiet hours ----------
+	now := time.Now().In(notification.Lagos)
+	w = putPreferences(t, env, token, map[string]any{
+		"muted":             false,
+		"quiet_hours_start": now.Add(-time.Hour).Format("15:04"),
+		"quiet_hours_end":   now.Add(time.Hour).Format("15:04"),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PutPreferencesHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var deferred *notification.DeferredError
+	if _, err := config.SendNotification(ctx, n); !errors.As(err, &deferred) {
+		t.Fatalf("expected a DeferredError during quiet hours, got %v", err)
+	}
+	if !deferred.Until.After(now) {
+		t.Fatalf("expected the notification deferred to after now, got %v", deferred.Until)
+	}
+	t.Log("✅ Deferred during quiet hours")
+
+	// ---------- Daily cap ----------
+	w = putPreferences(t, env, token, map[string]any{
+		"quiet_hours_start": "",
+		"quiet_hours_end":   "",
+		"daily_cap":         1,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PutPreferencesHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	err = env.DB.MarkNotificationSent(ctx, database.MarkNotificationSentParams{ID: n.ID})
+	if err != nil {
+		t.Fatalf("error marking notification sent: %v", err)
+	}
+	if _, err := config.SendNotification(ctx, n); !errors.As(err, &deferred) {
+		t.Fatalf("expected a DeferredError once the daily cap is reached, got %v", err)
+	}
+	t.Log("✅ Deferred by the daily cap")
+}
@@ -1,9 +1,16 @@
 package tests
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -13,14 +20,23 @@ import (
 
 	"github.com/muhammadolammi/rentradar/internal/database"
 	"github.com/muhammadolammi/rentradar/internal/handlers"
+	"github.com/muhammadolammi/rentradar/internal/locations"
+	"github.com/muhammadolammi/rentradar/internal/notification"
 )
 
 type TestEnv struct {
 	App    *handlers.Config
 	DB     *database.Queries
+	DBConn *sql.DB
+	Broker *notification.MemoryBroker
 	Router *chi.Mux
 }
 
+var (
+	seedLocations    sync.Once
+	seedLocationsErr error
+)
+
 func SetupTestEnv(t *testing.T) *TestEnv {
 	t.Helper()
 
@@ -54,11 +70,31 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 
 	queries := database.New(db)
 
+	// 🔹 Seed the location hierarchy once per test run
+	seedLocations.Do(func() { seedLocationsErr = locations.Seed(context.Background(), queries) })
+	if seedLocationsErr != nil {
+		t.Fatalf("cannot seed locations: %v", seedLocationsErr)
+	}
+
+	// 🔹 Notifications go through an in-process broker so no RabbitMQ is needed
+	broker := notification.NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+
 	app := &handlers.Config{
-		DB:      queries,
-		JWTKEY:  jwt_key,
-		APIKEY:  api_key,
-		SUDOKEY: sudo_key,
+		DB:        queries,
+		DBConn:    db,
+		Publisher: notification.NewPublisher(broker),
+		JWTKEY:    jwt_key,
+		APIKEY:    api_key,
+		SUDOKEY:   sudo_key,
+
+		ListingBaseURL:      "https://rentradar.test",
+		Channels:            notification.Channels,
+		Unsubscriber:        notification.NewUnsubscriber("https://api.rentradar.test", "test-unsubscribe-secret"),
+		EmailWebhookSecret:  "test-email-secret",
+		SMSWebhookSecret:    "test-sms-secret",
+		WhatsAppAppSecret:   "test-whatsapp-secret",
+		WhatsAppVerifyToken: "test-verify-token",
 	}
 
 	// 🔹 Setup Chi router for tests
@@ -67,29 +103,98 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 	// 🔹 Use same middlewares as in your production server
 	corsOptions := cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
 	}
 	router.Use(cors.Handler(corsOptions))
 
-	router.Use(app.VerifyApiKey())
-
-	router.Post("/register", app.RegisterHandler)
-	router.Post("/login", app.LoginHandler)
-	router.Post("/refresh", app.RefreshTokens)
-
-	router.Post("/listings", app.AuthMiddleware(false, []byte(jwt_key), app.PostListingsHandler))
-	router.Get("/listings/{ID}", app.GetListingHandler)
-	router.Get("/listings", app.GetListingsHandler)
-	router.Post("/alerts", app.AuthMiddleware(false, []byte(jwt_key), app.PostAlertsHandler))
-	router.Get("/alerts", app.AuthMiddleware(false, []byte(jwt_key), app.GetAlertsHandler))
-
-	router.Post("/favorites", app.AuthMiddleware(false, []byte(jwt_key), app.PostFavoritesHandler))
-	router.Get("/favorites", app.AuthMiddleware(false, []byte(jwt_key), app.GetFavoritesHandler))
+	router.Post("/webhooks/email", app.EmailWebhookHandler)
+	router.Post("/webhooks/sms", app.SMSWebhookHandler)
+	router.Get("/webhooks/whatsapp", app.WhatsAppWebhookVerifyHandler)
+	router.Post("/webhooks/whatsapp", app.WhatsAppWebhookHandler)
+	router.Get("/unsubscribe/{token}", app.GetUnsubscribeHandler)
+	router.Post("/unsubscribe/{token}", app.PostUnsubscribeHandler)
+
+	router.Group(func(router chi.Router) {
+		router.Use(app.VerifyApiKey())
+
+		router.Post("/register", app.RegisterHandler)
+		router.Post("/login", app.LoginHandler)
+		router.Post("/refresh", app.RefreshTokens)
+
+		router.Get("/user/preferences", app.AuthMiddleware(false, []byte(jwt_key), app.GetPreferencesHandler))
+		router.Put("/user/preferences", app.AuthMiddleware(false, []byte(jwt_key), app.PutPreferencesHandler))
+
+		router.Post("/listings", app.AuthMiddleware(false, []byte(jwt_key), app.PostListingsHandler))
+		router.Get("/listings/{ID}", app.GetListingHandler)
+		router.Get("/locations", app.GetLocationsHandler)
+		router.Get("/locations/autocomplete", app.GetLocationsAutocompleteHandler)
+		router.Get("/listings/{ID}/price-history", app.GetListingPriceHistoryHandler)
+		router.Patch("/listings/{ID}", app.AuthMiddleware(false, []byte(jwt_key), app.PatchListingHandler))
+		router.Delete("/listings/{ID}", app.AuthMiddleware(false, []byte(jwt_key), app.DeleteListingHandler))
+		router.Get("/listings", app.GetListingsHandler)
+		router.Post("/alerts", app.AuthMiddleware(false, []byte(jwt_key), app.PostAlertsHandler))
+		router.Get("/alerts", app.AuthMiddleware(false, []byte(jwt_key), app.GetAlertsHandler))
+		router.Get("/alerts/{ID}", app.AuthMiddleware(false, []byte(jwt_key), app.GetAlertHandler))
+		router.Patch("/alerts/{ID}", app.AuthMiddleware(false, []byte(jwt_key), app.PatchAlertHandler))
+		router.Delete("/alerts/{ID}", app.AuthMiddleware(false, []byte(jwt_key), app.DeleteAlertHandler))
+
+		router.Post("/favorites", app.AuthMiddleware(false, []byte(jwt_key), app.PostFavoritesHandler))
+		router.Get("/favorites", app.AuthMiddleware(false, []byte(jwt_key), app.GetFavoritesHandler))
+
+		router.Get("/admin/dead-letters", app.AuthMiddleware(true, []byte(jwt_key), app.GetDeadLettersHandler))
+		router.Post("/admin/dead-letters/{ID}/replay", app.AuthMiddleware(true, []byte(jwt_key), app.ReplayDeadLetterHandler))
+		router.Get("/admin/templates/{event}/{channel}/preview", app.AuthMiddleware(true, []byte(jwt_key), app.PreviewTemplateHandler))
+	})
 
 	return &TestEnv{
 		App:    app,
 		DB:     queries,
+		DBConn: db,
+		Broker: broker,
 		Router: router,
 	}
 }
+
+// registerAndLogin registers the user (tolerating an existing account) and returns an access token.
+func registerAndLogin(t *testing.T, env *TestEnv, registerBody map[string]string) string {
+	t.Helper()
+
+	registerJSON, _ := json.Marshal(registerBody)
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(registerJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("API-KEY", env.App.APIKEY)
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code == http.StatusBadRequest && strings.Contains(w.Body.String(), "User already exist") {
+		t.Log("User already exists — continuing test.")
+	} else if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from register, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	loginJSON, _ := json.Marshal(map[string]string{
+		"email":    registerBody["email"],
+		"password": registerBody["password"],
+	})
+	req = httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(loginJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("API-KEY", env.App.APIKEY)
+
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login failed: expected 200, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var loginResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &loginResp); err != nil {
+		t.Fatalf("Error parsing login response: %v", err)
+	}
+	if loginResp.AccessToken == "" {
+		t.Fatal("access_token missing in login response")
+	}
+	return loginResp.AccessToken
+}
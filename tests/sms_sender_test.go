@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+type fakeSMSRequest struct {
+	To     string `json:"to"`
+	From   string `json:"from"`
+	SMS    string `json:"sms"`
+	APIKey string `json:"api_key"`
+}
+
+// fakeSMSProvider mimics a Termii style JSON API and records every message.
+type fakeSMSProvider struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []fakeSMSRequest
+}
+
+func startFakeSMSProvider(t *testing.T) *fakeSMSProvider {
+	t.Helper()
+	p := &fakeSMSProvider{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := fakeSMSRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"message":"bad json"}`, http.StatusBadRequest)
+			return
+		}
+		if req.APIKey != "test-sms-key" {
+			http.Error(w, `{"message":"invalid api key"}`, http.StatusUnauthorized)
+			return
+		}
+		p.mu.Lock()
+		p.requests = append(p.requests, req)
+		p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"message_id": "sms-" + req.To, "message": "Successfully Sent"})
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestSMSSenderSendsNormalizedNumber(t *testing.T) {
+	provider := startFakeSMSProvider(t)
+	sender := notification.NewSMSSender(notification.NewHTTPSMSProvider(provider.URL, "test-sms-key", "RentRadar"))
+
+	n := notification.Notification{
+		ID:             uuid.New(),
+		Contact:        "0803 123 4567",
+		ContactMethod:  "sms",
+		Subject:        "New flat in Lekki",
+		Body:           strings.Repeat("Spacious 3 bedroom flat with parking. ", 20) + "Price: ₦1,500,000",
+		UnsubscribeURL: "https://api.rentradar.test/unsubscribe/token",
+	}
+	messageID, err := sender.Send(context.Background(), n)
+	if err != nil {
+		t.Fatalf("error sending sms: %v", err)
+	}
+	if messageID != "sms-+2348031234567" {
+		t.Fatalf("unexpected message id %q", messageID)
+	}
+	if len(provider.requests) != 1 {
+		t.Fatalf("expected 1 sms, got %d", len(provider.requests))
+	}
+	sent := provider.requests[0]
+	if sent.To != "+2348031234567" || sent.From != "RentRadar" {
+		t.Fatalf("unexpected sms to %q from %q", sent.To, sent.From)
+	}
+	if strings.Contains(sent.SMS, "₦") {
+		t.Fatalf("expected ₦ to be replaced to keep the sms in the GSM alphabet, got %q", sent.SMS)
+	}
+	if segments := notification.SMSSegments(sent.SMS); segments > 3 {
+		t.Fatalf("expected the sms to be trimmed to 3 segments, got %d", segments)
+	}
+	if !strings.HasSuffix(sent.SMS, "...\nStop: https://api.rentradar.test/unsubscribe/token") {
+		t.Fatalf("expected the unsubscribe link to survive trimming, got %q", sent.SMS)
+	}
+}
+
+func TestSMSSenderPermanentFailures(t *testing.T) {
+	provider := startFakeSMSProvider(t)
+
+	// the provider rejects the api key, retrying won't help
+	sender := notification.NewSMSSender(notification.NewHTTPSMSProvider(provider.URL, "wrong-key", "RentRadar"))
+	n := notification.Notification{ID: uuid.New(), Contact: "08031234567", ContactMethod: "sms", Subject: "Hi"}
+	if _, err := sender.Send(context.Background(), n); err == nil || !notification.IsPermanent(err) {
+		t.Fatalf("expected a permanent error for a rejected request, got %v", err)
+	}
+
+	sender = notification.NewSMSSender(notification.NewHTTPSMSProvider(provider.URL, "test-sms-key", "RentRadar"))
+	n.Contact = "12345"
+	if _, err := sender.Send(context.Background(), n); err == nil || !notification.IsPermanent(err) {
+		t.Fatalf("expected a permanent error for an invalid number, got %v", err)
+	}
+}
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"08031234567", "+2348031234567", false},
+		{"0803 123 4567", "+2348031234567", false},
+		{"8031234567", "+2348031234567", false},
+		{"2348031234567", "+2348031234567", false},
+		{"+234 (803) 123-4567", "+2348031234567", false},
+		{"+447911123456", "+447911123456", false},
+		{"0803123456", "", true},
+		{"+23480312345", "", true},
+		{"0803-abc-4567", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := notification.NormalizePhoneNumber(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizePhoneNumber(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSMSSegments(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{strings.Repeat("a", 160), 1},
+		{strings.Repeat("a", 161), 2},
+		{strings.Repeat("a", 306), 2},
+		{strings.Repeat("a", 307), 3},
+		// extension characters take two septets
+		{strings.Repeat("€", 80), 1},
+		{strings.Repeat("€", 81), 2},
+		// anything outside the GSM alphabet switches to UCS-2
+		{strings.Repeat("a", 69) + "₦", 1},
+		{strings.Repeat("a", 70) + "₦", 2},
+	}
+	for _, tt := range tests {
+		if got := notification.SMSSegments(tt.text); got != tt.want {
+			t.Errorf("SMSSegments(%d chars) = %d, want %d", len([]rune(tt.text)), got, tt.want)
+		}
+	}
+}
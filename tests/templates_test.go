@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestNotificationTemplates renders every event for every channel from the
+// sample data and compares the result with testdata/templates/*.golden.
+// Run `go test ./tests -run TestNotificationTemplates -update` after changing a template.
+func TestNotificationTemplates(t *testing.T) {
+	for _, event := range notification.Events {
+		data := notification.SampleTemplateData(event)
+		for _, channel := range notification.Channels {
+			t.Run(event+"."+channel, func(t *testing.T) {
+				content, err := notification.RenderNotification(event, channel, data)
+				if err != nil {
+					t.Fatalf("error rendering template: %v", err)
+				}
+				if content.Subject == "" || content.Body == "" {
+					t.Fatalf("expected a subject and body, got %+v", content)
+				}
+				if (channel == "email") != (content.HTMLBody != "") {
+					t.Fatalf("expected an html body only for email, got %q", content.HTMLBody)
+				}
+
+				got := "Subject: " + content.Subject + "\n\n" + content.Body + "\n"
+				if content.HTMLBody != "" {
+					got += "\n---- html ----\n" + content.HTMLBody
+				}
+				golden := filepath.Join("testdata", "templates", event+"."+channel+".golden")
+				if *updateGolden {
+					if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("error reading golden file: %v", err)
+				}
+				if got != string(want) {
+					t.Fatalf("%s doesn't match the rendered template:\n%s", golden, got)
+				}
+			})
+		}
+	}
+
+	if _, err := notification.RenderNotification("open_house", "email", notification.SampleTemplateData("open_house")); err == nil {
+		t.Fatal("expected an error for an unknown event")
+	}
+
+	// users who saved a listing have no alert to mention
+	for _, event := range []string{notification.EventPriceDrop, notification.EventPriceRise, notification.EventListingRented} {
+		data := notification.SampleTemplateData(event)
+		data.Alert = database.Alert{}
+		data.Favorite = true
+		content, err := notification.RenderNotification(event, "email", data)
+		if err != nil {
+			t.Fatalf("error rendering %s for a saved listing: %v", event, err)
+		}
+		if !strings.Contains(content.Body, "you saved") && !strings.Contains(content.Body, "You saved") || strings.Contains(content.Body, "alert") {
+			t.Fatalf("expected %s to mention the saved listing and no alert, got:\n%s", event, content.Body)
+		}
+	}
+}
+
+func TestTemplatePreviewEndpoint(t *testing.T) {
+	env := SetupTestEnv(t)
+	token := registerAndLogin(t, env, map[string]string{
+		"email":        "templateadmin@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Template",
+		"last_name":    "Admin",
+		"role":         "user",
+		"phone_number": "08000000008",
+	})
+
+	preview := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("API-KEY", env.App.APIKEY)
+		req.Header.Set("SUDO-KEY", env.App.SUDOKEY)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := preview("/admin/templates/price_drop/email/preview")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PreviewTemplateHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	content := notification.Content{}
+	if err := json.Unmarshal(w.Body.Bytes(), &content); err != nil {
+		t.Fatalf("error parsing preview: %v", err)
+	}
+	if content.Subject == "" || content.HTMLBody == "" {
+		t.Fatalf("expected a rendered email, got %+v", content)
+	}
+
+	if w := preview("/admin/templates/price_drop/pigeon/preview"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown channel, got %d", w.Code)
+	}
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/database"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	unsubscriber := notification.NewUnsubscriber("https://api.rentradar.test/", "test-unsubscribe-secret")
+	userID := uuid.New()
+	alertID := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+
+	url, err := unsubscriber.URL(userID, alertID)
+	if err != nil {
+		t.Fatalf("error building unsubscribe url: %v", err)
+	}
+	token, found := strings.CutPrefix(url, "https://api.rentradar.test/unsubscribe/")
+	if !found {
+		t.Fatalf("unexpected unsubscribe url %q", url)
+	}
+	got, err := unsubscriber.Parse(token)
+	if err != nil || got.UserID != userID || got.AlertID != alertID || got.ListingID.Valid {
+		t.Fatalf("expected user %s and alert %s back, got %+v (err: %v)", userID, alertID.UUID, got, err)
+	}
+
+	// a favorite's token names the listing instead of an alert
+	listingID := uuid.New()
+	token, _ = unsubscriber.FavoriteToken(userID, listingID)
+	if got, err := unsubscriber.Parse(token); err != nil || got.AlertID.Valid || got.ListingID.UUID != listingID {
+		t.Fatalf("expected a token for listing %s, got %+v (err: %v)", listingID, got, err)
+	}
+
+	// a token without an alert or listing unsubscribes from everything
+	token, _ = unsubscriber.Token(userID, uuid.NullUUID{})
+	if got, err := unsubscriber.Parse(token); err != nil || got.AlertID.Valid || got.ListingID.Valid {
+		t.Fatalf("expected a token without an alert, got %+v (err: %v)", got, err)
+	}
+
+	other := notification.NewUnsubscriber("https://api.rentradar.test", "another-secret")
+	if _, err := other.Parse(token); err != notification.ErrInvalidUnsubscribeToken {
+		t.Fatalf("expected a token signed with another secret to be rejected, got %v", err)
+	}
+	expired := notification.NewUnsubscriber("https://api.rentradar.test", "test-unsubscribe-secret")
+	expired.TTL = -time.Minute
+	token, _ = expired.Token(userID, alertID)
+	if _, err := unsubscriber.Parse(token); err != notification.ErrInvalidUnsubscribeToken {
+		t.Fatalf("expected an expired token to be rejected, got %v", err)
+	}
+}
+
+// TestUnsubscribeEndpoints opens an unsubscribe link, then unsubscribes from
+// one alert and from everything.
+func TestUnsubscribeEndpoints(t *testing.T) {
+	env := SetupTestEnv(t)
+	ctx := context.Background()
+
+	registerAndLogin(t, env, map[string]string{
+		"email":        "unsubscribeuser@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Un",
+		"last_name":    "Subscribe",
+		"role":         "user",
+		"phone_number": "08000000015",
+	})
+	user, err := env.DB.GetUserWithEmail(ctx, "unsubscribeuser@example.com")
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	alert, err := env.DB.CreateAlert(ctx, database.CreateAlertParams{
+		UserID:        user.ID,
+		MinPrice:      100000,
+		MaxPrice:      300000,
+		Locations:     []string{"Ajah"},
+		PropertyType:  "apartment",
+		ContactMethod: "email",
+		Frequency:     notification.FrequencyInstant,
+	})
+	if err != nil {
+		t.Fatalf("error creating alert: %v", err)
+	}
+	alertToken, _ := env.App.Unsubscriber.Token(user.ID, uuid.NullUUID{UUID: alert.ID, Valid: true})
+
+	// ---------- Opening the link changes nothing ----------
+	t.Log("--- Opening unsubscribe link")
+	req := httptest.NewRequest(http.MethodGet, "/unsubscribe/"+alertToken, nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="alert"`) {
+		t.Fatalf("expected the confirmation page, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if alert, _ := env.DB.GetAlert(ctx, alert.ID); !alert.Active {
+		t.Fatal("expected opening the link to leave the alert active")
+	}
+	t.Log("✅ Confirmation page shown")
+
+	// ---------- One-click unsubscribe from the alert ----------
+	t.Log("--- Unsubscribing from the alert")
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe/"+alertToken, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostUnsubscribeHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	disabled, err := env.DB.GetAlert(ctx, alert.ID)
+	if err != nil {
+		t.Fatalf("error getting alert: %v", err)
+	}
+	if disabled.Active || disabled.DisabledReason.String != "unsubscribed" {
+		t.Fatalf("expected the alert disabled as unsubscribed, got active=%v reason=%q", disabled.Active, disabled.DisabledReason.String)
+	}
+	t.Log("✅ Alert disabled")
+
+	// ---------- One-click unsubscribe from a favorite ----------
+	t.Log("--- Unsubscribing from a favorite")
+	listing, err := env.DB.CreateListing(ctx, database.CreateListingParams{
+		AgentID:      user.ID,
+		Title:        "Saved flat",
+		Description:  "Flat for the unsubscribe test",
+		Price:        200000,
+		Location:     "Ajah",
+		PropertyType: "apartment",
+		Images:       []byte(`["img1.jpg"]`),
+		Status:       "active",
+		Furnishing:   "unfurnished",
+		RentPeriod:   "yearly",
+	})
+	if err != nil {
+		t.Fatalf("error creating listing: %v", err)
+	}
+	if _, err := env.DB.CreateFavorite(ctx, database.CreateFavoriteParams{UserID: user.ID, ListingID: listing.ID}); err != nil {
+		t.Fatalf("error creating favorite: %v", err)
+	}
+	favoriteToken, _ := env.App.Unsubscriber.FavoriteToken(user.ID, listing.ID)
+	req = httptest.NewRequest(http.MethodGet, "/unsubscribe/"+favoriteToken, nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="favorite"`) {
+		t.Fatalf("expected the confirmation page, got %d, body: %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe/"+favoriteToken, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostUnsubscribeHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	favorites, err := env.DB.GetUserFavorites(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("error getting favorites: %v", err)
+	}
+	for _, favorite := range favorites {
+		if favorite.ListingID == listing.ID {
+			t.Fatal("expected the favorite to be removed")
+		}
+	}
+	if prefs, err := notification.GetPreferences(ctx, env.DB, user.ID); err != nil || prefs.Muted {
+		t.Fatalf("expected unsubscribing from a favorite to leave the user unmuted (err: %v)", err)
+	}
+	t.Log("✅ Favorite removed")
+
+	// ---------- Unsubscribe from everything ----------
+	t.Log("--- Unsubscribing from everything")
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe/"+alertToken, strings.NewReader("scope=all"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostUnsubscribeHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	prefs, err := notification.GetPreferences(ctx, env.DB, user.ID)
+	if err != nil {
+		t.Fatalf("error getting preferences: %v", err)
+	}
+	if !prefs.Muted {
+		t.Fatal("expected the user to be muted")
+	}
+	t.Log("✅ User muted")
+
+	// ---------- Bad tokens ----------
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe/not-a-token", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad token, got %d, body: %s", w.Code, w.Body.String())
+	}
+	t.Log("✅ Bad token rejected")
+}
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/muhammadolammi/rentradar/internal/notification"
+)
+
+// fakeWhatsAppAPI stands in for the Cloud API messages endpoint. It answers
+// with the canned error when one is set.
+type fakeWhatsAppAPI struct {
+	*httptest.Server
+	errorStatus int
+	errorCode   int
+	requests    []map[string]any
+}
+
+func startFakeWhatsAppAPI(t *testing.T) *fakeWhatsAppAPI {
+	t.Helper()
+	api := &fakeWhatsAppAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/12345/messages" || r.Header.Get("Authorization") != "Bearer test-wa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"Invalid OAuth access token","code":190}}`)
+			return
+		}
+		body := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&body)
+		api.requests = append(api.requests, body)
+		if api.errorStatus != 0 {
+			w.WriteHeader(api.errorStatus)
+			fmt.Fprintf(w, `{"error":{"message":"provider says no","code":%d}}`, api.errorCode)
+			return
+		}
+		fmt.Fprint(w, `{"messaging_product":"whatsapp","messages":[{"id":"wamid.TEST"}]}`)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// lastTemplateParams returns the body parameters of the last message sent to the api.
+func lastTemplateParams(api *fakeWhatsAppAPI) []string {
+	sent, _ := json.Marshal(api.requests[len(api.requests)-1])
+	var message struct {
+		Template struct {
+			Components []struct {
+				Parameters []struct {
+					Text string `json:"text"`
+				} `json:"parameters"`
+			} `json:"components"`
+		} `json:"template"`
+	}
+	json.Unmarshal(sent, &message)
+	params := []string{}
+	for _, p := range message.Template.Components[0].Parameters {
+		params = append(params, p.Text)
+	}
+	return params
+}
+
+func TestWhatsAppSender(t *testing.T) {
+	env := SetupTestEnv(t)
+
+	// ---------- Agent posts a listing ----------
+	agentToken := registerAndLogin(t, env, map[string]string{
+		"email":        "whatsappagent@example.com",
+		"password":     "StrongPass123",
+		"first_name":   "Whats",
+		"last_name":    "App",
+		"role":         "agent",
+		"company_name": "whatsapp_homes",
+		"phone_number": "08000000005",
+	})
+	listingJSON, _ := json.Marshal(map[string]any{
+		"title":         "Serviced 2 bedroom flat",
+		"description":   "Close to the expressway",
+		"price":         2500000,
+		"location":      fmt.Sprintf("Ikeja-%d", time.Now().UnixNano()),
+		"property_type": "apartment",
+		"images":        []string{"img1.jpg"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/listings", bytes.NewBuffer(listingJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+	req.Header.Set("API-KEY", env.App.APIKEY)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PostListingsHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var listingResp struct {
+		ID       uuid.UUID `json:"id"`
+		Location string    `json:"location"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listingResp); err != nil {
+		t.Fatalf("error parsing create listing response: %v", err)
+	}
+
+	api := startFakeWhatsAppAPI(t)
+	sender := notification.NewWhatsAppSender(env.DB, "12345", "test-wa-token", "new_listing_match", "https://rentradar.test")
+	sender.APIURL = api.URL
+	n := notification.Notification{ID: uuid.New(), ListingID: uuid.NullUUID{UUID: listingResp.ID, Valid: true}, Contact: "0803 123 4567", ContactMethod: "whatsapp"}
+
+	// ---------- Template message ----------
+	t.Log("--- Sending template message")
+	messageID, err := sender.Send(context.Background(), n)
+	if err != nil {
+		t.Fatalf("error sending whatsapp message: %v", err)
+	}
+	if messageID != "wamid.TEST" {
+		t.Fatalf("unexpected message id %q", messageID)
+	}
+	sent, _ := json.Marshal(api.requests[0])
+	var message struct {
+		To       string `json:"to"`
+		Type     string `json:"type"`
+		Template struct {
+			Name string `json:"name"`
+		} `json:"template"`
+	}
+	json.Unmarshal(sent, &message)
+	if message.To != "2348031234567" || message.Type != "template" || message.Template.Name != "new_listing_match" {
+		t.Fatalf("unexpected whatsapp message: %s", sent)
+	}
+	// without an unsubscribe link the site fills its place, so the template
+	// always gets its 5 parameters
+	want := []string{"Serviced 2 bedroom flat", "₦2,500,000", listingResp.Location, "https://rentradar.test/listings/" + listingResp.ID.String(), "https://rentradar.test"}
+	if params := lastTemplateParams(api); fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Fatalf("expected template params %q, got %q", want, params)
+	}
+	withLink := n
+	withLink.UnsubscribeURL = "https://api.rentradar.test/unsubscribe/token"
+	if _, err := sender.Send(context.Background(), withLink); err != nil {
+		t.Fatalf("error sending whatsapp message: %v", err)
+	}
+	want[4] = withLink.UnsubscribeURL
+	if params := lastTemplateParams(api); fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Fatalf("expected template params %q, got %q", want, params)
+	}
+	t.Log("✅ Template message sent")
+
+	// ---------- Favorite events ----------
+	t.Log("--- Sending rented and price change messages")
+	link := "https://rentradar.test/listings/" + listingResp.ID.String()
+	rented := n
+	rented.Event = notification.EventListingRented
+	priceRise := n
+	priceRise.Event = notification.EventPriceRise
+	priceDrop := n
+	priceDrop.Event = notification.EventPriceDrop
+	// without their own templates these go to the next channel, not the new match template
+	for _, event := range []notification.Notification{rented, priceRise, priceDrop} {
+		if _, err := sender.Send(context.Background(), event); !notification.IsPermanent(err) {
+			t.Fatalf("expected a permanent error for %s without a template, got %v", event.Event, err)
+		}
+	}
+	sender.RentedTemplateName = "listing_rented"
+	sender.PriceRiseTemplateName = "listing_price_rise"
+	sender.PriceDropTemplateName = "listing_price_drop"
+	if _, err := sender.Send(context.Background(), rented); err != nil {
+		t.Fatalf("error sending rented message: %v", err)
+	}
+	want = []string{"Serviced 2 bedroom flat", listingResp.Location, link, "https://rentradar.test"}
+	if name := api.requests[len(api.requests)-1]["template"].(map[string]any)["name"]; name != "listing_rented" {
+		t.Fatalf("expected the listing_rented template, got %v", name)
+	}
+	if params := lastTemplateParams(api); fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Fatalf("expected rented params %q, got %q", want, params)
+	}
+	if w := jsonRequest(t, env, http.MethodPatch, "/listings/"+listingResp.ID.String(), agentToken, map[string]any{"price": 2800000}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchListingHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	priceRise.CreatedAt = time.Now()
+	if _, err := sender.Send(context.Background(), priceRise); err != nil {
+		t.Fatalf("error sending price rise message: %v", err)
+	}
+	want = []string{"Serviced 2 bedroom flat", "₦2,500,000", "₦2,800,000", listingResp.Location, link, "https://rentradar.test"}
+	if name := api.requests[len(api.requests)-1]["template"].(map[string]any)["name"]; name != "listing_price_rise" {
+		t.Fatalf("expected the listing_price_rise template, got %v", name)
+	}
+	if params := lastTemplateParams(api); fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Fatalf("expected price rise params %q, got %q", want, params)
+	}
+	if w := jsonRequest(t, env, http.MethodPatch, "/listings/"+listingResp.ID.String(), agentToken, map[string]any{"price": 2200000}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 from PatchListingHandler, got %d, body: %s", w.Code, w.Body.String())
+	}
+	priceDrop.CreatedAt = time.Now()
+	if _, err := sender.Send(context.Background(), priceDrop); err != nil {
+		t.Fatalf("error sending price drop message: %v", err)
+	}
+	// the drop is from the risen price, not the price the listing was posted at
+	want = []string{"Serviced 2 bedroom flat", "₦2,800,000", "₦2,200,000", listingResp.Location, link, "https://rentradar.test"}
+	if name := api.requests[len(api.requests)-1]["template"].(map[string]any)["name"]; name != "listing_price_drop" {
+		t.Fatalf("expected the listing_price_drop template, got %v", name)
+	}
+	if params := lastTemplateParams(api); fmt.Sprint(params) != fmt.Sprint(want) {
+		t.Fatalf("expected price drop params %q, got %q", want, params)
+	}
+	t.Log("✅ Rented and price change messages sent")
+
+	// ---------- Provider errors ----------
+	t.Log("--- Checking provider errors")
+	api.errorStatus, api.errorCode = http.StatusBadRequest, 131026
+	_, err = sender.Send(context.Background(), n)
+	var providerErr *notification.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Code != 131026 || !notification.IsPermanent(err) {
+		t.Fatalf("expected a permanent provider error with code 131026, got %v", err)
+	}
+	api.errorStatus, api.errorCode = http.StatusBadRequest, 130429
+	_, err = sender.Send(context.Background(), n)
+	if !errors.As(err, &providerErr) || providerErr.Code != 130429 || notification.IsPermanent(err) {
+		t.Fatalf("expected a retryable rate limit error, got %v", err)
+	}
+	t.Log("✅ Provider errors classified")
+
+	// ---------- Unknown listing ----------
+	_, err = sender.Send(context.Background(), notification.Notification{ID: uuid.New(), ListingID: uuid.NullUUID{UUID: uuid.New(), Valid: true}, Contact: "08031234567", ContactMethod: "whatsapp"})
+	if !notification.IsPermanent(err) {
+		t.Fatalf("expected a permanent error for a missing listing, got %v", err)
+	}
+}